@@ -0,0 +1,69 @@
+package dag
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// TaskError identifies the task that failed while processing a record
+type TaskError struct {
+	// Task is the name of the task that failed
+	Task string
+	// Path to the task from the root of the dag
+	Path []string
+	// RecordID is the Meta().ID of the record being processed
+	RecordID string
+	// Err returned by the task
+	Err error
+}
+
+// Error implements error
+func (t *TaskError) Error() string {
+	return fmt.Sprintf("task, %v, failed processing record, %v: %v", strings.Join(t.Path, "/"), t.RecordID, t.Err)
+}
+
+// Unwrap returns the underlying error
+func (t *TaskError) Unwrap() error {
+	return t.Err
+}
+
+// Annotate is middleware that wraps errors in a *TaskError identifying the
+// innermost task that failed.  Errors that already contain a *TaskError and
+// dropped records are returned unchanged
+func Annotate(task Task) Task {
+	return middlewareTask(task,
+		func(ctx context.Context, record *Record) error {
+			return annotate(ctx, task, record, task.Apply(ctx, record))
+		},
+		func(ctx context.Context, records []*Record) []error {
+			errs := applyBatch(ctx, task, records)
+			for i, err := range errs {
+				errs[i] = annotate(ctx, task, records[i], err)
+			}
+			return errs
+		},
+	)
+}
+
+// annotate wraps the error returned by task for record in a *TaskError
+func annotate(ctx context.Context, task Task, record *Record, err error) error {
+	if err == nil || IsDropped(err) {
+		return err
+	}
+
+	var te *TaskError
+	if xerrors.As(err, &te) {
+		return err
+	}
+
+	path := Path(ctx)
+	return &TaskError{
+		Task:     taskName(path, task),
+		Path:     path,
+		RecordID: record.Meta().ID,
+		Err:      err,
+	}
+}
@@ -0,0 +1,40 @@
+package dag
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/tj/assert"
+	"golang.org/x/xerrors"
+)
+
+func TestAnnotate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("innermost task", func(t *testing.T) {
+		task := Serial(
+			WithName("a", nopTask()),
+			Parallel(WithName("b", TaskFunc(func(ctx context.Context, record *Record) error {
+				return io.EOF
+			}))),
+		)
+		task = Wrap(task, Annotate)
+
+		err := task.Apply(ctx, NewRecord(Meta{ID: "abc"}))
+
+		var te *TaskError
+		assert.True(t, xerrors.As(err, &te))
+		assert.Equal(t, "b", te.Task)
+		assert.Equal(t, []string{"Serial", "Parallel", "b"}, te.Path)
+		assert.Equal(t, "abc", te.RecordID)
+		assert.True(t, xerrors.Is(err, io.EOF))
+		assert.Equal(t, "task, Serial/Parallel/b, failed processing record, abc: EOF", err.Error())
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		task := Wrap(nopTask(), Annotate)
+		err := task.Apply(ctx, &Record{})
+		assert.Nil(t, err)
+	})
+}
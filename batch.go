@@ -0,0 +1,217 @@
+package dag
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// BatchTask is implemented by tasks that can process many records more
+// efficiently at once than individually e.g. by combining remote lookups.
+// Serial, If and named tasks apply batch capable children in batch, as do tasks
+// wrapped with the middleware provided by this package.  Other middleware
+// applied with Wrap is per record unless the Task it returns is itself a
+// BatchTask, so tasks wrapped in such middleware process batches one record at
+// a time
+type BatchTask interface {
+	Task
+
+	// ApplyBatch applies the task to each of the records.  To fail only some
+	// of the records, return a *BatchError; any other error fails them all
+	ApplyBatch(ctx context.Context, records []*Record) error
+}
+
+// BatchError reports the outcome of each record within a batch
+type BatchError struct {
+	// Errs holds the error, or nil, for each record in the order provided
+	Errs []error
+}
+
+// Error implements error
+func (b *BatchError) Error() string {
+	var (
+		failed int
+		first  error
+	)
+	for _, err := range b.Errs {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+	return fmt.Sprintf("%v of %v records failed: %v", failed, len(b.Errs), first)
+}
+
+// newBatchError returns a *BatchError if any of the errs are non-nil
+func newBatchError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return &BatchError{Errs: errs}
+		}
+	}
+	return nil
+}
+
+// batchErrors expands the error returned by ApplyBatch into one per record
+func batchErrors(err error, n int) []error {
+	errs := make([]error, n)
+	if err == nil {
+		return errs
+	}
+
+	if b, ok := err.(*BatchError); ok && len(b.Errs) == n {
+		copy(errs, b.Errs)
+		return errs
+	}
+
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+// applyBatch applies the task to the records in batch if supported and one at a
+// time otherwise, returning the error for each record
+func applyBatch(ctx context.Context, task Task, records []*Record) []error {
+	if v, ok := task.(BatchTask); ok {
+		return batchErrors(v.ApplyBatch(ctx, records), len(records))
+	}
+
+	errs := make([]error, len(records))
+	for i, record := range records {
+		errs[i] = task.Apply(ctx, record)
+	}
+	return errs
+}
+
+// safeApplyBatch is applyBatch with any panic returned as a *PanicError for
+// each record
+func safeApplyBatch(ctx context.Context, name string, task Task, records []*Record) (errs []error) {
+	if len(records) == 1 {
+		return []error{safeApply(ctx, name, task, records[0])}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			stack := debug.Stack()
+			errs = make([]error, len(records))
+			for i, record := range records {
+				errs[i] = &PanicError{
+					Task:     name,
+					RecordID: record.Meta().ID,
+					Value:    r,
+					Stack:    stack,
+				}
+			}
+		}
+	}()
+
+	return applyBatch(ctx, task, records)
+}
+
+// ApplyBatch applies the target in batch if supported
+func (n namedTask) ApplyBatch(ctx context.Context, records []*Record) error {
+	return newBatchError(applyBatch(ctx, n.target, records))
+}
+
+// ApplyBatch applies the middleware in batch if supported and to each record in
+// turn otherwise
+func (w wrappedTask) ApplyBatch(ctx context.Context, records []*Record) error {
+	return newBatchError(applyBatch(pushPath(ctx, w.name), w.target, records))
+}
+
+// batchTaskFunc is a TaskFunc that can also be applied to batches
+type batchTaskFunc struct {
+	TaskFunc
+	batch func(ctx context.Context, records []*Record) []error
+}
+
+// ApplyBatch implements BatchTask
+func (b batchTaskFunc) ApplyBatch(ctx context.Context, records []*Record) error {
+	return newBatchError(b.batch(ctx, records))
+}
+
+// middlewareTask returns the task produced by middleware wrapping task; batch is
+// used only if task is a BatchTask so that the middleware passes batches through
+// to tasks that support them
+func middlewareTask(task Task, apply TaskFunc, batch func(ctx context.Context, records []*Record) []error) Task {
+	if _, ok := task.(BatchTask); !ok {
+		return apply
+	}
+	return batchTaskFunc{TaskFunc: apply, batch: batch}
+}
+
+// ApplyBatch applies each task in turn to the records that have not yet failed
+func (s *serial) ApplyBatch(ctx context.Context, records []*Record) error {
+	ctx = Push(ctx)
+
+	var (
+		errs    = make([]error, len(records))
+		live    = records
+		indexes = make([]int, len(records)) // position of each live record within records
+	)
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	for _, task := range s.tasks {
+		if len(live) == 0 {
+			break
+		}
+
+		var (
+			nextLive    []*Record
+			nextIndexes []int
+		)
+		for i, err := range applyBatch(ctx, task, live) {
+			if err != nil {
+				errs[indexes[i]] = err
+				continue
+			}
+			nextLive = append(nextLive, live[i])
+			nextIndexes = append(nextIndexes, indexes[i])
+		}
+		live, indexes = nextLive, nextIndexes
+	}
+
+	return newBatchError(errs)
+}
+
+// ApplyBatch partitions the records by the predicate and applies each branch in
+// batch
+func (c *conditional) ApplyBatch(ctx context.Context, records []*Record) error {
+	var (
+		errs     = make([]error, len(records))
+		branches = make([][]int, len(c.tasks)) // indexes of the records for each branch
+	)
+	for i, record := range records {
+		ok, err := c.predicate(ctx, record)
+		switch {
+		case err != nil:
+			errs[i] = err
+		case ok:
+			branches[0] = append(branches[0], i)
+		case len(c.tasks) > 1:
+			branches[1] = append(branches[1], i)
+		}
+	}
+
+	ctx = Push(ctx)
+	for branch, indexes := range branches {
+		if len(indexes) == 0 {
+			continue
+		}
+
+		batch := make([]*Record, 0, len(indexes))
+		for _, i := range indexes {
+			batch = append(batch, records[i])
+		}
+		for j, err := range applyBatch(ctx, c.tasks[branch], batch) {
+			errs[indexes[j]] = err
+		}
+	}
+
+	return newBatchError(errs)
+}
@@ -0,0 +1,261 @@
+package dag
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tj/assert"
+	"golang.org/x/xerrors"
+)
+
+// batchRecorder records the size of each batch it receives and fails records
+// whose id is in fail
+type batchRecorder struct {
+	mutex   sync.Mutex
+	batches []int
+	fail    map[string]bool
+}
+
+func (b *batchRecorder) Apply(ctx context.Context, record *Record) error {
+	return b.ApplyBatch(ctx, []*Record{record})
+}
+
+func (b *batchRecorder) ApplyBatch(ctx context.Context, records []*Record) error {
+	b.mutex.Lock()
+	b.batches = append(b.batches, len(records))
+	b.mutex.Unlock()
+
+	errs := make([]error, len(records))
+	for i, record := range records {
+		if b.fail[record.Meta().ID] {
+			errs[i] = io.EOF
+		}
+		record.Set("batched", len(records))
+	}
+	return newBatchError(errs)
+}
+
+func (b *batchRecorder) sizes() []int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]int(nil), b.batches...)
+}
+
+func TestRunner_WithBatch(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("size", func(t *testing.T) {
+		task := &batchRecorder{fail: map[string]bool{"3": true}}
+		runner := NewRunner(task, WithBatch(4, 0), WithWorkers(1), WithOrdered(8))
+
+		var (
+			ids    []string
+			failed []string
+		)
+		for result := range runner.Run(ctx, records(10)) {
+			ids = append(ids, result.Record.Meta().ID)
+			if result.Err != nil {
+				assert.Equal(t, io.EOF, result.Err)
+				failed = append(failed, result.Record.Meta().ID)
+			}
+		}
+		assert.Equal(t, []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}, ids)
+		assert.Equal(t, []string{"3"}, failed)
+		assert.Equal(t, []int{4, 4, 2}, task.sizes())
+
+		stats := runner.Stats()
+		assert.EqualValues(t, 10, stats.Processed)
+		assert.EqualValues(t, 1, stats.Failed)
+	})
+
+	t.Run("window", func(t *testing.T) {
+		var (
+			task = &batchRecorder{}
+			in   = make(chan *Record)
+		)
+		runner := NewRunner(task, WithBatch(100, 10*time.Millisecond))
+		out := runner.Run(ctx, in)
+
+		in <- NewRecord(Meta{ID: "a"})
+		in <- NewRecord(Meta{ID: "b"})
+		result := <-out // flushed by the window rather than the size
+		assert.Nil(t, result.Err)
+		<-out
+
+		close(in)
+		for range out {
+		}
+		assert.Equal(t, []int{2}, task.sizes())
+	})
+
+	t.Run("ordered window smaller than batch", func(t *testing.T) {
+		task := &batchRecorder{}
+		runner := NewRunner(task, WithBatch(10, 0), WithOrdered(3))
+
+		var n int
+		for result := range runner.Run(ctx, records(7)) {
+			assert.Nil(t, result.Err)
+			n++
+		}
+		assert.Equal(t, 7, n)
+	})
+
+	t.Run("non batch task", func(t *testing.T) {
+		var counter int64
+		runner := NewRunner(counterTask(&counter), WithBatch(4, 0))
+		for result := range runner.Run(ctx, records(10)) {
+			assert.Nil(t, result.Err)
+		}
+		assert.EqualValues(t, 10, counter)
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		task := Serial(panicBatch{})
+		runner := NewRunner(task, WithBatch(2, 0), WithWorkers(1))
+
+		var ids []string
+		for result := range runner.Run(ctx, records(2)) {
+			pe, ok := result.Err.(*PanicError)
+			assert.True(t, ok)
+			ids = append(ids, pe.RecordID)
+		}
+		assert.Equal(t, []string{"0", "1"}, ids)
+	})
+}
+
+func TestRunner_WithBatchWrapped(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("middleware", func(t *testing.T) {
+		var (
+			batched   = &batchRecorder{fail: map[string]bool{"3": true}}
+			collector = NewPrometheusCollector()
+			tracer    = NewMemoryTracer()
+			buf       = bytes.NewBuffer(nil)
+			logger    = slog.New(slog.NewJSONHandler(buf, nil))
+		)
+		task := Wrap(Serial(WithName("batched", batched)),
+			Recover,
+			Annotate,
+			Metrics("orders", collector),
+			Logger(logger),
+			Trace(tracer),
+			Timing,
+		)
+		runner := NewRunner(task, WithBatch(4, 0), WithWorkers(1))
+
+		var failed []string
+		for result := range runner.Run(ctx, records(10)) {
+			if result.Err != nil {
+				var te *TaskError
+				assert.True(t, xerrors.As(result.Err, &te))
+				assert.Equal(t, "batched", te.Task)
+				assert.Equal(t, io.EOF, te.Err)
+				failed = append(failed, te.RecordID)
+			}
+		}
+		assert.Equal(t, []string{"3"}, failed)
+		assert.Equal(t, []int{4, 4, 2}, batched.sizes())
+
+		body := bytes.NewBuffer(nil)
+		_, err := collector.WriteTo(body)
+		assert.Nil(t, err)
+		assert.Contains(t, body.String(), `dag_task_total{pipeline="orders",task="batched",status="success"} 9`)
+		assert.Contains(t, body.String(), `dag_task_total{pipeline="orders",task="batched",status="failure"} 1`)
+
+		assert.Equal(t, 10, strings.Count(buf.String(), `"msg":"task started","task":"batched"`))
+		assert.Len(t, tracer.Spans(), 6) // Serial and batched for each of 3 batches
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		task := Wrap(WithName("panic", panicBatch{}), Recover)
+		runner := NewRunner(task, WithBatch(2, 0), WithWorkers(1))
+
+		var ids []string
+		for result := range runner.Run(ctx, records(2)) {
+			pe, ok := result.Err.(*PanicError)
+			assert.True(t, ok)
+			assert.Equal(t, "panic", pe.Task)
+			ids = append(ids, pe.RecordID)
+		}
+		assert.Equal(t, []string{"0", "1"}, ids)
+	})
+}
+
+type panicBatch struct{}
+
+func (panicBatch) Apply(ctx context.Context, record *Record) error { panic("boom") }
+
+func (panicBatch) ApplyBatch(ctx context.Context, records []*Record) error { panic("boom") }
+
+func TestSerial_ApplyBatch(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		first   = &batchRecorder{fail: map[string]bool{"1": true}}
+		second  = &batchRecorder{}
+		counter int64
+		task    = Serial(first, WithName("count", counterTask(&counter)), second)
+		batch   = []*Record{NewRecord(Meta{ID: "0"}), NewRecord(Meta{ID: "1"}), NewRecord(Meta{ID: "2"})}
+	)
+
+	errs := applyBatch(ctx, task, batch)
+	assert.Equal(t, []error{nil, io.EOF, nil}, errs)
+	assert.Equal(t, []int{3}, first.sizes())
+	assert.Equal(t, []int{2}, second.sizes())
+	assert.EqualValues(t, 2, counter)
+
+	t.Run("wrapped", func(t *testing.T) {
+		var (
+			order   []string
+			batched = &batchRecorder{}
+		)
+		task := Wrap(Serial(batched), middleware(&order, "a"))
+		errs := applyBatch(ctx, task, []*Record{{}, {}})
+		assert.Equal(t, []error{nil, nil}, errs)
+		assert.Equal(t, []int{1, 1}, batched.sizes())
+		assert.Len(t, order, 4)
+	})
+}
+
+func TestIf_ApplyBatch(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		then = &batchRecorder{}
+		els  = &batchRecorder{}
+		task = If(func(ctx context.Context, record *Record) (bool, error) {
+			switch record.Meta().ID {
+			case "err":
+				return false, io.EOF
+			case "a", "b":
+				return true, nil
+			}
+			return false, nil
+		}, then, els)
+		batch = []*Record{
+			NewRecord(Meta{ID: "a"}),
+			NewRecord(Meta{ID: "err"}),
+			NewRecord(Meta{ID: "b"}),
+			NewRecord(Meta{ID: "c"}),
+		}
+	)
+
+	errs := applyBatch(ctx, task, batch)
+	assert.Equal(t, []error{nil, io.EOF, nil, nil}, errs)
+	assert.Equal(t, []int{2}, then.sizes())
+	assert.Equal(t, []int{1}, els.sizes())
+}
+
+func TestBatchError(t *testing.T) {
+	err := newBatchError([]error{nil, io.EOF, io.ErrUnexpectedEOF})
+	assert.EqualError(t, err, "2 of 3 records failed: EOF")
+	assert.Nil(t, newBatchError([]error{nil, nil}))
+
+	assert.Equal(t, []error{io.EOF, io.EOF}, batchErrors(io.EOF, 2))
+	assert.Equal(t, []error{nil, nil}, batchErrors(nil, 2))
+}
@@ -0,0 +1,514 @@
+package builtin
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+type cacheOptions struct {
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	negative    bool
+	path        string
+	now         func() time.Time
+}
+
+// CacheOption provides functional options for CachedDataSource and
+// CachedGeocoder
+type CacheOption func(*cacheOptions)
+
+// WithCacheSize bounds the number of entries held; the least recently used
+// entry is evicted once full.  Defaults to 10,000
+func WithCacheSize(n int) CacheOption {
+	return func(o *cacheOptions) {
+		o.size = n
+	}
+}
+
+// WithTTL sets how long entries remain valid.  Defaults to no expiry
+func WithTTL(d time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.ttl = d
+	}
+}
+
+// WithNegativeTTL sets how long not found results remain valid.  Defaults to
+// the TTL
+func WithNegativeTTL(d time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.negativeTTL = d
+	}
+}
+
+// WithoutNegativeCaching disables caching of not found results
+func WithoutNegativeCaching() CacheOption {
+	return func(o *cacheOptions) {
+		o.negative = false
+	}
+}
+
+// WithCacheFile loads the cache from path, if it exists, when the cache is
+// created.  Save writes the cache back to path.  As entries are stored as JSON,
+// numbers are restored as float64
+func WithCacheFile(path string) CacheOption {
+	return func(o *cacheOptions) {
+		o.path = path
+	}
+}
+
+func makeCacheOptions(opts ...CacheOption) cacheOptions {
+	o := cacheOptions{
+		size:        10000,
+		negativeTTL: -1,
+		negative:    true,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.negativeTTL < 0 {
+		o.negativeTTL = o.ttl
+	}
+	return o
+}
+
+// CacheStats reports the effectiveness of a cache
+type CacheStats struct {
+	// Hits is the number of lookups answered from the cache, including
+	// NegativeHits
+	Hits uint64
+	// NegativeHits is the number of lookups answered by a cached not found
+	NegativeHits uint64
+	// Misses is the number of lookups passed to the underlying source
+	Misses uint64
+	// Evictions is the number of entries removed to make room for others
+	Evictions uint64
+	// Size is the current number of entries
+	Size int
+}
+
+// HitRatio is the fraction of lookups answered from the cache
+func (s CacheStats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+type cacheEntry struct {
+	Key      string                 `json:"key"`
+	Value    map[string]interface{} `json:"value,omitempty"`
+	NotFound bool                   `json:"not_found,omitempty"`
+	Expires  time.Time              `json:"expires,omitempty"`
+}
+
+// cache is a size bounded LRU cache with expiry
+type cache struct {
+	options cacheOptions
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // front is most recently used
+
+	hits         uint64
+	negativeHits uint64
+	misses       uint64
+	evictions    uint64
+}
+
+func newCache(options cacheOptions) (*cache, error) {
+	c := &cache{
+		options: options,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+	if options.path != "" {
+		if err := c.load(options.path); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// get returns the cached entry for key, if present and unexpired, recording a
+// hit or miss
+func (c *cache) get(key string) (cacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*cacheEntry)
+		if entry.Expires.IsZero() || c.options.now().Before(entry.Expires) {
+			c.lru.MoveToFront(element)
+			atomic.AddUint64(&c.hits, 1)
+			if entry.NotFound {
+				atomic.AddUint64(&c.negativeHits, 1)
+			}
+			return *entry, true
+		}
+		c.remove(element)
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+	return cacheEntry{}, false
+}
+
+// put stores the value, or a not found result if value is nil
+func (c *cache) put(key string, value map[string]interface{}) {
+	notFound := value == nil
+	if notFound && !c.options.negative {
+		return
+	}
+
+	ttl := c.options.ttl
+	if notFound {
+		ttl = c.options.negativeTTL
+	}
+
+	entry := &cacheEntry{Key: key, Value: value, NotFound: notFound}
+	if ttl > 0 {
+		entry.Expires = c.options.now().Add(ttl)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.add(entry)
+}
+
+// add inserts the entry evicting the least recently used entries as needed;
+// must be called with the mutex held
+func (c *cache) add(entry *cacheEntry) {
+	if element, ok := c.entries[entry.Key]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+
+	c.entries[entry.Key] = c.lru.PushFront(entry)
+	for c.options.size > 0 && c.lru.Len() > c.options.size {
+		c.remove(c.lru.Back())
+		atomic.AddUint64(&c.evictions, 1)
+	}
+}
+
+// remove must be called with the mutex held
+func (c *cache) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).Key)
+}
+
+func (c *cache) stats() CacheStats {
+	c.mutex.Lock()
+	size := c.lru.Len()
+	c.mutex.Unlock()
+
+	return CacheStats{
+		Hits:         atomic.LoadUint64(&c.hits),
+		NegativeHits: atomic.LoadUint64(&c.negativeHits),
+		Misses:       atomic.LoadUint64(&c.misses),
+		Evictions:    atomic.LoadUint64(&c.evictions),
+		Size:         size,
+	}
+}
+
+// save writes the unexpired entries, least recently used first, to the cache
+// file.  The file is replaced atomically
+func (c *cache) save() error {
+	if c.options.path == "" {
+		return xerrors.New("unable to save cache: no cache file specified")
+	}
+
+	now := c.options.now()
+	c.mutex.Lock()
+	entries := make([]*cacheEntry, 0, c.lru.Len())
+	for element := c.lru.Back(); element != nil; element = element.Prev() {
+		entry := element.Value.(*cacheEntry)
+		if entry.Expires.IsZero() || now.Before(entry.Expires) {
+			entries = append(entries, entry)
+		}
+	}
+	data, err := json.Marshal(entries)
+	c.mutex.Unlock()
+	if err != nil {
+		return xerrors.Errorf("unable to encode cache: %w", err)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(c.options.path), filepath.Base(c.options.path)+".*")
+	if err != nil {
+		return xerrors.Errorf("unable to save cache: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return xerrors.Errorf("unable to save cache: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return xerrors.Errorf("unable to save cache: %w", err)
+	}
+	if err := os.Rename(f.Name(), c.options.path); err != nil {
+		return xerrors.Errorf("unable to save cache: %w", err)
+	}
+	return nil
+}
+
+// load reads the entries written by save; a missing file is not an error
+func (c *cache) load(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("unable to load cache: %w", err)
+	}
+
+	var entries []*cacheEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return xerrors.Errorf("unable to load cache, %v: %w", path, err)
+	}
+
+	now := c.options.now()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, entry := range entries {
+		if entry.Expires.IsZero() || now.Before(entry.Expires) {
+			c.add(entry)
+		}
+	}
+	return nil
+}
+
+// DataSourceCache is a DataSource that caches the results of another
+type DataSourceCache struct {
+	ds    DataSource
+	cache *cache
+}
+
+// CachedDataSource returns a DataSource that caches the records, and not found
+// results, of ds.  An error is returned only if the cache file provided by
+// WithCacheFile cannot be read
+func CachedDataSource(ds DataSource, opts ...CacheOption) (*DataSourceCache, error) {
+	c, err := newCache(makeCacheOptions(opts...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataSourceCache{
+		ds:    ds,
+		cache: c,
+	}, nil
+}
+
+// Get implements DataSource
+func (d *DataSourceCache) Get(ctx context.Context, key string) (map[string]interface{}, error) {
+	if entry, ok := d.cache.get(key); ok {
+		if entry.NotFound {
+			return nil, &notFoundError{key: key}
+		}
+		return entry.Value, nil
+	}
+	return d.load(ctx, key)
+}
+
+// load retrieves key from the underlying DataSource, caching the result
+func (d *DataSourceCache) load(ctx context.Context, key string) (map[string]interface{}, error) {
+	v, err := d.ds.Get(ctx, key)
+	if err != nil {
+		if IsNotFound(err) {
+			d.cache.put(key, nil)
+		}
+		return nil, err
+	}
+
+	d.cache.put(key, v)
+	return v, nil
+}
+
+// GetMany implements BatchDataSource.  Keys missing from the cache are
+// retrieved with a single call to GetMany if the underlying DataSource
+// supports it and with Get otherwise
+func (d *DataSourceCache) GetMany(ctx context.Context, keys []string) (map[string]map[string]interface{}, error) {
+	var (
+		found  = map[string]map[string]interface{}{}
+		misses []string
+	)
+	for _, key := range keys {
+		entry, ok := d.cache.get(key)
+		switch {
+		case !ok:
+			misses = append(misses, key)
+		case !entry.NotFound:
+			found[key] = entry.Value
+		}
+	}
+	if len(misses) == 0 {
+		return found, nil
+	}
+
+	batch, ok := d.ds.(BatchDataSource)
+	if !ok {
+		for _, key := range misses {
+			v, err := d.load(ctx, key)
+			if err != nil && !IsNotFound(err) {
+				return nil, err
+			}
+			if err == nil {
+				found[key] = v
+			}
+		}
+		return found, nil
+	}
+
+	results, err := batch.GetMany(ctx, misses)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range misses {
+		v := results[key]
+		d.cache.put(key, v)
+		if v != nil {
+			found[key] = v
+		}
+	}
+	return found, nil
+}
+
+// Stats returns the cache statistics
+func (d *DataSourceCache) Stats() CacheStats {
+	return d.cache.stats()
+}
+
+// Save writes the cache to the file provided by WithCacheFile
+func (d *DataSourceCache) Save() error {
+	return d.cache.save()
+}
+
+// GeocoderCache is a Geocoder that caches the results of another
+type GeocoderCache struct {
+	geocoder Geocoder
+	cache    *cache
+}
+
+// CachedGeocoder returns a Geocoder that caches the results of geocoder by
+// address.  Addresses the geocoder could not find, a nil result or an error
+// wrapping ErrNotFound, are cached as not found; Lookup reports them with an
+// error that wraps ErrNotFound and LookupMany as a nil result.  An error is returned only if the cache file provided by
+// WithCacheFile cannot be read
+func CachedGeocoder(geocoder Geocoder, opts ...CacheOption) (*GeocoderCache, error) {
+	c, err := newCache(makeCacheOptions(opts...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &GeocoderCache{
+		geocoder: geocoder,
+		cache:    c,
+	}, nil
+}
+
+func addressKey(address Address) string {
+	return strings.Join([]string{address.Street, address.City, address.State}, "|")
+}
+
+// Lookup implements Geocoder
+func (g *GeocoderCache) Lookup(ctx context.Context, street, city, state string) (map[string]interface{}, error) {
+	address := Address{Street: street, City: city, State: state}
+	if entry, ok := g.cache.get(addressKey(address)); ok {
+		if entry.Value == nil {
+			return nil, &addressNotFoundError{address: address}
+		}
+		return entry.Value, nil
+	}
+
+	v, err := g.load(ctx, address)
+	if err == nil && v == nil {
+		return nil, &addressNotFoundError{address: address}
+	}
+	return v, err
+}
+
+// load geocodes address with the underlying Geocoder, caching the result
+func (g *GeocoderCache) load(ctx context.Context, address Address) (map[string]interface{}, error) {
+	key := addressKey(address)
+	v, err := g.geocoder.Lookup(ctx, address.Street, address.City, address.State)
+	if err != nil {
+		if IsNotFound(err) {
+			g.cache.put(key, nil)
+		}
+		return nil, err
+	}
+
+	g.cache.put(key, v)
+	return v, nil
+}
+
+// LookupMany implements BatchGeocoder.  Addresses missing from the cache are
+// geocoded with a single call to LookupMany if the underlying Geocoder
+// supports it and with Lookup otherwise
+func (g *GeocoderCache) LookupMany(ctx context.Context, addresses []Address) ([]map[string]interface{}, error) {
+	var (
+		results = make([]map[string]interface{}, len(addresses))
+		misses  []Address
+		indexes []int // position of each miss within addresses
+	)
+	for i, address := range addresses {
+		if entry, ok := g.cache.get(addressKey(address)); ok {
+			results[i] = entry.Value
+			continue
+		}
+		misses = append(misses, address)
+		indexes = append(indexes, i)
+	}
+	if len(misses) == 0 {
+		return results, nil
+	}
+
+	batch, ok := g.geocoder.(BatchGeocoder)
+	if !ok {
+		for j, address := range misses {
+			v, err := g.load(ctx, address)
+			if err != nil && !IsNotFound(err) {
+				return nil, err
+			}
+			results[indexes[j]] = v
+		}
+		return results, nil
+	}
+
+	found, err := batch.LookupMany(ctx, misses)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) != len(misses) {
+		return nil, xerrors.Errorf("geocoder returned %v results for %v addresses", len(found), len(misses))
+	}
+	for j, v := range found {
+		g.cache.put(addressKey(misses[j]), v)
+		results[indexes[j]] = v
+	}
+	return results, nil
+}
+
+// Stats returns the cache statistics
+func (g *GeocoderCache) Stats() CacheStats {
+	return g.cache.stats()
+}
+
+// Save writes the cache to the file provided by WithCacheFile
+func (g *GeocoderCache) Save() error {
+	return g.cache.save()
+}
@@ -0,0 +1,353 @@
+package builtin
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/savaki/dag"
+	"github.com/tj/assert"
+)
+
+// fakeClock provides a controllable time source for expiry
+type fakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) Add(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.now = f.now.Add(d)
+}
+
+func withClock(clock *fakeClock) CacheOption {
+	return func(o *cacheOptions) {
+		o.now = clock.Now
+	}
+}
+
+type failingDataSource struct {
+	err   error
+	calls int
+}
+
+func (f *failingDataSource) Get(ctx context.Context, key string) (map[string]interface{}, error) {
+	f.calls++
+	return nil, f.err
+}
+
+func TestCachedDataSource(t *testing.T) {
+	ctx := context.Background()
+	newSource := func() *countingDataSource {
+		return &countingDataSource{NestedMapDataSource: NestedMapDataSource{
+			"a": {"name": "alpha"},
+			"b": {"name": "bravo"},
+			"c": {"name": "charlie"},
+		}}
+	}
+
+	t.Run("hits and misses", func(t *testing.T) {
+		ds := newSource()
+		cached, err := CachedDataSource(ds)
+		assert.Nil(t, err)
+
+		for i := 0; i < 3; i++ {
+			v, err := cached.Get(ctx, "a")
+			assert.Nil(t, err)
+			assert.Equal(t, "alpha", v["name"])
+		}
+		assert.Equal(t, []string{"a"}, ds.gets)
+
+		stats := cached.Stats()
+		assert.EqualValues(t, 2, stats.Hits)
+		assert.EqualValues(t, 1, stats.Misses)
+		assert.Equal(t, 1, stats.Size)
+		assert.InDelta(t, 2.0/3.0, stats.HitRatio(), 0.001)
+	})
+
+	t.Run("negative caching", func(t *testing.T) {
+		ds := newSource()
+		cached, err := CachedDataSource(ds)
+		assert.Nil(t, err)
+
+		for i := 0; i < 2; i++ {
+			_, err := cached.Get(ctx, "missing")
+			assert.True(t, IsNotFound(err))
+			assert.EqualError(t, err, "key, missing, not found")
+		}
+		assert.Equal(t, []string{"missing"}, ds.gets)
+		assert.EqualValues(t, 1, cached.Stats().NegativeHits)
+
+		uncached, err := CachedDataSource(ds, WithoutNegativeCaching())
+		assert.Nil(t, err)
+		_, _ = uncached.Get(ctx, "missing")
+		_, _ = uncached.Get(ctx, "missing")
+		assert.Len(t, ds.gets, 3)
+	})
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		ds := &failingDataSource{err: io.EOF}
+		cached, err := CachedDataSource(ds)
+		assert.Nil(t, err)
+
+		_, err = cached.Get(ctx, "a")
+		assert.Equal(t, io.EOF, err)
+		_, err = cached.Get(ctx, "a")
+		assert.Equal(t, io.EOF, err)
+		assert.Equal(t, 2, ds.calls)
+	})
+
+	t.Run("lru", func(t *testing.T) {
+		ds := newSource()
+		cached, err := CachedDataSource(ds, WithCacheSize(2))
+		assert.Nil(t, err)
+
+		for _, key := range []string{"a", "b", "a", "c", "a", "b"} {
+			_, err := cached.Get(ctx, key)
+			assert.Nil(t, err)
+		}
+		// b was least recently used when c was added
+		assert.Equal(t, []string{"a", "b", "c", "b"}, ds.gets)
+		assert.EqualValues(t, 2, cached.Stats().Evictions)
+		assert.Equal(t, 2, cached.Stats().Size)
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		var (
+			ds    = newSource()
+			clock = &fakeClock{now: time.Now()}
+		)
+		cached, err := CachedDataSource(ds, WithTTL(time.Minute), WithNegativeTTL(time.Second), withClock(clock))
+		assert.Nil(t, err)
+
+		_, _ = cached.Get(ctx, "a")
+		_, _ = cached.Get(ctx, "missing")
+		clock.Add(2 * time.Second)
+		_, _ = cached.Get(ctx, "a")       // hit
+		_, _ = cached.Get(ctx, "missing") // negative entry expired
+		clock.Add(time.Minute)
+		_, _ = cached.Get(ctx, "a") // expired
+
+		assert.Equal(t, []string{"a", "missing", "missing", "a"}, ds.gets)
+	})
+
+	t.Run("get many", func(t *testing.T) {
+		ds := newSource()
+		cached, err := CachedDataSource(ds)
+		assert.Nil(t, err)
+
+		_, _ = cached.Get(ctx, "a")
+		_, _ = cached.Get(ctx, "missing")
+
+		got, err := cached.GetMany(ctx, []string{"a", "b", "missing", "other"})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]map[string]interface{}{
+			"a": {"name": "alpha"},
+			"b": {"name": "bravo"},
+		}, got)
+		assert.Equal(t, [][]string{{"b", "other"}}, ds.batches)
+
+		// other is now cached as not found
+		_, err = cached.Get(ctx, "other")
+		assert.True(t, IsNotFound(err))
+		assert.Equal(t, []string{"a", "missing"}, ds.gets)
+	})
+
+	t.Run("get many without batch source", func(t *testing.T) {
+		ds := struct{ DataSource }{NestedMapDataSource{"a": {"name": "alpha"}}} // hides GetMany
+		cached, err := CachedDataSource(ds)
+		assert.Nil(t, err)
+
+		got, err := cached.GetMany(ctx, []string{"a", "missing"})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]map[string]interface{}{"a": {"name": "alpha"}}, got)
+
+		stats := cached.Stats()
+		assert.EqualValues(t, 0, stats.Hits)
+		assert.EqualValues(t, 2, stats.Misses)
+
+		got, err = cached.GetMany(ctx, []string{"a", "missing"})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]map[string]interface{}{"a": {"name": "alpha"}}, got)
+
+		stats = cached.Stats()
+		assert.EqualValues(t, 2, stats.Hits)
+		assert.EqualValues(t, 1, stats.NegativeHits)
+		assert.EqualValues(t, 2, stats.Misses)
+	})
+
+	t.Run("enrich", func(t *testing.T) {
+		ds := newSource()
+		cached, err := CachedDataSource(ds)
+		assert.Nil(t, err)
+
+		task := Enrich("enrich", cached, BasicKeyFunc("id"))
+		for i := 0; i < 3; i++ {
+			record := &dag.Record{}
+			record.Set("id", "a")
+			assert.Nil(t, task.Apply(ctx, record))
+		}
+		assert.Equal(t, []string{"a"}, ds.gets)
+	})
+
+	t.Run("persistence", func(t *testing.T) {
+		var (
+			path  = filepath.Join(t.TempDir(), "cache.json")
+			ds    = newSource()
+			clock = &fakeClock{now: time.Now()}
+		)
+
+		cached, err := CachedDataSource(ds, WithCacheFile(path), WithTTL(time.Hour), withClock(clock))
+		assert.Nil(t, err)
+		_, _ = cached.Get(ctx, "a")
+		_, _ = cached.Get(ctx, "missing")
+		assert.Nil(t, cached.Save())
+
+		ds = newSource()
+		warm, err := CachedDataSource(ds, WithCacheFile(path), withClock(clock))
+		assert.Nil(t, err)
+		v, err := warm.Get(ctx, "a")
+		assert.Nil(t, err)
+		assert.Equal(t, "alpha", v["name"])
+		_, err = warm.Get(ctx, "missing")
+		assert.True(t, IsNotFound(err))
+		assert.Empty(t, ds.gets)
+
+		// expired entries are not restored
+		clock.Add(2 * time.Hour)
+		expired, err := CachedDataSource(ds, WithCacheFile(path), withClock(clock))
+		assert.Nil(t, err)
+		assert.Equal(t, 0, expired.Stats().Size)
+	})
+
+	t.Run("persistence errors", func(t *testing.T) {
+		cached, err := CachedDataSource(newSource())
+		assert.Nil(t, err)
+		assert.NotNil(t, cached.Save())
+
+		path := filepath.Join(t.TempDir(), "cache.json")
+		assert.Nil(t, ioutil.WriteFile(path, []byte("not json"), 0644))
+		_, err = CachedDataSource(newSource(), WithCacheFile(path))
+		assert.NotNil(t, err)
+	})
+}
+
+func TestCachedGeocoder(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("lookup", func(t *testing.T) {
+		var calls []string
+		geocoder := geocoderFunc(func(ctx context.Context, street, city, state string) (map[string]interface{}, error) {
+			calls = append(calls, street)
+			switch street {
+			case "unknown":
+				return nil, nil
+			case "missing":
+				return nil, ErrNotFound
+			}
+			return map[string]interface{}{"street": street}, nil
+		})
+
+		cached, err := CachedGeocoder(geocoder)
+		assert.Nil(t, err)
+
+		for i := 0; i < 2; i++ {
+			v, err := cached.Lookup(ctx, "a", "", "CA")
+			assert.Nil(t, err)
+			assert.Equal(t, "a", v["street"])
+
+			v, err = cached.Lookup(ctx, "unknown", "", "CA")
+			assert.True(t, IsNotFound(err))
+			assert.Nil(t, v)
+
+			v, err = cached.Lookup(ctx, "missing", "", "CA")
+			assert.True(t, IsNotFound(err))
+			assert.Nil(t, v)
+		}
+
+		// city is part of the key
+		_, _ = cached.Lookup(ctx, "a", "x", "CA")
+
+		assert.Equal(t, []string{"a", "unknown", "missing", "a"}, calls)
+		assert.EqualValues(t, 2, cached.Stats().NegativeHits)
+	})
+
+	t.Run("lookup many", func(t *testing.T) {
+		fake := &smartyStreetsBatchTransport{}
+		cached, err := CachedGeocoder(SmartyStreetsBatch("id", "token", fake.transport()))
+		assert.Nil(t, err)
+
+		_, err = cached.LookupMany(ctx, []Address{{Street: "a", State: "CA"}, {Street: "unknown", State: "CA"}})
+		assert.Nil(t, err)
+
+		got, err := cached.LookupMany(ctx, []Address{
+			{Street: "unknown", State: "CA"},
+			{Street: "b", State: "CA"},
+			{Street: "a", State: "CA"},
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, got[0])
+		assert.Equal(t, "b", got[1]["street"])
+		assert.Equal(t, "a", got[2]["street"])
+		assert.Equal(t, []int{2, 1}, fake.sizes())
+	})
+
+	t.Run("lookup many without batch geocoder", func(t *testing.T) {
+		geocoder := geocoderFunc(func(ctx context.Context, street, city, state string) (map[string]interface{}, error) {
+			if street == "unknown" {
+				return nil, nil
+			}
+			return map[string]interface{}{"street": street}, nil
+		})
+		cached, err := CachedGeocoder(geocoder)
+		assert.Nil(t, err)
+
+		addresses := []Address{{Street: "a", State: "CA"}, {Street: "unknown", State: "CA"}}
+		got, err := cached.LookupMany(ctx, addresses)
+		assert.Nil(t, err)
+		assert.Equal(t, "a", got[0]["street"])
+		assert.Nil(t, got[1])
+
+		stats := cached.Stats()
+		assert.EqualValues(t, 0, stats.Hits)
+		assert.EqualValues(t, 2, stats.Misses)
+
+		_, err = cached.LookupMany(ctx, addresses)
+		assert.Nil(t, err)
+		stats = cached.Stats()
+		assert.EqualValues(t, 2, stats.Hits)
+		assert.EqualValues(t, 2, stats.Misses)
+	})
+
+	t.Run("persistence", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "geocode.json")
+		var calls int
+		geocoder := geocoderFunc(func(ctx context.Context, street, city, state string) (map[string]interface{}, error) {
+			calls++
+			return map[string]interface{}{"latitude": 1.5}, nil
+		})
+
+		cached, err := CachedGeocoder(geocoder, WithCacheFile(path))
+		assert.Nil(t, err)
+		_, _ = cached.Lookup(ctx, "a", "", "CA")
+		assert.Nil(t, cached.Save())
+
+		warm, err := CachedGeocoder(geocoder, WithCacheFile(path))
+		assert.Nil(t, err)
+		v, err := warm.Lookup(ctx, "a", "", "CA")
+		assert.Nil(t, err)
+		assert.Equal(t, 1.5, v["latitude"])
+		assert.Equal(t, 1, calls)
+	})
+}
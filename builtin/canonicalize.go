@@ -2,28 +2,127 @@ package builtin
 
 import (
 	"context"
+	"sort"
+	"strings"
 
 	"github.com/savaki/dag"
+	"golang.org/x/xerrors"
 )
 
-// Canonicalize the field names
-func Canonicalize(label string, mapField FieldMapperFunc) dag.Task {
+// CollisionFunc resolves the value of field when more than one field of a
+// record canonicalizes to it.  sources holds the original names of the
+// colliding fields, and values their values; a field already bearing the
+// canonical name comes first, followed by the others in sorted order
+type CollisionFunc func(field string, sources []string, values []interface{}) (interface{}, error)
+
+var (
+	// CollisionError fails the record, listing the colliding fields; the default
+	CollisionError CollisionFunc = func(field string, sources []string, values []interface{}) (interface{}, error) {
+		return nil, xerrors.Errorf("fields, %v, all canonicalize to %v", strings.Join(sources, ", "), field)
+	}
+	// CollisionKeepFirst keeps the first value that is not empty; nil, an
+	// empty string, or an empty slice or map
+	CollisionKeepFirst CollisionFunc = func(field string, sources []string, values []interface{}) (interface{}, error) {
+		for _, v := range values {
+			if !isEmpty(v) {
+				return v, nil
+			}
+		}
+		return values[0], nil
+	}
+	// CollisionList keeps every value as a []interface{}
+	CollisionList CollisionFunc = func(field string, sources []string, values []interface{}) (interface{}, error) {
+		return append([]interface{}(nil), values...), nil
+	}
+)
+
+type canonicalizeOptions struct {
+	collision CollisionFunc
+}
+
+// CanonicalizeOption provides functional options for Canonicalize
+type CanonicalizeOption func(*canonicalizeOptions)
+
+// OnCollision sets how fields that canonicalize to the same name are combined.
+// Defaults to CollisionError
+func OnCollision(fn CollisionFunc) CanonicalizeOption {
+	return func(o *canonicalizeOptions) {
+		o.collision = fn
+	}
+}
+
+// Canonicalize the field names.  Fields are renamed together, so a record is
+// either entirely canonicalized or, on error, left unchanged.  A field that
+// maps to an empty name is an error
+func Canonicalize(label string, mapField FieldMapperFunc, opts ...CanonicalizeOption) dag.Task {
+	options := canonicalizeOptions{
+		collision: CollisionError,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	return withName(label, func(ctx context.Context, record *dag.Record) error {
-		fields := record.Fields()
-		for _, field := range fields {
+		var (
+			sources = map[string][]string{} // canonical name to original names
+			targets []string
+			changed bool
+		)
+		for _, field := range record.Fields() {
 			mapped, err := mapField(field)
 			if err != nil {
 				return err
 			}
-			if field == mapped {
-				continue // no change
+			if mapped == "" {
+				return xerrors.Errorf("field, %v, canonicalizes to an empty name", field)
+			}
+			if field != mapped {
+				changed = true
+			}
+			if _, ok := sources[mapped]; !ok {
+				targets = append(targets, mapped)
+			}
+			sources[mapped] = append(sources[mapped], field)
+		}
+		if !changed {
+			return nil // no change
+		}
+
+		values := make(map[string]interface{}, len(targets))
+		for _, target := range targets {
+			names := sources[target]
+			if len(names) == 1 {
+				values[target], _ = record.Get(names[0])
+				continue
+			}
+
+			// the field already bearing the canonical name comes first
+			sort.SliceStable(names, func(i, j int) bool {
+				return names[i] == target && names[j] != target
+			})
+			collided := make([]interface{}, 0, len(names))
+			for _, name := range names {
+				v, _ := record.Get(name)
+				collided = append(collided, v)
 			}
 
-			if value, err := record.Get(field); err == nil {
-				record.Delete(field)
-				record.Set(mapped, value)
+			v, err := options.collision(target, names, collided)
+			if err != nil {
+				return err
+			}
+			values[target] = v
+		}
+
+		for _, target := range targets {
+			for _, name := range sources[target] {
+				if name != target {
+					record.Delete(name)
+				}
 			}
 		}
+		for _, target := range targets {
+			record.Set(target, values[target])
+		}
 		return nil
 	})
 }
@@ -58,3 +58,75 @@ func TestCanonicalize_Error(t *testing.T) {
 	err := task.Apply(ctx, record)
 	assert.Equal(t, want, err)
 }
+
+func TestCanonicalize_EmptyName(t *testing.T) {
+	record := &dag.Record{}
+	record.Set("name", "joe")
+	record.Set("!!!", "x")
+
+	task := Canonicalize("test", StripNonAlphanumeric)
+	err := task.Apply(context.Background(), record)
+	assert.EqualError(t, err, "field, !!!, canonicalizes to an empty name")
+	assert.Equal(t, map[string]interface{}{"name": "joe", "!!!": "x"}, record.Copy())
+}
+
+func TestCanonicalize_Collision(t *testing.T) {
+	ctx := context.Background()
+
+	newRecord := func() *dag.Record {
+		record := &dag.Record{}
+		record.Set("First Name", "")
+		record.Set("first_name", nil)
+		record.Set("firstName", "b")
+		record.Set("Last Name", "c")
+		return record
+	}
+
+	t.Run("error", func(t *testing.T) {
+		record := newRecord()
+		task := Canonicalize("test", SnakeCase)
+
+		err := task.Apply(ctx, record)
+		assert.EqualError(t, err, "fields, first_name, First Name, firstName, all canonicalize to first_name")
+		assert.Equal(t, newRecord().Copy(), record.Copy())
+	})
+
+	t.Run("keep first", func(t *testing.T) {
+		record := newRecord()
+		task := Canonicalize("test", SnakeCase, OnCollision(CollisionKeepFirst))
+
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, map[string]interface{}{"first_name": "b", "last_name": "c"}, record.Copy())
+	})
+
+	t.Run("list", func(t *testing.T) {
+		record := newRecord()
+		task := Canonicalize("test", SnakeCase, OnCollision(CollisionList))
+
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, map[string]interface{}{
+			"first_name": []interface{}{nil, "", "b"},
+			"last_name":  "c",
+		}, record.Copy())
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		record := newRecord()
+		task := Canonicalize("test", SnakeCase, OnCollision(func(field string, sources []string, values []interface{}) (interface{}, error) {
+			return len(sources), nil
+		}))
+
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, map[string]interface{}{"first_name": 3, "last_name": "c"}, record.Copy())
+	})
+
+	t.Run("swap", func(t *testing.T) {
+		record := &dag.Record{}
+		record.Set("a", 1)
+		record.Set("b", 2)
+		task := Canonicalize("test", Rename(map[string]string{"a": "b", "b": "a"}))
+
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, map[string]interface{}{"a": 2, "b": 1}, record.Copy())
+	})
+}
@@ -0,0 +1,302 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// flightFunc retrieves the values for keys in the order provided
+type flightFunc func(ctx context.Context, keys []string) ([]map[string]interface{}, error)
+
+// flight is a single invocation of a flightFunc shared by one or more calls
+type flight struct {
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// call is the pending result for a single key
+type call struct {
+	key     string
+	done    chan struct{}
+	value   map[string]interface{}
+	err     error
+	waiters int
+	flight  *flight
+}
+
+// flightGroup coalesces concurrent requests for the same key into a single
+// in-flight call.  The call runs with a context detached from the callers
+// that is cancelled only once every caller waiting on it has given up.  A key
+// that was not found has a nil value, rather than an error, so that the result
+// may be shared by callers of both single and batch lookups
+type flightGroup struct {
+	mutex sync.Mutex
+	calls map[string]*call
+}
+
+// do returns the values for keys, joining calls already in flight and passing
+// the remaining keys to fn in a single call
+func (g *flightGroup) do(ctx context.Context, keys []string, fn flightFunc) ([]map[string]interface{}, error) {
+	var (
+		calls  = make([]*call, len(keys))
+		joined = map[*call]struct{}{}
+		fresh  []*call
+		f      *flight
+		fctx   context.Context
+	)
+
+	g.mutex.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*call{}
+	}
+	for i, key := range keys {
+		c, ok := g.calls[key]
+		if !ok {
+			if f == nil {
+				var cancel context.CancelFunc
+				fctx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+				f = &flight{cancel: cancel}
+			}
+			c = &call{key: key, done: make(chan struct{}), flight: f}
+			g.calls[key] = c
+			fresh = append(fresh, c)
+		}
+		if _, ok := joined[c]; !ok {
+			joined[c] = struct{}{}
+			c.waiters++
+			c.flight.waiters++
+		}
+		calls[i] = c
+	}
+	g.mutex.Unlock()
+
+	if f != nil {
+		go g.run(fctx, f, fresh, fn)
+	}
+
+	values := make([]map[string]interface{}, len(keys))
+	for i, c := range calls {
+		select {
+		case <-c.done:
+			if c.err != nil {
+				g.leave(joined)
+				return nil, c.err
+			}
+			values[i] = c.value
+		case <-ctx.Done():
+			g.leave(joined)
+			return nil, ctx.Err()
+		}
+	}
+	return values, nil
+}
+
+// leave removes the caller from each of the calls, cancelling any flight that
+// no longer has callers waiting
+func (g *flightGroup) leave(calls map[*call]struct{}) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for c := range calls {
+		c.waiters--
+		c.flight.waiters--
+		if c.waiters == 0 && g.calls[c.key] == c {
+			delete(g.calls, c.key)
+		}
+		if c.flight.waiters == 0 {
+			c.flight.cancel()
+		}
+	}
+}
+
+func (g *flightGroup) run(ctx context.Context, f *flight, calls []*call, fn flightFunc) {
+	defer f.cancel()
+
+	keys := make([]string, 0, len(calls))
+	for _, c := range calls {
+		keys = append(keys, c.key)
+	}
+
+	values, err := safeFlight(ctx, keys, fn)
+	if err == nil && len(values) != len(keys) {
+		err = xerrors.Errorf("received %v results for %v keys", len(values), len(keys))
+	}
+
+	g.mutex.Lock()
+	for i, c := range calls {
+		if g.calls[c.key] == c {
+			delete(g.calls, c.key)
+		}
+		if err != nil {
+			c.err = err
+		} else {
+			c.value = values[i]
+		}
+	}
+	g.mutex.Unlock()
+
+	for _, c := range calls {
+		close(c.done)
+	}
+}
+
+// safeFlight calls fn returning any panic as an error; fn runs on its own
+// goroutine where a panic would otherwise bypass the caller's recovery
+func safeFlight(ctx context.Context, keys []string, fn flightFunc) (values []map[string]interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx, keys)
+}
+
+type coalescedDataSource struct {
+	ds    DataSource
+	group flightGroup
+}
+
+// CoalescedDataSource returns a DataSource that shares a single in-flight call
+// to ds between concurrent requests for the same key.  Each caller waits
+// subject to its own context; the underlying call is cancelled only once every
+// caller waiting on it has given up.  Callers share the returned records and
+// must not modify them.
+//
+// Combined with CachedDataSource, coalescing belongs beneath the cache e.g.
+// CachedDataSource(CoalescedDataSource(ds))
+func CoalescedDataSource(ds DataSource) BatchDataSource {
+	return &coalescedDataSource{ds: ds}
+}
+
+// Get implements DataSource
+func (c *coalescedDataSource) Get(ctx context.Context, key string) (map[string]interface{}, error) {
+	values, err := c.group.do(ctx, []string{key}, func(ctx context.Context, keys []string) ([]map[string]interface{}, error) {
+		v, err := c.ds.Get(ctx, keys[0])
+		if err != nil && !IsNotFound(err) {
+			return nil, err
+		}
+		return []map[string]interface{}{v}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if values[0] == nil {
+		return nil, &notFoundError{key: key}
+	}
+	return values[0], nil
+}
+
+// GetMany implements BatchDataSource.  Keys not already in flight are
+// retrieved with a single call to GetMany if the underlying DataSource
+// supports it and with Get otherwise
+func (c *coalescedDataSource) GetMany(ctx context.Context, keys []string) (map[string]map[string]interface{}, error) {
+	values, err := c.group.do(ctx, keys, c.getMany)
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]map[string]interface{}{}
+	for i, v := range values {
+		if v != nil {
+			found[keys[i]] = v
+		}
+	}
+	return found, nil
+}
+
+func (c *coalescedDataSource) getMany(ctx context.Context, keys []string) ([]map[string]interface{}, error) {
+	values := make([]map[string]interface{}, len(keys))
+
+	batch, ok := c.ds.(BatchDataSource)
+	if !ok {
+		for i, key := range keys {
+			v, err := c.ds.Get(ctx, key)
+			if err != nil && !IsNotFound(err) {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	}
+
+	found, err := batch.GetMany(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		values[i] = found[key]
+	}
+	return values, nil
+}
+
+type coalescedGeocoder struct {
+	geocoder Geocoder
+	group    flightGroup
+}
+
+// CoalescedGeocoder returns a Geocoder that shares a single in-flight lookup
+// between concurrent requests for the same address.  Cancellation behaves as
+// for CoalescedDataSource.  Addresses the geocoder could not find, a nil result
+// or an error wrapping ErrNotFound, are reported by Lookup with an error that
+// wraps ErrNotFound and by LookupMany as a nil result
+func CoalescedGeocoder(geocoder Geocoder) BatchGeocoder {
+	return &coalescedGeocoder{geocoder: geocoder}
+}
+
+// Lookup implements Geocoder
+func (c *coalescedGeocoder) Lookup(ctx context.Context, street, city, state string) (map[string]interface{}, error) {
+	address := Address{Street: street, City: city, State: state}
+	values, err := c.group.do(ctx, []string{addressKey(address)}, func(ctx context.Context, keys []string) ([]map[string]interface{}, error) {
+		v, err := c.geocoder.Lookup(ctx, street, city, state)
+		if err != nil && !IsNotFound(err) {
+			return nil, err
+		}
+		return []map[string]interface{}{v}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if values[0] == nil {
+		return nil, &addressNotFoundError{address: address}
+	}
+	return values[0], nil
+}
+
+// LookupMany implements BatchGeocoder.  Addresses not already in flight are
+// geocoded with a single call to LookupMany if the underlying Geocoder
+// supports it and with Lookup otherwise
+func (c *coalescedGeocoder) LookupMany(ctx context.Context, addresses []Address) ([]map[string]interface{}, error) {
+	var (
+		keys      = make([]string, 0, len(addresses))
+		byAddress = map[string]Address{}
+	)
+	for _, address := range addresses {
+		key := addressKey(address)
+		keys = append(keys, key)
+		byAddress[key] = address
+	}
+
+	return c.group.do(ctx, keys, func(ctx context.Context, keys []string) ([]map[string]interface{}, error) {
+		misses := make([]Address, 0, len(keys))
+		for _, key := range keys {
+			misses = append(misses, byAddress[key])
+		}
+
+		if batch, ok := c.geocoder.(BatchGeocoder); ok {
+			return batch.LookupMany(ctx, misses)
+		}
+
+		values := make([]map[string]interface{}, len(misses))
+		for i, address := range misses {
+			v, err := c.geocoder.Lookup(ctx, address.Street, address.City, address.State)
+			if err != nil && !IsNotFound(err) {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	})
+}
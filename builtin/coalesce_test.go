@@ -0,0 +1,409 @@
+package builtin
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tj/assert"
+)
+
+// blockingDataSource holds each call until released and records the keys
+// requested along with how each call finished
+type blockingDataSource struct {
+	release chan struct{}
+	started chan []string
+	exited  chan error
+
+	mutex sync.Mutex
+	calls [][]string
+}
+
+func newBlockingDataSource() *blockingDataSource {
+	return &blockingDataSource{
+		release: make(chan struct{}),
+		started: make(chan []string, 100),
+		exited:  make(chan error, 100),
+	}
+}
+
+func (b *blockingDataSource) wait(ctx context.Context, keys []string) error {
+	b.mutex.Lock()
+	b.calls = append(b.calls, keys)
+	b.mutex.Unlock()
+	b.started <- keys
+
+	select {
+	case <-b.release:
+		b.exited <- nil
+		return nil
+	case <-ctx.Done():
+		b.exited <- ctx.Err()
+		return ctx.Err()
+	}
+}
+
+func (b *blockingDataSource) Get(ctx context.Context, key string) (map[string]interface{}, error) {
+	if err := b.wait(ctx, []string{key}); err != nil {
+		return nil, err
+	}
+	if key == "missing" {
+		return nil, &notFoundError{key: key}
+	}
+	return map[string]interface{}{"key": key}, nil
+}
+
+func (b *blockingDataSource) GetMany(ctx context.Context, keys []string) (map[string]map[string]interface{}, error) {
+	if err := b.wait(ctx, keys); err != nil {
+		return nil, err
+	}
+	found := map[string]map[string]interface{}{}
+	for _, key := range keys {
+		if key != "missing" {
+			found[key] = map[string]interface{}{"key": key}
+		}
+	}
+	return found, nil
+}
+
+func (b *blockingDataSource) callCount() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.calls)
+}
+
+func TestCoalescedDataSource(t *testing.T) {
+	t.Run("concurrent gets share a call", func(t *testing.T) {
+		var (
+			ctx = context.Background()
+			ds  = newBlockingDataSource()
+			c   = CoalescedDataSource(ds)
+			wg  sync.WaitGroup
+			n   = 50
+		)
+
+		results := make(chan map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				v, err := c.Get(ctx, "a")
+				assert.Nil(t, err)
+				results <- v
+			}()
+		}
+
+		<-ds.started
+		time.Sleep(20 * time.Millisecond) // allow the remaining callers to join
+		close(ds.release)
+		wg.Wait()
+		close(results)
+
+		for v := range results {
+			assert.Equal(t, "a", v["key"])
+		}
+		assert.Equal(t, 1, ds.callCount())
+
+		// once complete, the next request makes a new call
+		_, err := c.Get(ctx, "a")
+		assert.Nil(t, err)
+		assert.Equal(t, 2, ds.callCount())
+	})
+
+	t.Run("cancelled caller", func(t *testing.T) {
+		var (
+			ds            = newBlockingDataSource()
+			c             = CoalescedDataSource(ds)
+			cctx, cancel  = context.WithCancel(context.Background())
+			first, second = make(chan error, 1), make(chan error, 1)
+			secondStarted = make(chan struct{})
+		)
+		defer cancel()
+
+		go func() {
+			_, err := c.Get(cctx, "a")
+			first <- err
+		}()
+		<-ds.started
+
+		go func() {
+			close(secondStarted)
+			v, err := c.Get(context.Background(), "a")
+			if err == nil && v["key"] != "a" {
+				err = io.ErrUnexpectedEOF
+			}
+			second <- err
+		}()
+		<-secondStarted
+		time.Sleep(20 * time.Millisecond)
+
+		cancel()
+		assert.Equal(t, context.Canceled, <-first)
+
+		// the call continues for the remaining caller
+		close(ds.release)
+		assert.Nil(t, <-second)
+		assert.Nil(t, <-ds.exited)
+		assert.Equal(t, 1, ds.callCount())
+	})
+
+	t.Run("all callers cancelled", func(t *testing.T) {
+		var (
+			ds           = newBlockingDataSource()
+			c            = CoalescedDataSource(ds)
+			cctx, cancel = context.WithCancel(context.Background())
+		)
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := c.Get(cctx, "a")
+			done <- err
+		}()
+		<-ds.started
+
+		cancel()
+		assert.Equal(t, context.Canceled, <-done)
+		assert.Equal(t, context.Canceled, <-ds.exited)
+
+		// a new request is not joined to the cancelled call
+		close(ds.release)
+		v, err := c.Get(context.Background(), "a")
+		assert.Nil(t, err)
+		assert.Equal(t, "a", v["key"])
+		assert.Equal(t, 2, ds.callCount())
+	})
+
+	t.Run("errors are shared", func(t *testing.T) {
+		var (
+			ctx = context.Background()
+			ds  = newBlockingDataSource()
+			c   = CoalescedDataSource(ds)
+			wg  sync.WaitGroup
+		)
+
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := c.Get(ctx, "missing")
+				assert.True(t, IsNotFound(err))
+			}()
+		}
+		<-ds.started
+		time.Sleep(20 * time.Millisecond)
+		close(ds.release)
+		wg.Wait()
+		assert.Equal(t, 1, ds.callCount())
+	})
+
+	t.Run("get many", func(t *testing.T) {
+		var (
+			ctx = context.Background()
+			ds  = newBlockingDataSource()
+			c   = CoalescedDataSource(ds)
+		)
+
+		single := make(chan error, 1)
+		go func() {
+			_, err := c.Get(ctx, "a")
+			single <- err
+		}()
+		<-ds.started
+
+		many := make(chan map[string]map[string]interface{}, 1)
+		go func() {
+			found, err := c.GetMany(ctx, []string{"a", "b", "missing", "b"})
+			assert.Nil(t, err)
+			many <- found
+		}()
+		assert.Equal(t, []string{"b", "missing"}, <-ds.started)
+
+		close(ds.release)
+		assert.Nil(t, <-single)
+		assert.Equal(t, map[string]map[string]interface{}{
+			"a": {"key": "a"},
+			"b": {"key": "b"},
+		}, <-many)
+	})
+
+	t.Run("get joins get many for missing key", func(t *testing.T) {
+		var (
+			ctx = context.Background()
+			ds  = newBlockingDataSource()
+			c   = CoalescedDataSource(ds)
+		)
+
+		many := make(chan error, 1)
+		go func() {
+			found, err := c.GetMany(ctx, []string{"missing"})
+			if err == nil && len(found) != 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			many <- err
+		}()
+		<-ds.started
+
+		single := make(chan error, 1)
+		go func() {
+			v, err := c.Get(ctx, "missing")
+			if err == nil && v == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			single <- err
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		close(ds.release)
+		assert.True(t, IsNotFound(<-single))
+		assert.Nil(t, <-many)
+		assert.Equal(t, 1, ds.callCount())
+	})
+
+	t.Run("get many joins get for missing key", func(t *testing.T) {
+		var (
+			ctx = context.Background()
+			ds  = newBlockingDataSource()
+			c   = CoalescedDataSource(ds)
+		)
+
+		single := make(chan error, 1)
+		go func() {
+			_, err := c.Get(ctx, "missing")
+			single <- err
+		}()
+		<-ds.started
+
+		type result struct {
+			found map[string]map[string]interface{}
+			err   error
+		}
+		many := make(chan result, 1)
+		go func() {
+			found, err := c.GetMany(ctx, []string{"missing", "a"})
+			many <- result{found: found, err: err}
+		}()
+		assert.Equal(t, []string{"a"}, <-ds.started)
+
+		close(ds.release)
+		assert.True(t, IsNotFound(<-single))
+		got := <-many
+		assert.Nil(t, got.err)
+		assert.Equal(t, map[string]map[string]interface{}{"a": {"key": "a"}}, got.found)
+	})
+
+	t.Run("get many without batch source", func(t *testing.T) {
+		ds := struct{ DataSource }{NestedMapDataSource{"a": {"name": "alpha"}}} // hides GetMany
+		c := CoalescedDataSource(ds)
+
+		found, err := c.GetMany(context.Background(), []string{"a", "missing"})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]map[string]interface{}{"a": {"name": "alpha"}}, found)
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		c := CoalescedDataSource(panicDataSource{})
+		_, err := c.Get(context.Background(), "a")
+		assert.EqualError(t, err, "panic: boom")
+	})
+}
+
+type panicDataSource struct{}
+
+func (panicDataSource) Get(ctx context.Context, key string) (map[string]interface{}, error) {
+	panic("boom")
+}
+
+func TestCoalescedGeocoder(t *testing.T) {
+	t.Run("lookup", func(t *testing.T) {
+		var (
+			ctx     = context.Background()
+			release = make(chan struct{})
+			started = make(chan struct{}, 10)
+			mutex   sync.Mutex
+			calls   int
+			wg      sync.WaitGroup
+		)
+		geocoder := geocoderFunc(func(ctx context.Context, street, city, state string) (map[string]interface{}, error) {
+			mutex.Lock()
+			calls++
+			mutex.Unlock()
+			started <- struct{}{}
+			<-release
+			return map[string]interface{}{"street": street}, nil
+		})
+		c := CoalescedGeocoder(geocoder)
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				v, err := c.Lookup(ctx, "a", "b", "CA")
+				assert.Nil(t, err)
+				assert.Equal(t, "a", v["street"])
+			}()
+		}
+		<-started
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("lookup many joins lookup for missing address", func(t *testing.T) {
+		var (
+			ctx     = context.Background()
+			release = make(chan struct{})
+			started = make(chan struct{}, 10)
+		)
+		geocoder := geocoderFunc(func(ctx context.Context, street, city, state string) (map[string]interface{}, error) {
+			started <- struct{}{}
+			<-release
+			return nil, &notFoundError{key: street}
+		})
+		c := CoalescedGeocoder(geocoder)
+
+		type result struct {
+			values []map[string]interface{}
+			err    error
+		}
+		single := make(chan result, 1)
+		go func() {
+			v, err := c.Lookup(ctx, "unknown", "", "CA")
+			single <- result{values: []map[string]interface{}{v}, err: err}
+		}()
+		<-started
+
+		many := make(chan result, 1)
+		go func() {
+			values, err := c.LookupMany(ctx, []Address{{Street: "unknown", State: "CA"}})
+			many <- result{values: values, err: err}
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		close(release)
+		got := <-single
+		assert.True(t, IsNotFound(got.err))
+		got = <-many
+		assert.Nil(t, got.err)
+		assert.Equal(t, []map[string]interface{}{nil}, got.values)
+	})
+
+	t.Run("lookup many", func(t *testing.T) {
+		fake := &smartyStreetsBatchTransport{}
+		c := CoalescedGeocoder(SmartyStreetsBatch("id", "token", fake.transport()))
+
+		got, err := c.LookupMany(context.Background(), []Address{
+			{Street: "a", State: "CA"},
+			{Street: "unknown", State: "CA"},
+			{Street: "a", State: "CA"},
+		})
+		assert.Nil(t, err)
+		assert.Len(t, got, 3)
+		assert.Equal(t, "a", got[0]["street"])
+		assert.Nil(t, got[1])
+		assert.Equal(t, "a", got[2]["street"])
+		assert.Equal(t, []int{2}, fake.sizes())
+	})
+}
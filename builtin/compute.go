@@ -0,0 +1,27 @@
+package builtin
+
+import (
+	"context"
+
+	"github.com/savaki/dag"
+	"github.com/savaki/dag/expr"
+)
+
+// Compute sets field to the result of the expression; see package expr for the
+// syntax and expr.MustCompile.  A null result removes the field
+func Compute(label, field string, e *expr.Expression) dag.Task {
+	return withName(label, func(ctx context.Context, record *dag.Record) error {
+		v, err := e.Eval(record)
+		if err != nil {
+			return err
+		}
+
+		if v == nil {
+			record.Delete(field)
+			return nil
+		}
+
+		record.Set(field, v)
+		return nil
+	})
+}
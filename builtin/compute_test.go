@@ -0,0 +1,63 @@
+package builtin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/savaki/dag"
+	"github.com/savaki/dag/expr"
+	"github.com/tj/assert"
+)
+
+func TestCompute(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ok", func(t *testing.T) {
+		task := Compute("full-name", "full_name", expr.MustCompile(`first + " " + last`))
+		assert.Equal(t, "full-name", dag.Name(task))
+
+		record := &dag.Record{}
+		record.Set("first", "Joe")
+		record.Set("last", "Public")
+		err := task.Apply(ctx, record)
+		assert.Nil(t, err)
+
+		got, err := record.String("full_name")
+		assert.Nil(t, err)
+		assert.Equal(t, "Joe Public", got)
+	})
+
+	t.Run("serial", func(t *testing.T) {
+		task := dag.Serial(
+			Compute("total", "total", expr.MustCompile("price * quantity")),
+			Compute("discounted", "discounted", expr.MustCompile("total / 2")),
+		)
+
+		record := &dag.Record{}
+		record.Set("price", 2)
+		record.Set("quantity", 3)
+		err := task.Apply(ctx, record)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{"price": 2, "quantity": 3, "total": int64(6), "discounted": 3.0}, record.Copy())
+	})
+
+	t.Run("null", func(t *testing.T) {
+		task := Compute("total", "total", expr.MustCompile("price * quantity"))
+
+		record := &dag.Record{}
+		record.Set("total", 1)
+		record.Set("price", 1.5)
+		err := task.Apply(ctx, record)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{"price": 1.5}, record.Copy())
+	})
+
+	t.Run("eval error", func(t *testing.T) {
+		task := Compute("total", "total", expr.MustCompile("price * 2"))
+
+		record := &dag.Record{}
+		record.Set("price", true)
+		err := task.Apply(ctx, record)
+		assert.NotNil(t, err)
+	})
+}
@@ -4,37 +4,197 @@ import (
 	"context"
 
 	"github.com/savaki/dag"
+	"golang.org/x/xerrors"
 )
 
-// Enrich a record from the specified data source
+// Enrich a record from the specified data source.  Enrich implements
+// dag.BatchTask; when ds is a BatchDataSource, the keys of a batch are
+// resolved with a single call to GetMany.
+//
+// By default, enrichment values overwrite existing fields and a key that is not
+// found fails the record; see WithMerge, SkipNotFound, WithDefaults and
+// WithRequired.  WithTarget and WithTargetList nest the enrichment beneath a
+// single field rather than setting fields on the record
 func Enrich(label string, ds DataSource, keyFunc KeyFunc, opts ...Option) dag.Task {
-	options := makeOptions(opts...)
+	return dag.WithName(label, &enrich{
+		ds:      ds,
+		keyFunc: keyFunc,
+		options: makeOptions(opts...),
+	})
+}
+
+type enrich struct {
+	ds      DataSource
+	keyFunc KeyFunc
+	options options
+}
+
+// Apply implements dag.Task
+func (e *enrich) Apply(ctx context.Context, record *dag.Record) error {
+	key, err := e.keyFunc(record)
+	if err != nil {
+		return err
+	}
+
+	if multi, ok := e.ds.(MultiDataSource); ok && e.options.targetList {
+		rows, err := multi.GetAll(ctx, key)
+		return e.apply(record, key, rows, err)
+	}
 
-	return withName(label, func(ctx context.Context, record *dag.Record) error {
-		key, err := keyFunc(record)
+	that, err := e.ds.Get(ctx, key)
+	return e.apply(record, key, []map[string]interface{}{that}, err)
+}
+
+// ApplyBatch implements dag.BatchTask.  Keys not returned by GetMany are not
+// found; Get is used only when the data source is not a BatchDataSource
+func (e *enrich) ApplyBatch(ctx context.Context, records []*dag.Record) error {
+	_, multi := e.ds.(MultiDataSource)
+	batch, ok := e.ds.(BatchDataSource)
+	if !ok || (multi && e.options.targetList) {
+		errs := make([]error, len(records))
+		for i, record := range records {
+			errs[i] = e.Apply(ctx, record)
+		}
+		return batchError(errs)
+	}
+
+	var (
+		errs   = make([]error, len(records))
+		keys   = make([]string, len(records))
+		unique []string
+		seen   = map[string]struct{}{}
+	)
+	for i, record := range records {
+		key, err := e.keyFunc(record)
 		if err != nil {
-			return err
+			errs[i] = err
+			continue
 		}
+		keys[i] = key
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			unique = append(unique, key)
+		}
+	}
 
-		that, err := ds.Get(ctx, key)
+	var found map[string]map[string]interface{}
+	if len(unique) > 0 {
+		v, err := batch.GetMany(ctx, unique)
 		if err != nil {
+			// records whose key could not be determined keep their own error
+			for i := range errs {
+				if errs[i] == nil {
+					errs[i] = err
+				}
+			}
+			return batchError(errs)
+		}
+		found = v
+	}
+
+	for i, record := range records {
+		if errs[i] != nil {
+			continue
+		}
+
+		var err error
+		that, ok := found[keys[i]]
+		if !ok {
+			err = &notFoundError{key: keys[i]}
+		}
+		errs[i] = e.apply(record, keys[i], []map[string]interface{}{that}, err)
+	}
+
+	return batchError(errs)
+}
+
+// apply enriches the record with the rows found for key
+func (e *enrich) apply(record *dag.Record, key string, rows []map[string]interface{}, err error) error {
+	if err != nil {
+		if !IsNotFound(err) {
+			return err
+		}
+		switch {
+		case e.options.defaults != nil:
+			return e.merge(record, []map[string]interface{}{e.options.defaults})
+		case e.options.skip:
+			return nil
+		default:
 			return err
 		}
+	}
 
-		if len(options.fields) == 0 {
-			for k := range that {
-				options.fields = append(options.fields, k)
+	for _, row := range rows {
+		for _, field := range e.options.required {
+			if v, ok := row[field]; !ok || v == nil {
+				return xerrors.Errorf("key, %v, is missing required field, %v", key, field)
 			}
 		}
+	}
 
-		for _, field := range options.fields {
-			if v, ok := that[field]; ok {
-				if mapped, err := options.mapField(field); err == nil {
-					record.Set(mapped, v)
-				}
-			}
+	return e.merge(record, rows)
+}
+
+// project returns the selected fields of row under their mapped names
+func (e *enrich) project(row map[string]interface{}) map[string]interface{} {
+	fields := e.options.fields
+	if len(fields) == 0 {
+		fields = make([]string, 0, len(row))
+		for k := range row {
+			fields = append(fields, k)
 		}
+	}
 
-		return nil
-	})
+	projected := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		v, ok := row[field]
+		if !ok {
+			continue
+		}
+		mapped, err := e.options.mapField(field)
+		if err != nil {
+			continue
+		}
+		projected[mapped] = v
+	}
+	return projected
+}
+
+// merge sets the rows onto the record; as fields of the record, or beneath the
+// target when one is configured.  Values are resolved before any are set so
+// that a failed merge leaves the record unchanged.  merge must not modify e as
+// it is called concurrently
+func (e *enrich) merge(record *dag.Record, rows []map[string]interface{}) error {
+	values := map[string]interface{}{}
+	switch {
+	case e.options.target == "":
+		if len(rows) > 0 {
+			values = e.project(rows[0])
+		}
+	case e.options.targetList:
+		items := make([]map[string]interface{}, 0, len(rows))
+		for _, row := range rows {
+			items = append(items, e.project(row))
+		}
+		values[e.options.target] = items
+	default:
+		if len(rows) > 0 {
+			values[e.options.target] = e.project(rows[0])
+		}
+	}
+
+	for field, v := range values {
+		current, err := record.Get(field)
+		if err != nil {
+			continue
+		}
+		if values[field], err = e.options.merge(field, current, v); err != nil {
+			return xerrors.Errorf("unable to merge field, %v: %w", field, err)
+		}
+	}
+
+	for field, v := range values {
+		record.Set(field, v)
+	}
+	return nil
 }
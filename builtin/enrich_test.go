@@ -2,10 +2,15 @@ package builtin
 
 import (
 	"context"
+	"io"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/savaki/dag"
 	"github.com/tj/assert"
+	"golang.org/x/xerrors"
 )
 
 // staticKey always returns the same value.  useful for just testing
@@ -69,3 +74,481 @@ func TestEnrich(t *testing.T) {
 		assert.Equal(t, want, record.Copy())
 	})
 }
+
+// countingDataSource records the calls made to the underlying data source
+type countingDataSource struct {
+	NestedMapDataSource
+	mutex   sync.Mutex
+	gets    []string
+	batches [][]string
+	err     error
+}
+
+func (c *countingDataSource) Get(ctx context.Context, key string) (map[string]interface{}, error) {
+	c.mutex.Lock()
+	c.gets = append(c.gets, key)
+	c.mutex.Unlock()
+	return c.NestedMapDataSource.Get(ctx, key)
+}
+
+func (c *countingDataSource) GetMany(ctx context.Context, keys []string) (map[string]map[string]interface{}, error) {
+	c.mutex.Lock()
+	c.batches = append(c.batches, keys)
+	c.mutex.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.NestedMapDataSource.GetMany(ctx, keys)
+}
+
+func TestEnrich_ApplyBatch(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		keyFunc = BasicKeyFunc("id")
+	)
+
+	newRecords := func(ids ...string) []*dag.Record {
+		var records []*dag.Record
+		for _, id := range ids {
+			record := &dag.Record{}
+			if id != "" {
+				record.Set("id", id)
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+
+	t.Run("batch", func(t *testing.T) {
+		ds := &countingDataSource{NestedMapDataSource: NestedMapDataSource{
+			"a": {"name": "alpha"},
+			"b": {"name": "bravo"},
+		}}
+		task, ok := Enrich("test", ds, keyFunc).(dag.BatchTask)
+		assert.True(t, ok)
+
+		records := newRecords("a", "b", "a", "", "missing")
+		err := task.ApplyBatch(ctx, records)
+
+		var be *dag.BatchError
+		assert.True(t, xerrors.As(err, &be))
+		assert.Nil(t, be.Errs[0])
+		assert.Nil(t, be.Errs[1])
+		assert.Nil(t, be.Errs[2])
+		assert.True(t, dag.IsFieldNotFoundError(be.Errs[3]))
+		assert.EqualError(t, be.Errs[4], "key, missing, not found")
+
+		assert.Equal(t, [][]string{{"a", "b", "missing"}}, ds.batches)
+		assert.Empty(t, ds.gets) // keys not returned are not found
+
+		name, _ := records[2].String("name")
+		assert.Equal(t, "alpha", name)
+	})
+
+	t.Run("get many error", func(t *testing.T) {
+		ds := &countingDataSource{err: io.EOF}
+		task := Enrich("test", ds, keyFunc).(dag.BatchTask)
+		err := task.ApplyBatch(ctx, newRecords("a", "", "b"))
+
+		// the record without a key keeps its own error
+		var be *dag.BatchError
+		assert.True(t, xerrors.As(err, &be))
+		assert.Len(t, be.Errs, 3)
+		assert.Equal(t, io.EOF, be.Errs[0])
+		assert.True(t, dag.IsFieldNotFoundError(be.Errs[1]))
+		assert.Equal(t, io.EOF, be.Errs[2])
+	})
+
+	t.Run("falls back to get", func(t *testing.T) {
+		ds := MapDataSource{"name": "alpha"}
+		task := Enrich("test", ds, keyFunc).(dag.BatchTask)
+
+		records := newRecords("a", "b")
+		err := task.ApplyBatch(ctx, records)
+		assert.Nil(t, err)
+		for _, record := range records {
+			name, _ := record.String("name")
+			assert.Equal(t, "alpha", name)
+		}
+	})
+
+	t.Run("runner", func(t *testing.T) {
+		ds := &countingDataSource{NestedMapDataSource: NestedMapDataSource{
+			"a": {"name": "alpha"},
+			"b": {"name": "bravo"},
+		}}
+		task := dag.Serial(Delete("delete", "ignored"), Enrich("test", ds, keyFunc))
+
+		in := make(chan *dag.Record, 4)
+		for _, record := range newRecords("a", "b", "a", "b") {
+			in <- record
+		}
+		close(in)
+
+		runner := dag.NewRunner(task, dag.WithBatch(4, 0), dag.WithWorkers(1))
+		for result := range runner.Run(ctx, in) {
+			assert.Nil(t, result.Err)
+		}
+		assert.Equal(t, [][]string{{"a", "b"}}, ds.batches)
+		assert.Empty(t, ds.gets)
+	})
+}
+
+func TestEnrich_Merge(t *testing.T) {
+	ctx := context.Background()
+	ds := MapDataSource{"a": "alpha", "b": "bravo", "c": "charlie", "d": "delta"}
+
+	newRecord := func() *dag.Record {
+		record := &dag.Record{}
+		record.Set("a", "existing")
+		record.Set("b", "")
+		record.Set("c", nil)
+		return record
+	}
+
+	testCases := map[string]struct {
+		merge MergeFunc
+		want  map[string]interface{}
+	}{
+		"overwrite": {
+			merge: MergeOverwrite,
+			want:  map[string]interface{}{"a": "alpha", "b": "bravo", "c": "charlie", "d": "delta"},
+		},
+		"if absent": {
+			merge: MergeIfAbsent,
+			want:  map[string]interface{}{"a": "existing", "b": "", "c": nil, "d": "delta"},
+		},
+		"if empty": {
+			merge: MergeIfEmpty,
+			want:  map[string]interface{}{"a": "existing", "b": "bravo", "c": "charlie", "d": "delta"},
+		},
+		"custom": {
+			merge: func(field string, current, incoming interface{}) (interface{}, error) {
+				return field + ":" + toString(current) + "/" + toString(incoming), nil
+			},
+			want: map[string]interface{}{"a": "a:existing/alpha", "b": "b:/bravo", "c": "c:<nil>/charlie", "d": "delta"},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			record := newRecord()
+			task := Enrich("test", ds, staticKey, WithFields("a", "b", "c", "d"), WithMerge(tc.merge))
+			assert.Nil(t, task.Apply(ctx, record))
+			assert.Equal(t, tc.want, record.Copy())
+		})
+	}
+
+	t.Run("mapped field", func(t *testing.T) {
+		record := &dag.Record{}
+		record.Set("x_a", "existing")
+
+		task := Enrich("test", ds, staticKey, WithFields("a", "b"), WithPrefix("x_"), WithMerge(MergeIfAbsent))
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, map[string]interface{}{"x_a": "existing", "x_b": "bravo"}, record.Copy())
+	})
+
+	t.Run("error leaves record unchanged", func(t *testing.T) {
+		record := newRecord()
+		task := Enrich("test", ds, staticKey, WithFields("a", "b", "c", "d"),
+			WithMerge(func(field string, current, incoming interface{}) (interface{}, error) {
+				if field == "c" {
+					return nil, io.ErrUnexpectedEOF
+				}
+				return incoming, nil
+			}),
+		)
+
+		err := task.Apply(ctx, record)
+		assert.True(t, xerrors.Is(err, io.ErrUnexpectedEOF))
+		assert.Equal(t, newRecord().Copy(), record.Copy())
+	})
+}
+
+func TestEnrich_NotFound(t *testing.T) {
+	var (
+		ctx = context.Background()
+		ds  = NestedMapDataSource{"a": {"name": "alpha"}}
+	)
+
+	newRecord := func(id string) *dag.Record {
+		record := &dag.Record{}
+		record.Set("id", id)
+		return record
+	}
+
+	t.Run("error", func(t *testing.T) {
+		task := Enrich("test", ds, BasicKeyFunc("id"))
+		err := task.Apply(ctx, newRecord("missing"))
+		assert.True(t, IsNotFound(err))
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		record := newRecord("missing")
+		task := Enrich("test", ds, BasicKeyFunc("id"), SkipNotFound())
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, map[string]interface{}{"id": "missing"}, record.Copy())
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		record := newRecord("missing")
+		task := Enrich("test", ds, BasicKeyFunc("id"), WithFields("name"), WithDefaults(map[string]interface{}{"name": "unknown"}))
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, map[string]interface{}{"id": "missing", "name": "unknown"}, record.Copy())
+	})
+
+	t.Run("other errors fail", func(t *testing.T) {
+		task := Enrich("test", &failingDataSource{err: io.EOF}, BasicKeyFunc("id"), SkipNotFound())
+		assert.Equal(t, io.EOF, task.Apply(ctx, newRecord("a")))
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		source := &countingDataSource{NestedMapDataSource: ds}
+		task := Enrich("test", source, BasicKeyFunc("id"), WithFields("name"),
+			WithDefaults(map[string]interface{}{"name": "unknown"}),
+		).(dag.BatchTask)
+
+		records := []*dag.Record{newRecord("a"), newRecord("missing")}
+		assert.Nil(t, task.ApplyBatch(ctx, records))
+		assert.Equal(t, "alpha", records[0].Copy()["name"])
+		assert.Equal(t, "unknown", records[1].Copy()["name"])
+	})
+}
+
+func TestEnrich_Required(t *testing.T) {
+	var (
+		ctx = context.Background()
+		ds  = NestedMapDataSource{
+			"a": {"name": "alpha", "age": 21},
+			"b": {"name": "bravo", "age": nil},
+			"c": {"name": "charlie"},
+		}
+		task = Enrich("test", ds, BasicKeyFunc("id"), WithFields("name", "age"), WithRequired("age"))
+	)
+
+	for id, ok := range map[string]bool{"a": true, "b": false, "c": false} {
+		record := &dag.Record{}
+		record.Set("id", id)
+
+		err := task.Apply(ctx, record)
+		if ok {
+			assert.Nil(t, err)
+			assert.Equal(t, "alpha", record.Copy()["name"])
+			continue
+		}
+		assert.EqualError(t, err, "key, "+id+", is missing required field, age")
+		assert.Equal(t, map[string]interface{}{"id": id}, record.Copy())
+	}
+}
+
+func TestEnrich_Concurrent(t *testing.T) {
+	var (
+		ctx = context.Background()
+		ds  = NestedMapDataSource{}
+		n   = 200
+	)
+	for i := 0; i < n; i++ {
+		key := strconv.Itoa(i)
+		ds[key] = map[string]interface{}{"field_" + key: key}
+	}
+
+	newRecord := func(i int) *dag.Record {
+		record := dag.NewRecord(dag.Meta{ID: strconv.Itoa(i)})
+		record.Set("id", strconv.Itoa(i))
+		return record
+	}
+
+	// want verifies the record holds only the fields of its own key
+	want := func(t *testing.T, record *dag.Record) {
+		id, err := record.String("id")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{"id": id, "field_" + id: id}, record.Copy())
+	}
+
+	t.Run("sequential records keep their own fields", func(t *testing.T) {
+		task := Enrich("test", ds, BasicKeyFunc("id"))
+		for i := 0; i < 3; i++ {
+			record := newRecord(i)
+			assert.Nil(t, task.Apply(ctx, record))
+			want(t, record)
+		}
+	})
+
+	t.Run("parallel", func(t *testing.T) {
+		var (
+			enrich = Enrich("test", ds, BasicKeyFunc("id"))
+			task   = dag.Parallel(enrich, enrich, enrich, enrich)
+			wg     sync.WaitGroup
+		)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				record := newRecord(i)
+				assert.Nil(t, task.Apply(ctx, record))
+				want(t, record)
+			}(i)
+		}
+		wg.Wait()
+	})
+
+	t.Run("runner", func(t *testing.T) {
+		var (
+			task   = Enrich("test", ds, BasicKeyFunc("id"), WithMerge(MergeIfAbsent))
+			runner = dag.NewRunner(task, dag.WithWorkers(16))
+			in     = make(chan *dag.Record)
+		)
+		go func() {
+			defer close(in)
+			for i := 0; i < n; i++ {
+				in <- newRecord(i)
+			}
+		}()
+
+		var count int
+		for result := range runner.Run(ctx, in) {
+			assert.Nil(t, result.Err)
+			want(t, result.Record)
+			count++
+		}
+		assert.Equal(t, n, count)
+	})
+
+	t.Run("batching runner", func(t *testing.T) {
+		var (
+			task   = Enrich("test", &countingDataSource{NestedMapDataSource: ds}, BasicKeyFunc("id"))
+			runner = dag.NewRunner(task, dag.WithWorkers(8), dag.WithBatch(10, time.Millisecond))
+			in     = make(chan *dag.Record)
+		)
+		go func() {
+			defer close(in)
+			for i := 0; i < n; i++ {
+				in <- newRecord(i)
+			}
+		}()
+
+		var count int
+		for result := range runner.Run(ctx, in) {
+			assert.Nil(t, result.Err)
+			want(t, result.Record)
+			count++
+		}
+		assert.Equal(t, n, count)
+	})
+
+	t.Run("options are copied", func(t *testing.T) {
+		fields := []string{"field_1"}
+		task := Enrich("test", ds, BasicKeyFunc("id"), WithFields(fields...))
+		fields[0] = "field_2"
+
+		record := newRecord(1)
+		assert.Nil(t, task.Apply(ctx, record))
+		want(t, record)
+	})
+}
+
+// multiDataSource holds many rows per key
+type multiDataSource map[string][]map[string]interface{}
+
+func (m multiDataSource) Get(ctx context.Context, key string) (map[string]interface{}, error) {
+	rows, err := m.GetAll(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return rows[0], nil
+}
+
+func (m multiDataSource) GetAll(ctx context.Context, key string) ([]map[string]interface{}, error) {
+	rows, ok := m[key]
+	if !ok {
+		return nil, &notFoundError{key: key}
+	}
+	return rows, nil
+}
+
+func TestEnrich_Target(t *testing.T) {
+	var (
+		ctx = context.Background()
+		ds  = NestedMapDataSource{"a": {"name": "alpha", "tier": "gold", "ignored": true}}
+	)
+
+	newRecord := func(id string) *dag.Record {
+		record := &dag.Record{}
+		record.Set("id", id)
+		return record
+	}
+
+	t.Run("map", func(t *testing.T) {
+		record := newRecord("a")
+		task := Enrich("test", ds, BasicKeyFunc("id"), WithTarget("customer"), WithFields("name", "tier"), WithPrefix("customer_"))
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, map[string]interface{}{
+			"id": "a",
+			"customer": map[string]interface{}{
+				"customer_name": "alpha",
+				"customer_tier": "gold",
+			},
+		}, record.Copy())
+	})
+
+	t.Run("merge applies to the target", func(t *testing.T) {
+		record := newRecord("a")
+		record.Set("customer", "existing")
+		task := Enrich("test", ds, BasicKeyFunc("id"), WithTarget("customer"), WithMerge(MergeIfAbsent))
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, "existing", record.Copy()["customer"])
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		record := newRecord("missing")
+		task := Enrich("test", ds, BasicKeyFunc("id"), WithTarget("customer"), WithDefaults(map[string]interface{}{"tier": "none"}))
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, map[string]interface{}{"tier": "none"}, record.Copy()["customer"])
+	})
+
+	t.Run("list", func(t *testing.T) {
+		orders := multiDataSource{
+			"a": {
+				{"order": 1, "total": 9.99},
+				{"order": 2, "total": 19.99},
+			},
+		}
+
+		record := newRecord("a")
+		task := Enrich("test", orders, BasicKeyFunc("id"), WithTargetList("orders"), WithFields("order"))
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, []map[string]interface{}{{"order": 1}, {"order": 2}}, record.Copy()["orders"])
+
+		// a DataSource with a single row per key yields a list of one
+		record = newRecord("a")
+		task = Enrich("test", ds, BasicKeyFunc("id"), WithTargetList("customers"), WithFields("name"))
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, []map[string]interface{}{{"name": "alpha"}}, record.Copy()["customers"])
+	})
+
+	t.Run("list required", func(t *testing.T) {
+		orders := multiDataSource{
+			"a": {
+				{"order": 1, "total": 9.99},
+				{"order": 2},
+			},
+		}
+
+		record := newRecord("a")
+		task := Enrich("test", orders, BasicKeyFunc("id"), WithTargetList("orders"), WithRequired("total"))
+		assert.EqualError(t, task.Apply(ctx, record), "key, a, is missing required field, total")
+		assert.Equal(t, map[string]interface{}{"id": "a"}, record.Copy())
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		source := &countingDataSource{NestedMapDataSource: ds}
+		task := Enrich("test", source, BasicKeyFunc("id"), WithTarget("customer"), WithFields("name")).(dag.BatchTask)
+
+		records := []*dag.Record{newRecord("a"), newRecord("a")}
+		assert.Nil(t, task.ApplyBatch(ctx, records))
+		for _, record := range records {
+			assert.Equal(t, map[string]interface{}{"name": "alpha"}, record.Copy()["customer"])
+		}
+		assert.Equal(t, [][]string{{"a"}}, source.batches)
+	})
+}
@@ -0,0 +1,351 @@
+package builtin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/savaki/dag"
+	"github.com/savaki/dag/recordio"
+	"golang.org/x/xerrors"
+)
+
+// DuplicateKey identifies a key that appears more than once within a file
+type DuplicateKey struct {
+	// Key that was duplicated
+	Key string
+	// Lines holds the line of each occurrence; for JSON arrays, the position of
+	// the element starting at 1
+	Lines []int
+}
+
+// DuplicateKeyError reports the keys that appear more than once within a file
+type DuplicateKeyError struct {
+	// Path of the file
+	Path string
+	// Duplicates ordered by the first occurrence of each key
+	Duplicates []DuplicateKey
+}
+
+// Error implements error
+func (e *DuplicateKeyError) Error() string {
+	parts := make([]string, 0, len(e.Duplicates))
+	for _, d := range e.Duplicates {
+		lines := make([]string, 0, len(d.Lines))
+		for _, line := range d.Lines {
+			lines = append(lines, strconv.Itoa(line))
+		}
+		parts = append(parts, fmt.Sprintf("%q (lines %v)", d.Key, strings.Join(lines, ", ")))
+	}
+	return fmt.Sprintf("%v: %v duplicate keys: %v", e.Path, len(e.Duplicates), strings.Join(parts, "; "))
+}
+
+type fileOptions struct {
+	format   string
+	read     []recordio.Option
+	interval time.Duration
+	onReload func(error)
+}
+
+// FileOption provides functional options for FileDataSource
+type FileOption func(*fileOptions)
+
+// WithFormat sets the format of the file; one of csv, tsv, json or jsonl.  By
+// default the format is determined by the file extension
+func WithFormat(format string) FileOption {
+	return func(o *fileOptions) {
+		o.format = format
+	}
+}
+
+// WithReadOptions passes options, such as recordio.WithTypeInference, to the
+// reader of the file
+func WithReadOptions(opts ...recordio.Option) FileOption {
+	return func(o *fileOptions) {
+		o.read = append(o.read, opts...)
+	}
+}
+
+// WithReloadInterval checks the file for changes at the interval and reloads
+// it when modified
+func WithReloadInterval(d time.Duration) FileOption {
+	return func(o *fileOptions) {
+		o.interval = d
+	}
+}
+
+// WithReloadHandler is called after each reload triggered by
+// WithReloadInterval with the error, if any.  A failed reload leaves the
+// previously loaded records in place
+func WithReloadHandler(fn func(err error)) FileOption {
+	return func(o *fileOptions) {
+		o.onReload = fn
+	}
+}
+
+// FileTable is a DataSource holding the contents of a file in memory
+type FileTable struct {
+	path       string
+	keyColumns []string
+	options    fileOptions
+
+	mutex   sync.RWMutex
+	records map[string]map[string]interface{}
+	modTime time.Time
+	size    int64
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// FileDataSource loads a CSV, TSV, JSON array or JSON lines file into memory
+// indexed by the key columns.  Keys for multiple columns are joined with a
+// colon, matching BasicKeyFunc, so that
+//
+//	FileDataSource("states.csv", []string{"country", "code"})
+//
+// serves lookups keyed by BasicKeyFunc("country", "code").  Key values that are
+// not strings, such as numbers read from JSON, are formatted as strings.  A
+// file containing the same key more than once fails to load with a
+// *DuplicateKeyError.  Close must be called to stop watching the file when
+// WithReloadInterval is used
+func FileDataSource(path string, keyColumns []string, opts ...FileOption) (*FileTable, error) {
+	if len(keyColumns) == 0 {
+		return nil, xerrors.Errorf("unable to load %v: no key columns specified", path)
+	}
+
+	options := fileOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	t := &FileTable{
+		path:       path,
+		keyColumns: keyColumns,
+		options:    options,
+		done:       make(chan struct{}),
+	}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+
+	if options.interval > 0 {
+		t.wg.Add(1)
+		go t.watch()
+	}
+
+	return t, nil
+}
+
+// Get implements DataSource
+func (t *FileTable) Get(ctx context.Context, key string) (map[string]interface{}, error) {
+	t.mutex.RLock()
+	v, ok := t.records[key]
+	t.mutex.RUnlock()
+
+	if !ok {
+		return nil, &notFoundError{key: key}
+	}
+	return v, nil
+}
+
+// GetMany implements BatchDataSource
+func (t *FileTable) GetMany(ctx context.Context, keys []string) (map[string]map[string]interface{}, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	found := map[string]map[string]interface{}{}
+	for _, key := range keys {
+		if v, ok := t.records[key]; ok {
+			found[key] = v
+		}
+	}
+	return found, nil
+}
+
+// Len returns the number of records loaded
+func (t *FileTable) Len() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return len(t.records)
+}
+
+// Reload reads the file replacing the records held.  On error, the previously
+// loaded records are retained
+func (t *FileTable) Reload() error {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return xerrors.Errorf("unable to load %v: %w", t.path, err)
+	}
+
+	records, err := t.load()
+	if err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	t.records = records
+	t.modTime = info.ModTime()
+	t.size = info.Size()
+	t.mutex.Unlock()
+
+	return nil
+}
+
+// Close stops watching the file for changes
+func (t *FileTable) Close() error {
+	select {
+	case <-t.done:
+	default:
+		close(t.done)
+	}
+	t.wg.Wait()
+	return nil
+}
+
+func (t *FileTable) watch() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.options.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			if !t.modified() {
+				continue
+			}
+			err := t.Reload()
+			if t.options.onReload != nil {
+				t.options.onReload(err)
+			}
+		}
+	}
+}
+
+// modified reports whether the file has changed since it was last loaded
+func (t *FileTable) modified() bool {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return false
+	}
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return !info.ModTime().Equal(t.modTime) || info.Size() != t.size
+}
+
+func (t *FileTable) load() (map[string]map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(t.path)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to load %v: %w", t.path, err)
+	}
+
+	source, err := t.source(data)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to load %v: %w", t.path, err)
+	}
+
+	var (
+		ctx     = context.Background()
+		records = map[string]map[string]interface{}{}
+		lines   = map[string][]int{}
+		order   []string // keys in order of first occurrence
+	)
+	for {
+		record, err := source.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("unable to load %v: %w", t.path, err)
+		}
+
+		line, _ := strconv.Atoi(record.Meta().Properties["line"])
+		key, err := t.key(record)
+		if err != nil {
+			return nil, xerrors.Errorf("unable to load %v: line %v: %w", t.path, line, err)
+		}
+
+		if _, ok := lines[key]; !ok {
+			order = append(order, key)
+			records[key] = record.Copy()
+		}
+		lines[key] = append(lines[key], line)
+	}
+
+	var duplicates []DuplicateKey
+	for _, key := range order {
+		if len(lines[key]) > 1 {
+			duplicates = append(duplicates, DuplicateKey{Key: key, Lines: lines[key]})
+		}
+	}
+	if len(duplicates) > 0 {
+		return nil, &DuplicateKeyError{Path: t.path, Duplicates: duplicates}
+	}
+
+	return records, nil
+}
+
+// key joins the values of the key columns with a colon as BasicKeyFunc does
+func (t *FileTable) key(record *dag.Record) (string, error) {
+	parts := make([]string, 0, len(t.keyColumns))
+	for _, column := range t.keyColumns {
+		v, err := record.Get(column)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, toString(v))
+	}
+	return strings.Join(parts, ":"), nil
+}
+
+// source returns a reader for the file contents per the configured or implied
+// format
+func (t *FileTable) source(data []byte) (recordio.Source, error) {
+	format := t.options.format
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(t.path)), ".")
+	}
+
+	switch format {
+	case "csv":
+		return recordio.NewCSVSource(bytes.NewReader(data), t.options.read...), nil
+	case "tsv":
+		return recordio.NewTSVSource(bytes.NewReader(data), t.options.read...), nil
+	case "jsonl", "ndjson":
+		return recordio.NewJSONLinesSource(bytes.NewReader(data), t.options.read...), nil
+	case "json":
+		if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '[' {
+			return recordio.NewJSONLinesSource(bytes.NewReader(data), t.options.read...), nil
+		}
+
+		// rewrite the array as json lines so that elements are numbered, and
+		// their values converted, exactly as json lines
+		var elements []json.RawMessage
+		if err := json.Unmarshal(data, &elements); err != nil {
+			return nil, xerrors.Errorf("unable to decode json array: %w", err)
+		}
+		buf := bytes.NewBuffer(nil)
+		for _, element := range elements {
+			if err := json.Compact(buf, element); err != nil {
+				return nil, xerrors.Errorf("unable to decode json array: %w", err)
+			}
+			buf.WriteByte('\n')
+		}
+		return recordio.NewJSONLinesSource(buf, t.options.read...), nil
+	default:
+		return nil, xerrors.Errorf("unsupported format, %q; expected csv, tsv, json or jsonl", format)
+	}
+}
@@ -0,0 +1,161 @@
+package builtin
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/savaki/dag"
+	"github.com/savaki/dag/recordio"
+	"github.com/tj/assert"
+	"golang.org/x/xerrors"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func TestFileDataSource(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("csv", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "states.csv")
+		writeFile(t, path, "country,code,name\nUS,CA,California\nUS,NY,New York\nMX,CA,Campeche\n")
+
+		table, err := FileDataSource(path, []string{"country", "code"})
+		assert.Nil(t, err)
+		defer table.Close()
+
+		assert.Equal(t, 3, table.Len())
+		v, err := table.Get(ctx, "MX:CA")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{"country": "MX", "code": "CA", "name": "Campeche"}, v)
+
+		_, err = table.Get(ctx, "CA")
+		assert.True(t, IsNotFound(err))
+
+		found, err := table.GetMany(ctx, []string{"US:CA", "US:TX"})
+		assert.Nil(t, err)
+		assert.Len(t, found, 1)
+		assert.Equal(t, "California", found["US:CA"]["name"])
+	})
+
+	t.Run("read options", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "products.tsv")
+		writeFile(t, path, "sku\tprice\n1\t9.99\n")
+
+		table, err := FileDataSource(path, []string{"sku"}, WithReadOptions(recordio.WithTypeInference()))
+		assert.Nil(t, err)
+
+		v, err := table.Get(ctx, "1")
+		assert.Nil(t, err)
+		assert.Equal(t, 9.99, v["price"])
+	})
+
+	t.Run("json", func(t *testing.T) {
+		dir := t.TempDir()
+
+		array := filepath.Join(dir, "products.json")
+		writeFile(t, array, `[{"sku": 1, "name": "widget"}, {"sku": 2, "name": "gadget"}]`)
+		lines := filepath.Join(dir, "products.jsonl")
+		writeFile(t, lines, "{\"sku\": 1, \"name\": \"widget\"}\n{\"sku\": 2, \"name\": \"gadget\"}\n")
+		custom := filepath.Join(dir, "products.txt")
+		writeFile(t, custom, "{\"sku\": 1, \"name\": \"widget\"}\n")
+
+		for _, path := range []string{array, lines} {
+			table, err := FileDataSource(path, []string{"sku"})
+			assert.Nil(t, err)
+			v, err := table.Get(ctx, "2")
+			assert.Nil(t, err)
+			assert.Equal(t, map[string]interface{}{"sku": 2, "name": "gadget"}, v)
+		}
+
+		_, err := FileDataSource(custom, []string{"sku"})
+		assert.NotNil(t, err)
+		table, err := FileDataSource(custom, []string{"sku"}, WithFormat("jsonl"))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, table.Len())
+	})
+
+	t.Run("duplicate keys", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "states.csv")
+		writeFile(t, path, "code,name\nCA,California\nNY,New York\nCA,Calif\nNY,NY\nCA,Cali\n")
+
+		_, err := FileDataSource(path, []string{"code"})
+		var de *DuplicateKeyError
+		assert.True(t, xerrors.As(err, &de))
+		assert.Equal(t, []DuplicateKey{
+			{Key: "CA", Lines: []int{2, 4, 6}},
+			{Key: "NY", Lines: []int{3, 5}},
+		}, de.Duplicates)
+		assert.Contains(t, err.Error(), `"CA" (lines 2, 4, 6)`)
+
+		path = filepath.Join(t.TempDir(), "products.json")
+		writeFile(t, path, `[{"sku": 1}, {"sku": 2}, {"sku": 1}]`)
+		_, err = FileDataSource(path, []string{"sku"})
+		assert.True(t, xerrors.As(err, &de))
+		assert.Equal(t, []DuplicateKey{{Key: "1", Lines: []int{1, 3}}}, de.Duplicates)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		dir := t.TempDir()
+
+		_, err := FileDataSource(filepath.Join(dir, "missing.csv"), []string{"code"})
+		assert.True(t, xerrors.Is(err, os.ErrNotExist))
+
+		path := filepath.Join(dir, "states.csv")
+		writeFile(t, path, "code,name\nCA,California\n")
+		_, err = FileDataSource(path, nil)
+		assert.NotNil(t, err)
+		_, err = FileDataSource(path, []string{"id"})
+		assert.NotNil(t, err)
+
+		_, err = FileDataSource(path, []string{"code"}, WithFormat("xml"))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "states.csv")
+		writeFile(t, path, "code,name\nCA,California\n")
+
+		reloads := make(chan error, 10)
+		table, err := FileDataSource(path, []string{"code"},
+			WithReloadInterval(5*time.Millisecond),
+			WithReloadHandler(func(err error) { reloads <- err }),
+		)
+		assert.Nil(t, err)
+		defer table.Close()
+
+		writeFile(t, path, "code,name\nCA,California\nNY,New York\n")
+		assert.Nil(t, <-reloads)
+		v, err := table.Get(ctx, "NY")
+		assert.Nil(t, err)
+		assert.Equal(t, "New York", v["name"])
+
+		// a failed reload retains the previous records
+		writeFile(t, path, "code,name\nCA,California\nCA,Calif\nNY,New York\n")
+		assert.NotNil(t, <-reloads)
+		assert.Equal(t, 2, table.Len())
+
+		assert.Nil(t, table.Close())
+		assert.Nil(t, table.Close())
+	})
+
+	t.Run("enrich", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "states.csv")
+		writeFile(t, path, "country,code,name\nUS,CA,California\n")
+
+		table, err := FileDataSource(path, []string{"country", "code"})
+		assert.Nil(t, err)
+
+		record := &dag.Record{}
+		record.Set("country", "US")
+		record.Set("state", "CA")
+		task := Enrich("enrich", table, BasicKeyFunc("country", "state"), WithFields("name"))
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, "California", record.Copy()["name"])
+	})
+}
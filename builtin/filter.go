@@ -0,0 +1,22 @@
+package builtin
+
+import (
+	"context"
+
+	"github.com/savaki/dag"
+)
+
+// Filter keeps records that satisfy the predicate; all other records are
+// dropped with the label as the reason.  See dag.ErrDrop
+func Filter(label string, predicate dag.Predicate) dag.Task {
+	return withName(label, func(ctx context.Context, record *dag.Record) error {
+		ok, err := predicate(ctx, record)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return dag.Drop(label)
+		}
+		return nil
+	})
+}
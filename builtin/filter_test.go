@@ -0,0 +1,36 @@
+package builtin
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/savaki/dag"
+	"github.com/tj/assert"
+)
+
+func TestFilter(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		isCA = func(ctx context.Context, record *dag.Record) (bool, error) {
+			state, _ := record.String("state")
+			return state == "CA", nil
+		}
+		task = Filter("ca-only", isCA)
+	)
+
+	record := &dag.Record{}
+	record.Set("state", "CA")
+	err := task.Apply(ctx, record)
+	assert.Nil(t, err)
+
+	err = task.Apply(ctx, &dag.Record{})
+	assert.True(t, dag.IsDropped(err))
+	assert.Equal(t, "record dropped: ca-only", err.Error())
+
+	failing := Filter("failing", func(ctx context.Context, record *dag.Record) (bool, error) {
+		return false, io.EOF
+	})
+	err = failing.Apply(ctx, record)
+	assert.Equal(t, io.EOF, err)
+}
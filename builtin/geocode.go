@@ -3,8 +3,10 @@ package builtin
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/savaki/dag"
 	"golang.org/x/xerrors"
@@ -12,7 +14,8 @@ import (
 
 // Geocoder provides a general mechanism to enrich a record with geocode information
 type Geocoder interface {
-	// Lookup the provided address
+	// Lookup the provided address.  An address that could not be found is
+	// reported with an error that wraps ErrNotFound
 	Lookup(ctx context.Context, street, city, state string) (map[string]interface{}, error)
 }
 
@@ -22,77 +25,167 @@ func (fn geocoderFunc) Lookup(ctx context.Context, street, city, state string) (
 	return fn(ctx, street, city, state)
 }
 
-// Geocode enriches a record with geocode information
+// Address to be geocoded
+type Address struct {
+	Street string
+	City   string
+	State  string
+}
+
+// addressNotFoundError reports the address that could not be geocoded
+type addressNotFoundError struct {
+	address Address
+}
+
+func (e *addressNotFoundError) Error() string {
+	var parts []string
+	for _, part := range []string{e.address.Street, e.address.City, e.address.State} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return fmt.Sprintf("address not found, %v", strings.Join(parts, ", "))
+}
+
+func (e *addressNotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// BatchGeocoder is a Geocoder that can look up many addresses in one call
+type BatchGeocoder interface {
+	Geocoder
+
+	// LookupMany returns the geocode information for each address in the order
+	// provided; the entry for an address that could not be found is nil
+	LookupMany(ctx context.Context, addresses []Address) ([]map[string]interface{}, error)
+}
+
+// Geocode enriches a record with geocode information.  Geocode implements
+// dag.BatchTask; when geocoder is a BatchGeocoder, the addresses of a batch
+// are resolved with a single call to LookupMany.
+//
+// Records without a street or state are left unchanged.  An address that is
+// not found, whether by Lookup or LookupMany, fails the record unless
+// SkipNotFound or WithDefaults is provided
 func Geocode(label string, geocoder Geocoder, street, city, state string, opts ...Option) dag.Task {
-	options := makeOptions(opts...)
+	return dag.WithName(label, &geocode{
+		geocoder: geocoder,
+		street:   street,
+		city:     city,
+		state:    state,
+		options:  makeOptions(opts...),
+	})
+}
 
-	return withName(label, func(ctx context.Context, record *dag.Record) error {
-		theStreet, _ := record.String(street)
-		theCity, _ := record.String(city)
-		theState, _ := record.String(state)
+type geocode struct {
+	geocoder            Geocoder
+	street, city, state string
+	options             options
+}
 
-		if theStreet == "" || theState == "" {
-			return nil
+// address returns the address of the record; ok is false if either the street
+// or state are missing
+func (g *geocode) address(record *dag.Record) (Address, bool) {
+	theStreet, _ := record.String(g.street)
+	theCity, _ := record.String(g.city)
+	theState, _ := record.String(g.state)
+
+	return Address{Street: theStreet, City: theCity, State: theState}, theStreet != "" && theState != ""
+}
+
+// Apply implements dag.Task
+func (g *geocode) Apply(ctx context.Context, record *dag.Record) error {
+	address, ok := g.address(record)
+	if !ok {
+		return nil
+	}
+
+	results, err := g.geocoder.Lookup(ctx, address.Street, address.City, address.State)
+	return g.apply(record, address, results, err)
+}
+
+// ApplyBatch implements dag.BatchTask
+func (g *geocode) ApplyBatch(ctx context.Context, records []*dag.Record) error {
+	batch, ok := g.geocoder.(BatchGeocoder)
+	if !ok {
+		errs := make([]error, len(records))
+		for i, record := range records {
+			errs[i] = g.Apply(ctx, record)
 		}
+		return batchError(errs)
+	}
 
-		results, err := geocoder.Lookup(ctx, theStreet, theCity, theState)
-		if err != nil {
+	var (
+		addresses []Address
+		indexes   []int // position of the record for each address
+	)
+	for i, record := range records {
+		if address, ok := g.address(record); ok {
+			addresses = append(addresses, address)
+			indexes = append(indexes, i)
+		}
+	}
+	if len(addresses) == 0 {
+		return nil
+	}
+
+	results, err := batch.LookupMany(ctx, addresses)
+	if err != nil {
+		return err
+	}
+	if len(results) != len(addresses) {
+		return xerrors.Errorf("geocoder returned %v results for %v addresses", len(results), len(addresses))
+	}
+
+	errs := make([]error, len(records))
+	for i, result := range results {
+		errs[indexes[i]] = g.apply(records[indexes[i]], addresses[i], result, nil)
+	}
+	return batchError(errs)
+}
+
+// apply merges the results of geocoding address into the record; a nil result
+// is treated as not found
+func (g *geocode) apply(record *dag.Record, address Address, results map[string]interface{}, err error) error {
+	if err == nil && results == nil {
+		err = &addressNotFoundError{address: address}
+	}
+	if err != nil {
+		if !IsNotFound(err) {
 			return err
 		}
+		switch {
+		case g.options.defaults != nil:
+			return g.merge(record, g.options.defaults)
+		case g.options.skip:
+			return nil
+		default:
+			return err
+		}
+	}
 
-		for field, value := range results {
-			if len(options.fields) > 0 && !containsString(options.fields, field) {
-				continue
-			}
+	return g.merge(record, results)
+}
 
-			mapped, err := options.mapField(field)
-			if err != nil {
-				return err
-			}
-			record.Set(mapped, value)
+func (g *geocode) merge(record *dag.Record, results map[string]interface{}) error {
+	for field, value := range results {
+		if len(g.options.fields) > 0 && !containsString(g.options.fields, field) {
+			continue
 		}
 
-		return nil
-	})
+		mapped, err := g.options.mapField(field)
+		if err != nil {
+			return err
+		}
+		record.Set(mapped, value)
+	}
+
+	return nil
 }
 
 // SmartyStreets provides a SmartyStreets Geocoder.  If a nil transport is provided,
 // http.DefaultTransport will be used
 func SmartyStreets(authID, authToken string, transport http.RoundTripper) Geocoder {
-	type Response struct {
-		DeliveryLine1 string `json:"delivery_line_1"`
-		Components    struct {
-			PrimaryNumber     string `json:"primary_number"`
-			StreetName        string `json:"street_name"`
-			StreetSuffix      string `json:"street_suffix"`
-			CityName          string `json:"city_name"`
-			StateAbbreviation string `json:"state_abbreviation"`
-			ZipCode           string `json:"zipcode"`
-			Plus4Code         string `json:"plus4_code"`
-		} `json:"components"`
-		Metadata struct {
-			ZipType               string  `json:"zip_type"`
-			CountyFips            string  `json:"county_fips"`
-			CountyName            string  `json:"county_name"`
-			CongressionalDistrict string  `json:"congressional_district"`
-			RDI                   string  `json:"rds"`
-			Latitude              float64 `json:"latitude"`
-			Longitude             float64 `json:"longitude"`
-			Precision             string  `json:"precision"`
-			TimeZone              string  `json:"time_zone"`
-			UTCOffset             int     `json:"utc_offset"`
-			DST                   bool    `json:"dst"`
-		} `json:"metadata"`
-		Analysis struct {
-			DpvMatchCode string `json:"dpv_match_code"`
-			DpvFootnotes string `json:"dpv_footnotes"`
-			DpvCMRA      string `json:"dpv_cmra"`
-			DpvVacant    string `json:"dpv_vacant"`
-			Active       string `json:"active"`
-			Footnotes    string `json:"footnotes"`
-		} `json:"analysis"`
-	}
-
 	if transport == nil {
 		transport = http.DefaultTransport
 	}
@@ -128,24 +221,65 @@ func SmartyStreets(authID, authToken string, transport http.RoundTripper) Geocod
 			return nil, xerrors.Errorf("smarty streets returned an invalid status code, %v", resp.StatusCode)
 		}
 
-		var responses []Response
+		var responses []smartyStreetsCandidate
 		if err := json.NewDecoder(resp.Body).Decode(&responses); err != nil {
 			return nil, xerrors.Errorf("unable to decode smarty streets response: %w", err)
 		}
 
 		if len(responses) == 0 {
-			return nil, xerrors.Errorf("")
+			return nil, &addressNotFoundError{address: Address{Street: street, City: city, State: state}}
 		}
 
-		response := responses[0]
-		return map[string]interface{}{
-			"city":      response.Components.CityName,
-			"county":    response.Metadata.CountyName,
-			"state":     response.Components.StateAbbreviation,
-			"street":    response.DeliveryLine1,
-			"zip":       response.Components.ZipCode,
-			"latitude":  response.Metadata.Latitude,
-			"longitude": response.Metadata.Longitude,
-		}, nil
+		return responses[0].fields(), nil
 	})
 }
+
+// smartyStreetsCandidate is an address returned by the SmartyStreets street
+// address api
+type smartyStreetsCandidate struct {
+	InputIndex    int    `json:"input_index"`
+	DeliveryLine1 string `json:"delivery_line_1"`
+	Components    struct {
+		PrimaryNumber     string `json:"primary_number"`
+		StreetName        string `json:"street_name"`
+		StreetSuffix      string `json:"street_suffix"`
+		CityName          string `json:"city_name"`
+		StateAbbreviation string `json:"state_abbreviation"`
+		ZipCode           string `json:"zipcode"`
+		Plus4Code         string `json:"plus4_code"`
+	} `json:"components"`
+	Metadata struct {
+		ZipType               string  `json:"zip_type"`
+		CountyFips            string  `json:"county_fips"`
+		CountyName            string  `json:"county_name"`
+		CongressionalDistrict string  `json:"congressional_district"`
+		RDI                   string  `json:"rds"`
+		Latitude              float64 `json:"latitude"`
+		Longitude             float64 `json:"longitude"`
+		Precision             string  `json:"precision"`
+		TimeZone              string  `json:"time_zone"`
+		UTCOffset             int     `json:"utc_offset"`
+		DST                   bool    `json:"dst"`
+	} `json:"metadata"`
+	Analysis struct {
+		DpvMatchCode string `json:"dpv_match_code"`
+		DpvFootnotes string `json:"dpv_footnotes"`
+		DpvCMRA      string `json:"dpv_cmra"`
+		DpvVacant    string `json:"dpv_vacant"`
+		Active       string `json:"active"`
+		Footnotes    string `json:"footnotes"`
+	} `json:"analysis"`
+}
+
+// fields returns the geocode information provided to records
+func (c smartyStreetsCandidate) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"city":      c.Components.CityName,
+		"county":    c.Metadata.CountyName,
+		"state":     c.Components.StateAbbreviation,
+		"street":    c.DeliveryLine1,
+		"zip":       c.Components.ZipCode,
+		"latitude":  c.Metadata.Latitude,
+		"longitude": c.Metadata.Longitude,
+	}
+}
@@ -147,6 +147,35 @@ func TestGeocoder(t *testing.T) {
 		}
 		assert.Equal(t, want, record.Copy())
 	})
+
+	t.Run("not found", func(t *testing.T) {
+		geocoder := SmartyStreets("blah", "blah", transportFunc(func(req *http.Request) (*http.Response, error) {
+			recorder := httptest.NewRecorder()
+			_, _ = io.WriteString(recorder, "[]")
+			return recorder.Result(), nil
+		}))
+
+		newRecord := func() *dag.Record {
+			record := &dag.Record{}
+			record.Set("state", state)
+			record.Set("street", street)
+			return record
+		}
+
+		err := Geocode("test", geocoder, "street", "city", "state").Apply(ctx, newRecord())
+		assert.True(t, IsNotFound(err))
+		assert.EqualError(t, err, "address not found, the-street, the-state")
+
+		record := newRecord()
+		err = Geocode("test", geocoder, "street", "city", "state", SkipNotFound()).Apply(ctx, record)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{"state": state, "street": street}, record.Copy())
+
+		record = newRecord()
+		err = Geocode("test", geocoder, "street", "city", "state", WithDefaults(map[string]interface{}{"latitude": 0.0})).Apply(ctx, record)
+		assert.Nil(t, err)
+		assert.Equal(t, 0.0, record.Copy()["latitude"])
+	})
 }
 
 func TestSmartyStreets(t *testing.T) {
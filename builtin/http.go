@@ -0,0 +1,209 @@
+package builtin
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// keyPlaceholder is replaced by the escaped key within an HTTPDataSource url
+const keyPlaceholder = "{key}"
+
+type httpOptions struct {
+	header    http.Header
+	transport http.RoundTripper
+	path      []string
+}
+
+// HTTPOption provides functional options for HTTPDataSource
+type HTTPOption func(*httpOptions)
+
+// WithHeader adds a header to each request
+func WithHeader(key, value string) HTTPOption {
+	return func(o *httpOptions) {
+		o.header.Add(key, value)
+	}
+}
+
+// WithBasicAuth authenticates each request with the username and password
+func WithBasicAuth(username, password string) HTTPOption {
+	return func(o *httpOptions) {
+		credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+		o.header.Set("Authorization", "Basic "+credentials)
+	}
+}
+
+// WithBearerToken authenticates each request with the bearer token
+func WithBearerToken(token string) HTTPOption {
+	return func(o *httpOptions) {
+		o.header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// WithTransport sets the http.RoundTripper used to make requests.  Defaults to
+// http.DefaultTransport
+func WithTransport(transport http.RoundTripper) HTTPOption {
+	return func(o *httpOptions) {
+		o.transport = transport
+	}
+}
+
+// WithJSONPath extracts the record from the response at the dot separated path
+// e.g. data.results.0 selects the first element of the results array within
+// the data object.  A response without the path is treated as not found
+func WithJSONPath(path string) HTTPOption {
+	return func(o *httpOptions) {
+		o.path = nil
+		if path != "" {
+			o.path = strings.Split(path, ".")
+		}
+	}
+}
+
+type httpDataSource struct {
+	template string
+	options  httpOptions
+}
+
+// HTTPDataSource returns a DataSource that retrieves each record as a JSON
+// object with a GET request.  The url template must contain {key} which is
+// replaced by the escaped key e.g. https://api.example.com/users/{key}.  A 404
+// response is reported as not found and any other non-2xx response as an error
+func HTTPDataSource(template string, opts ...HTTPOption) (DataSource, error) {
+	if !strings.Contains(template, keyPlaceholder) {
+		return nil, xerrors.Errorf("invalid url template, %v: missing %v", template, keyPlaceholder)
+	}
+	if _, err := url.Parse(strings.ReplaceAll(template, keyPlaceholder, "key")); err != nil {
+		return nil, xerrors.Errorf("invalid url template, %v: %w", template, err)
+	}
+
+	options := httpOptions{
+		header:    http.Header{},
+		transport: http.DefaultTransport,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.transport == nil {
+		options.transport = http.DefaultTransport
+	}
+
+	return &httpDataSource{
+		template: template,
+		options:  options,
+	}, nil
+}
+
+// url expands the template; the key is query escaped within the query string
+// and path escaped elsewhere
+func (h *httpDataSource) url(key string) string {
+	var (
+		query = strings.Index(h.template, "?")
+		pos   int // offset of the current part within the template
+		sb    strings.Builder
+	)
+	for i, part := range strings.Split(h.template, keyPlaceholder) {
+		if i > 0 {
+			if query >= 0 && pos > query {
+				sb.WriteString(url.QueryEscape(key))
+			} else {
+				sb.WriteString(url.PathEscape(key))
+			}
+			pos += len(keyPlaceholder)
+		}
+		sb.WriteString(part)
+		pos += len(part)
+	}
+	return sb.String()
+}
+
+// location returns the scheme, host and path of u for use in errors; the query
+// string and user info, which may hold credentials, are omitted
+func location(u *url.URL) string {
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+}
+
+// withoutURL removes the full url included by *url.Error
+func withoutURL(err error) error {
+	var ue *url.Error
+	if xerrors.As(err, &ue) {
+		return ue.Err
+	}
+	return err
+}
+
+// Get implements DataSource
+func (h *httpDataSource) Get(ctx context.Context, key string) (map[string]interface{}, error) {
+	req, err := http.NewRequest(http.MethodGet, h.url(key), nil)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to create request for key, %v: %w", key, withoutURL(err))
+	}
+	uri := location(req.URL)
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	for k, v := range h.options.header {
+		req.Header[k] = v
+	}
+
+	resp, err := h.options.transport.RoundTrip(req)
+	if err != nil {
+		return nil, xerrors.Errorf("request to %v failed: %w", uri, withoutURL(err))
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil, &notFoundError{key: key}
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil, xerrors.Errorf("request to %v returned an invalid status code, %v", uri, resp.StatusCode)
+	}
+
+	var v interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, xerrors.Errorf("unable to decode response from %v: %w", uri, err)
+	}
+
+	for _, segment := range h.options.path {
+		var ok bool
+		if v, ok = jsonChild(v, segment); !ok {
+			return nil, &notFoundError{key: key}
+		}
+	}
+
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, nil
+	case nil:
+		return nil, &notFoundError{key: key}
+	default:
+		return nil, xerrors.Errorf("response from %v: expected a json object; got %T", uri, v)
+	}
+}
+
+// jsonChild returns the named field of an object or the indexed element of an
+// array
+func jsonChild(v interface{}, segment string) (interface{}, bool) {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		child, ok := node[segment]
+		return child, ok
+	case []interface{}:
+		i, err := strconv.Atoi(segment)
+		if err != nil || i < 0 || i >= len(node) {
+			return nil, false
+		}
+		return node[i], true
+	default:
+		return nil, false
+	}
+}
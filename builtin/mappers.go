@@ -0,0 +1,127 @@
+package builtin
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ChainMappers returns a FieldMapperFunc that applies each of the mappers in
+// turn, passing the result of one to the next
+func ChainMappers(mappers ...FieldMapperFunc) FieldMapperFunc {
+	return func(field string) (string, error) {
+		for _, fn := range mappers {
+			mapped, err := fn(field)
+			if err != nil {
+				return "", err
+			}
+			field = mapped
+		}
+		return field, nil
+	}
+}
+
+// SnakeCase maps field names to snake_case e.g. First Name and firstName become
+// first_name
+func SnakeCase(field string) (string, error) {
+	return strings.Join(lowerWords(field), "_"), nil
+}
+
+// KebabCase maps field names to kebab-case e.g. First Name and firstName become
+// first-name
+func KebabCase(field string) (string, error) {
+	return strings.Join(lowerWords(field), "-"), nil
+}
+
+// CamelCase maps field names to camelCase e.g. First Name and first_name become
+// firstName
+func CamelCase(field string) (string, error) {
+	parts := lowerWords(field)
+	for i := 1; i < len(parts); i++ {
+		runes := []rune(parts[i])
+		runes[0] = unicode.ToUpper(runes[0])
+		parts[i] = string(runes)
+	}
+	return strings.Join(parts, ""), nil
+}
+
+// LowerCase maps field names to lower case
+func LowerCase(field string) (string, error) {
+	return strings.ToLower(field), nil
+}
+
+// StripNonAlphanumeric removes any character that is not a letter or digit
+func StripNonAlphanumeric(field string) (string, error) {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, field), nil
+}
+
+// Rename maps the fields named in the table; other fields are unchanged
+func Rename(table map[string]string) FieldMapperFunc {
+	renames := make(map[string]string, len(table))
+	for k, v := range table {
+		renames[k] = v
+	}
+
+	return func(field string) (string, error) {
+		if mapped, ok := renames[field]; ok {
+			return mapped, nil
+		}
+		return field, nil
+	}
+}
+
+// ReplaceRegexp replaces matches of re within field names with replacement,
+// which may refer to submatches as with regexp.Regexp.ReplaceAllString
+func ReplaceRegexp(re *regexp.Regexp, replacement string) FieldMapperFunc {
+	return func(field string) (string, error) {
+		return re.ReplaceAllString(field, replacement), nil
+	}
+}
+
+// Prefix prepends prefix to field names
+func Prefix(prefix string) FieldMapperFunc {
+	return func(field string) (string, error) {
+		return prefix + field, nil
+	}
+}
+
+// lowerWords splits field into lower case words at any character that is not a
+// letter or digit and at changes of case; a run of upper case letters is kept
+// together as an acronym e.g. HTTPStatusCode is http, status, code
+func lowerWords(field string) []string {
+	var (
+		runes = []rune(field)
+		words []string
+		word  []rune
+	)
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+
+		if unicode.IsUpper(r) && len(word) > 0 {
+			prev := word[len(word)-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if !unicode.IsUpper(prev) || nextLower {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+
+	return words
+}
@@ -0,0 +1,131 @@
+package builtin
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"testing"
+
+	"github.com/savaki/dag"
+	"github.com/tj/assert"
+)
+
+func TestFieldMappers(t *testing.T) {
+	testCases := map[string]struct {
+		snake, kebab, camel string
+	}{
+		"first_name":     {snake: "first_name", kebab: "first-name", camel: "firstName"},
+		"First Name":     {snake: "first_name", kebab: "first-name", camel: "firstName"},
+		"firstName":      {snake: "first_name", kebab: "first-name", camel: "firstName"},
+		"FirstName":      {snake: "first_name", kebab: "first-name", camel: "firstName"},
+		"first-name":     {snake: "first_name", kebab: "first-name", camel: "firstName"},
+		"  first__name ": {snake: "first_name", kebab: "first-name", camel: "firstName"},
+		"HTTPStatusCode": {snake: "http_status_code", kebab: "http-status-code", camel: "httpStatusCode"},
+		"userID":         {snake: "user_id", kebab: "user-id", camel: "userId"},
+		"address2Line":   {snake: "address2_line", kebab: "address2-line", camel: "address2Line"},
+		"e-mail (work)":  {snake: "e_mail_work", kebab: "e-mail-work", camel: "eMailWork"},
+		"Ünïcode Näme":   {snake: "ünïcode_näme", kebab: "ünïcode-näme", camel: "ünïcodeNäme"},
+		"":               {},
+	}
+
+	for field, tc := range testCases {
+		t.Run(field, func(t *testing.T) {
+			for fn, want := range map[string]string{"snake": tc.snake, "kebab": tc.kebab, "camel": tc.camel} {
+				var mapper FieldMapperFunc
+				switch fn {
+				case "snake":
+					mapper = SnakeCase
+				case "kebab":
+					mapper = KebabCase
+				default:
+					mapper = CamelCase
+				}
+
+				got, err := mapper(field)
+				assert.Nil(t, err)
+				assert.Equal(t, want, got, fn)
+			}
+		})
+	}
+
+	t.Run("lower", func(t *testing.T) {
+		got, err := LowerCase("First Name")
+		assert.Nil(t, err)
+		assert.Equal(t, "first name", got)
+	})
+
+	t.Run("strip", func(t *testing.T) {
+		got, err := StripNonAlphanumeric("e-mail (work)_2")
+		assert.Nil(t, err)
+		assert.Equal(t, "emailwork2", got)
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		table := map[string]string{"fname": "first_name"}
+		fn := Rename(table)
+		table["lname"] = "last_name"
+
+		for field, want := range map[string]string{"fname": "first_name", "lname": "lname"} {
+			got, err := fn(field)
+			assert.Nil(t, err)
+			assert.Equal(t, want, got)
+		}
+	})
+
+	t.Run("regexp", func(t *testing.T) {
+		fn := ReplaceRegexp(regexp.MustCompile(`^col_(\d+)$`), "column${1}")
+		got, err := fn("col_12")
+		assert.Nil(t, err)
+		assert.Equal(t, "column12", got)
+
+		got, err = fn("name")
+		assert.Nil(t, err)
+		assert.Equal(t, "name", got)
+	})
+
+	t.Run("chain", func(t *testing.T) {
+		fn := ChainMappers(Rename(map[string]string{"FName": "First Name"}), SnakeCase, Prefix("customer_"))
+		got, err := fn("FName")
+		assert.Nil(t, err)
+		assert.Equal(t, "customer_first_name", got)
+
+		failing := func(string) (string, error) { return "", io.EOF }
+		_, err = ChainMappers(SnakeCase, failing, Prefix("x"))("a")
+		assert.Equal(t, io.EOF, err)
+
+		got, err = ChainMappers()("a")
+		assert.Nil(t, err)
+		assert.Equal(t, "a", got)
+	})
+
+	t.Run("canonicalize", func(t *testing.T) {
+		record := &dag.Record{}
+		record.Set("First Name", "a")
+		record.Set("lastName", "b")
+
+		task := Canonicalize("test", ChainMappers(StripNonAlphanumeric, SnakeCase))
+		assert.Nil(t, task.Apply(context.Background(), record))
+		assert.Equal(t, map[string]interface{}{"first_name": "a", "last_name": "b"}, record.Copy())
+	})
+}
+
+func TestWithFieldMapper_Compose(t *testing.T) {
+	var (
+		ctx = context.Background()
+		ds  = MapDataSource{"firstName": "a"}
+	)
+
+	for _, tc := range []struct {
+		opts []Option
+		want string
+	}{
+		{opts: []Option{WithFieldMapper(SnakeCase), WithPrefix("customer_")}, want: "customer_first_name"},
+		{opts: []Option{WithPrefix("customer "), WithFieldMapper(SnakeCase)}, want: "customer_first_name"},
+		{opts: []Option{WithPrefix("a_"), WithPrefix("b_")}, want: "b_a_firstName"},
+	} {
+		record := &dag.Record{}
+		task := Enrich("test", ds, staticKey, tc.opts...)
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, map[string]interface{}{tc.want: "a"}, record.Copy())
+	}
+}
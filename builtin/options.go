@@ -7,9 +7,38 @@ type FieldMapperFunc func(string) (string, error)
 // ValueMapperFunc performs transformation on a field value
 type ValueMapperFunc func(interface{}) (interface{}, error)
 
+// MergeFunc resolves the value of a field that is already present on a record
+// being enriched; field is the name on the record after mapping
+type MergeFunc func(field string, current, incoming interface{}) (interface{}, error)
+
+var (
+	// MergeOverwrite replaces existing values with the enrichment; the default
+	MergeOverwrite MergeFunc = func(field string, current, incoming interface{}) (interface{}, error) {
+		return incoming, nil
+	}
+	// MergeIfAbsent sets fields only if they are not already present
+	MergeIfAbsent MergeFunc = func(field string, current, incoming interface{}) (interface{}, error) {
+		return current, nil
+	}
+	// MergeIfEmpty sets fields that are not present or hold nil, an empty
+	// string, or an empty slice or map
+	MergeIfEmpty MergeFunc = func(field string, current, incoming interface{}) (interface{}, error) {
+		if isEmpty(current) {
+			return incoming, nil
+		}
+		return current, nil
+	}
+)
+
 type options struct {
-	fields   []string
-	mapField FieldMapperFunc
+	fields     []string
+	mapField   FieldMapperFunc
+	merge      MergeFunc
+	skip       bool                   // skip records whose key is not found
+	defaults   map[string]interface{} // used in place of records not found
+	required   []string
+	target     string // field holding the enrichment; empty sets fields on the record
+	targetList bool   // target holds a list of rows
 }
 
 // Option provides functional options
@@ -17,32 +46,92 @@ type Option func(*options)
 
 // WithFields limits an enrichment to the specified fields
 func WithFields(fields ...string) Option {
+	fields = append([]string(nil), fields...)
 	return func(o *options) {
 		o.fields = fields
 	}
 }
 
-// WithFieldMapper performs transformation on the field name; useful for canonicalization
-// WithFieldMapper cannot be combined with WithPrefix
+// WithFieldMapper performs transformation on the field name; useful for canonicalization.
+// Field mappers, including those added by WithPrefix, are applied in the order
+// provided
 func WithFieldMapper(fn FieldMapperFunc) Option {
 	return func(o *options) {
-		o.mapField = fn
+		o.mapField = ChainMappers(o.mapField, fn)
 	}
 }
 
-// WithPrefix applies a prefix to each enrichment prior to the enrichment
-// WithPrefix cannot be combined with WithFieldMapper
+// WithPrefix applies a prefix to each enrichment prior to the enrichment.
+// WithPrefix composes with WithFieldMapper in the order provided
 func WithPrefix(prefix string) Option {
+	return WithFieldMapper(Prefix(prefix))
+}
+
+// WithMerge sets how enrichment values are combined with fields already present
+// on the record.  Defaults to MergeOverwrite
+func WithMerge(fn MergeFunc) Option {
 	return func(o *options) {
-		o.mapField = func(field string) (string, error) {
-			return prefix + field, nil
+		o.merge = fn
+	}
+}
+
+// SkipNotFound leaves records unchanged, rather than failing them, when the
+// DataSource does not find their key or the Geocoder their address
+func SkipNotFound() Option {
+	return func(o *options) {
+		o.skip = true
+	}
+}
+
+// WithDefaults enriches records whose key, or address, is not found with the
+// values provided, as if returned by the DataSource, rather than failing them
+func WithDefaults(values map[string]interface{}) Option {
+	var defaults map[string]interface{}
+	if values != nil {
+		defaults = make(map[string]interface{}, len(values))
+		for k, v := range values {
+			defaults[k] = v
 		}
 	}
+	return func(o *options) {
+		o.defaults = defaults
+	}
+}
+
+// WithRequired fails records whose enrichment lacks any of the fields or holds
+// nil for them.  Defaults provided by WithDefaults are not checked
+func WithRequired(fields ...string) Option {
+	fields = append([]string(nil), fields...)
+	return func(o *options) {
+		o.required = fields
+	}
+}
+
+// WithTarget stores the enrichment as a map[string]interface{} within field
+// rather than setting its fields on the record e.g. customer: {name: ...}.
+// WithFields, WithPrefix and WithFieldMapper apply to the keys of the map and
+// the merge policy to field as a whole
+func WithTarget(field string) Option {
+	return func(o *options) {
+		o.target = field
+		o.targetList = false
+	}
+}
+
+// WithTargetList stores the enrichment as a []map[string]interface{} within
+// field.  When the DataSource is a MultiDataSource, each of the rows found for
+// the key is included; otherwise the list holds the single record found
+func WithTargetList(field string) Option {
+	return func(o *options) {
+		o.target = field
+		o.targetList = true
+	}
 }
 
 func makeOptions(opts ...Option) options {
 	o := options{
 		mapField: defaultFieldMapper,
+		merge:    MergeOverwrite,
 	}
 	for _, opt := range opts {
 		opt(&o)
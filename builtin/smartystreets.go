@@ -0,0 +1,268 @@
+package builtin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// smartyStreetsMaxBatch is the most addresses SmartyStreets accepts per request
+const smartyStreetsMaxBatch = 100
+
+type batchOptions struct {
+	size    int
+	window  time.Duration
+	timeout time.Duration
+}
+
+// BatchOption provides functional options for batching geocoders
+type BatchOption func(*batchOptions)
+
+// WithBatchSize sets the maximum number of addresses sent per request
+func WithBatchSize(n int) BatchOption {
+	return func(o *batchOptions) {
+		o.size = n
+	}
+}
+
+// WithBatchWindow sets how long a Lookup waits for other lookups to join its
+// batch before the request is sent
+func WithBatchWindow(d time.Duration) BatchOption {
+	return func(o *batchOptions) {
+		o.window = d
+	}
+}
+
+// WithRequestTimeout bounds each request sent on behalf of grouped calls to
+// Lookup, which outlive the contexts of the individual callers.  Defaults to
+// 30s
+func WithRequestTimeout(d time.Duration) BatchOption {
+	return func(o *batchOptions) {
+		o.timeout = d
+	}
+}
+
+// SmartyStreetsBatch provides a SmartyStreets BatchGeocoder that POSTs up to
+// 100 addresses per request.  Concurrent calls to Lookup are grouped into a
+// single request once the batch size is reached or the batch window, 10ms by
+// default, has elapsed.  If a nil transport is provided, http.DefaultTransport
+// will be used
+func SmartyStreetsBatch(authID, authToken string, transport http.RoundTripper, opts ...BatchOption) BatchGeocoder {
+	options := batchOptions{
+		size:    smartyStreetsMaxBatch,
+		window:  10 * time.Millisecond,
+		timeout: 30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.size < 1 || options.size > smartyStreetsMaxBatch {
+		options.size = smartyStreetsMaxBatch
+	}
+	if options.timeout <= 0 {
+		options.timeout = 30 * time.Second
+	}
+
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &smartyStreetsBatch{
+		authID:    authID,
+		authToken: authToken,
+		transport: transport,
+		options:   options,
+	}
+}
+
+type smartyStreetsBatch struct {
+	authID    string
+	authToken string
+	transport http.RoundTripper
+	options   batchOptions
+
+	mutex      sync.Mutex
+	pending    []*lookup
+	timer      *time.Timer
+	generation uint64 // incremented as each batch is flushed
+}
+
+// lookup is a single call to Lookup awaiting its batch
+type lookup struct {
+	address Address
+	result  map[string]interface{}
+	err     error
+	done    chan struct{}
+}
+
+// Lookup implements Geocoder
+func (s *smartyStreetsBatch) Lookup(ctx context.Context, street, city, state string) (map[string]interface{}, error) {
+	if street == "" || state == "" {
+		return nil, nil
+	}
+
+	l := &lookup{
+		address: Address{Street: street, City: city, State: state},
+		done:    make(chan struct{}),
+	}
+
+	s.mutex.Lock()
+	s.pending = append(s.pending, l)
+	switch {
+	case len(s.pending) >= s.options.size:
+		s.flush()
+	case len(s.pending) == 1:
+		s.schedule()
+	}
+	s.mutex.Unlock()
+
+	select {
+	case <-l.done:
+		if l.err == nil && l.result == nil {
+			return nil, &addressNotFoundError{address: l.address}
+		}
+		return l.result, l.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// schedule flushes the pending lookups once the batch window has elapsed; must
+// be called with the mutex held
+func (s *smartyStreetsBatch) schedule() {
+	generation := s.generation
+	s.timer = time.AfterFunc(s.options.window, func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		// the batch may have been flushed while the timer waited on the mutex
+		if s.generation == generation {
+			s.flush()
+		}
+	})
+}
+
+// flush sends the pending lookups; must be called with the mutex held
+func (s *smartyStreetsBatch) flush() {
+	if len(s.pending) == 0 {
+		return
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+
+	batch := s.pending
+	s.pending = nil
+	s.generation++
+
+	go func() {
+		addresses := make([]Address, 0, len(batch))
+		for _, l := range batch {
+			addresses = append(addresses, l.address)
+		}
+
+		// the request outlives any single caller, each of which waits on its own
+		// context, so is bounded by the request timeout instead
+		ctx, cancel := context.WithTimeout(context.Background(), s.options.timeout)
+		defer cancel()
+
+		results, err := s.LookupMany(ctx, addresses)
+		for i, l := range batch {
+			if err != nil {
+				l.err = err
+			} else {
+				l.result = results[i]
+			}
+			close(l.done)
+		}
+	}()
+}
+
+// LookupMany implements BatchGeocoder.  Addresses are sent in requests of at
+// most the batch size; the result for an address without a match is nil
+func (s *smartyStreetsBatch) LookupMany(ctx context.Context, addresses []Address) ([]map[string]interface{}, error) {
+	results := make([]map[string]interface{}, 0, len(addresses))
+	for len(addresses) > 0 {
+		n := len(addresses)
+		if n > s.options.size {
+			n = s.options.size
+		}
+
+		chunk, err := s.post(ctx, addresses[:n])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, chunk...)
+		addresses = addresses[n:]
+	}
+	return results, nil
+}
+
+func (s *smartyStreetsBatch) post(ctx context.Context, addresses []Address) ([]map[string]interface{}, error) {
+	type Input struct {
+		Street     string `json:"street"`
+		City       string `json:"city,omitempty"`
+		State      string `json:"state"`
+		Candidates int    `json:"candidates"`
+	}
+
+	inputs := make([]Input, 0, len(addresses))
+	for _, address := range addresses {
+		inputs = append(inputs, Input{
+			Street:     address.Street,
+			City:       address.City,
+			State:      address.State,
+			Candidates: 1,
+		})
+	}
+
+	body, err := json.Marshal(inputs)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to encode smarty streets request: %w", err)
+	}
+
+	values := url.Values{}
+	values.Set("auth-id", s.authID)
+	values.Set("auth-token", s.authToken)
+
+	uri := "https://us-street.api.smartystreets.com/street-address?" + values.Encode()
+	req, err := http.NewRequest(http.MethodPost, uri, bytes.NewReader(body))
+	if err != nil {
+		return nil, xerrors.Errorf("unable to create smarty streets request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := s.transport.RoundTrip(req)
+	if err != nil {
+		return nil, xerrors.Errorf("smarty streets api call failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, xerrors.Errorf("smarty streets returned an invalid status code, %v", resp.StatusCode)
+	}
+
+	var candidates []smartyStreetsCandidate
+	if err := json.NewDecoder(resp.Body).Decode(&candidates); err != nil {
+		return nil, xerrors.Errorf("unable to decode smarty streets response: %w", err)
+	}
+
+	// addresses without a match are omitted from the response
+	results := make([]map[string]interface{}, len(addresses))
+	for _, candidate := range candidates {
+		if candidate.InputIndex < 0 || candidate.InputIndex >= len(addresses) {
+			return nil, xerrors.Errorf("smarty streets returned an invalid input_index, %v", candidate.InputIndex)
+		}
+		if results[candidate.InputIndex] == nil {
+			results[candidate.InputIndex] = candidate.fields()
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,285 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/savaki/dag"
+	"github.com/tj/assert"
+	"golang.org/x/xerrors"
+)
+
+// smartyStreetsBatchTransport answers each address whose street is not
+// "unknown" with a candidate echoing the street and records the requests made
+type smartyStreetsBatchTransport struct {
+	mutex    sync.Mutex
+	requests [][]map[string]interface{}
+	status   int
+}
+
+func (s *smartyStreetsBatchTransport) transport() http.RoundTripper {
+	return transportFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodPost {
+			return nil, fmt.Errorf("got %v; want POST", req.Method)
+		}
+		if req.URL.Query().Get("auth-id") != "id" || req.URL.Query().Get("auth-token") != "token" {
+			return nil, fmt.Errorf("missing auth")
+		}
+
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		var inputs []map[string]interface{}
+		if err := json.Unmarshal(data, &inputs); err != nil {
+			return nil, err
+		}
+
+		s.mutex.Lock()
+		s.requests = append(s.requests, inputs)
+		s.mutex.Unlock()
+
+		recorder := httptest.NewRecorder()
+		if s.status != 0 {
+			recorder.WriteHeader(s.status)
+			return recorder.Result(), nil
+		}
+
+		// respond in reverse order to exercise the demultiplexing
+		var candidates []map[string]interface{}
+		for i := len(inputs) - 1; i >= 0; i-- {
+			if inputs[i]["street"] == "unknown" {
+				continue
+			}
+			candidates = append(candidates, map[string]interface{}{
+				"input_index":     i,
+				"delivery_line_1": inputs[i]["street"],
+				"components":      map[string]interface{}{"state_abbreviation": inputs[i]["state"]},
+				"metadata":        map[string]interface{}{"latitude": float64(i)},
+			})
+		}
+		recorder.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(recorder).Encode(candidates)
+		return recorder.Result(), nil
+	})
+}
+
+func (s *smartyStreetsBatchTransport) sizes() []int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var sizes []int
+	for _, r := range s.requests {
+		sizes = append(sizes, len(r))
+	}
+	return sizes
+}
+
+func TestSmartyStreetsBatch(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("lookup many", func(t *testing.T) {
+		fake := &smartyStreetsBatchTransport{}
+		geocoder := SmartyStreetsBatch("id", "token", fake.transport(), WithBatchSize(2))
+
+		got, err := geocoder.LookupMany(ctx, []Address{
+			{Street: "a", City: "x", State: "CA"},
+			{Street: "unknown", State: "CA"},
+			{Street: "c", State: "NV"},
+		})
+		assert.Nil(t, err)
+		assert.Len(t, got, 3)
+		assert.Equal(t, "a", got[0]["street"])
+		assert.Equal(t, "CA", got[0]["state"])
+		assert.Nil(t, got[1])
+		assert.Equal(t, "c", got[2]["street"])
+		assert.Equal(t, 0.0, got[2]["latitude"]) // first of the second request
+
+		assert.Equal(t, []int{2, 1}, fake.sizes())
+		assert.Equal(t, map[string]interface{}{"street": "a", "city": "x", "state": "CA", "candidates": 1.0}, fake.requests[0][0])
+	})
+
+	t.Run("groups lookups by size", func(t *testing.T) {
+		fake := &smartyStreetsBatchTransport{}
+		geocoder := SmartyStreetsBatch("id", "token", fake.transport(), WithBatchSize(3), WithBatchWindow(time.Hour))
+
+		var wg sync.WaitGroup
+		got := make([]map[string]interface{}, 3)
+		for i := range got {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				v, err := geocoder.Lookup(ctx, fmt.Sprintf("street-%v", i), "", "CA")
+				assert.Nil(t, err)
+				got[i] = v
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Equal(t, []int{3}, fake.sizes())
+		for i, v := range got {
+			assert.Equal(t, fmt.Sprintf("street-%v", i), v["street"])
+		}
+	})
+
+	t.Run("groups lookups by window", func(t *testing.T) {
+		fake := &smartyStreetsBatchTransport{}
+		geocoder := SmartyStreetsBatch("id", "token", fake.transport(), WithBatchWindow(20*time.Millisecond))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := geocoder.Lookup(ctx, fmt.Sprintf("street-%v", i), "", "CA")
+				assert.Nil(t, err)
+			}(i)
+		}
+		wg.Wait()
+		assert.Equal(t, []int{2}, fake.sizes())
+	})
+
+	t.Run("missing address", func(t *testing.T) {
+		fake := &smartyStreetsBatchTransport{}
+		got, err := SmartyStreetsBatch("id", "token", fake.transport()).Lookup(ctx, "", "", "CA")
+		assert.Nil(t, err)
+		assert.Nil(t, got)
+		assert.Empty(t, fake.sizes())
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		fake := &smartyStreetsBatchTransport{}
+		geocoder := SmartyStreetsBatch("id", "token", fake.transport(), WithBatchWindow(time.Hour))
+
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := geocoder.Lookup(ctx, "a", "", "CA")
+		assert.Equal(t, context.Canceled, err)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		fake := &smartyStreetsBatchTransport{status: http.StatusUnauthorized}
+		geocoder := SmartyStreetsBatch("id", "token", fake.transport(), WithBatchWindow(time.Millisecond))
+
+		_, err := geocoder.Lookup(ctx, "a", "", "CA")
+		assert.EqualError(t, err, "smarty streets returned an invalid status code, 401")
+	})
+
+	t.Run("request timeout", func(t *testing.T) {
+		hung := transportFunc(func(req *http.Request) (*http.Response, error) {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		})
+		geocoder := SmartyStreetsBatch("id", "token", hung, WithBatchWindow(time.Millisecond), WithRequestTimeout(20*time.Millisecond))
+
+		_, err := geocoder.Lookup(ctx, "a", "", "CA")
+		assert.True(t, xerrors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("stale timer", func(t *testing.T) {
+		fake := &smartyStreetsBatchTransport{}
+		geocoder := SmartyStreetsBatch("id", "token", fake.transport(), WithBatchWindow(10*time.Millisecond)).(*smartyStreetsBatch)
+
+		first := make(chan error, 1)
+		go func() {
+			_, err := geocoder.Lookup(ctx, "a", "", "CA")
+			first <- err
+		}()
+		for {
+			geocoder.mutex.Lock()
+			if len(geocoder.pending) == 1 {
+				break
+			}
+			geocoder.mutex.Unlock()
+			time.Sleep(time.Millisecond)
+		}
+
+		// hold the mutex until the timer for the first batch is waiting on it,
+		// then flush that batch and begin the next as if by another Lookup
+		time.Sleep(30 * time.Millisecond)
+		geocoder.flush()
+		next := &lookup{address: Address{Street: "b", State: "CA"}, done: make(chan struct{})}
+		geocoder.options.window = time.Hour
+		geocoder.pending = append(geocoder.pending, next)
+		geocoder.schedule()
+		geocoder.mutex.Unlock()
+
+		assert.Nil(t, <-first)
+		time.Sleep(30 * time.Millisecond)
+		select {
+		case <-next.done:
+			t.Fatal("next batch flushed by the timer of the first")
+		default:
+		}
+		assert.Equal(t, []int{1}, fake.sizes())
+	})
+}
+
+func TestGeocode_ApplyBatch(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		fake     = &smartyStreetsBatchTransport{}
+		geocoder = SmartyStreetsBatch("id", "token", fake.transport())
+		task     = dag.Serial(Geocode("geocode", geocoder, "street", "city", "state", WithFields("latitude")))
+		in       = make(chan *dag.Record, 4)
+	)
+
+	for _, street := range []string{"a", "", "unknown", "d"} {
+		record := &dag.Record{}
+		record.Set("street", street)
+		record.Set("state", "CA")
+		in <- record
+	}
+	close(in)
+
+	var (
+		got  []map[string]interface{}
+		errs []error
+	)
+	runner := dag.NewRunner(task, dag.WithBatch(4, 0), dag.WithOrdered(4))
+	for result := range runner.Run(ctx, in) {
+		got = append(got, result.Record.Copy())
+		errs = append(errs, result.Err)
+	}
+	assert.Nil(t, errs[0])
+	assert.Nil(t, errs[1])
+	assert.True(t, IsNotFound(errs[2]))
+	assert.Contains(t, errs[2].Error(), "address not found, unknown, CA")
+	assert.Nil(t, errs[3])
+
+	assert.Equal(t, []int{3}, fake.sizes())
+	assert.Equal(t, []map[string]interface{}{
+		{"street": "a", "state": "CA", "latitude": 0.0},
+		{"street": "", "state": "CA"},
+		{"street": "unknown", "state": "CA"},
+		{"street": "d", "state": "CA", "latitude": 2.0},
+	}, got)
+
+	t.Run("skip not found", func(t *testing.T) {
+		task := Geocode("geocode", geocoder, "street", "city", "state", SkipNotFound()).(dag.BatchTask)
+
+		record := &dag.Record{}
+		record.Set("street", "unknown")
+		record.Set("state", "CA")
+		assert.Nil(t, task.ApplyBatch(ctx, []*dag.Record{record}))
+		assert.Equal(t, map[string]interface{}{"street": "unknown", "state": "CA"}, record.Copy())
+	})
+
+	t.Run("geocoder error", func(t *testing.T) {
+		failing := &smartyStreetsBatchTransport{status: http.StatusInternalServerError}
+		task := Geocode("geocode", SmartyStreetsBatch("id", "token", failing.transport()), "street", "city", "state").(dag.BatchTask)
+
+		record := &dag.Record{}
+		record.Set("street", "a")
+		record.Set("state", "CA")
+		err := task.ApplyBatch(ctx, []*dag.Record{record, record})
+		assert.NotNil(t, err)
+	})
+}
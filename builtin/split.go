@@ -0,0 +1,60 @@
+package builtin
+
+import (
+	"context"
+
+	"github.com/savaki/dag"
+	"golang.org/x/xerrors"
+)
+
+// SplitField returns a dag.Splitter that creates one child record per element
+// of the list held in field.  Each child holds the parent's other fields; map
+// elements are merged into the child while other elements are stored in field.
+// Nested maps and slices are copied so children may be modified concurrently
+func SplitField(field string) dag.Splitter {
+	return dag.SplitterFunc(func(ctx context.Context, record *dag.Record) ([]map[string]interface{}, error) {
+		raw, err := record.Get(field)
+		if err != nil {
+			if dag.IsFieldNotFoundError(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		var items []interface{}
+		switch v := raw.(type) {
+		case []interface{}:
+			items = v
+		case []map[string]interface{}:
+			for _, item := range v {
+				items = append(items, item)
+			}
+		case []string:
+			for _, item := range v {
+				items = append(items, item)
+			}
+		default:
+			return nil, xerrors.Errorf("unable to split field, %v: expected a list; got %T", field, raw)
+		}
+
+		parent := record.Copy()
+		delete(parent, field)
+
+		contents := make([]map[string]interface{}, 0, len(items))
+		for _, item := range items {
+			content := make(map[string]interface{}, len(parent)+1)
+			for k, v := range parent {
+				content[k] = deepCopy(v)
+			}
+			if m, ok := item.(map[string]interface{}); ok {
+				for k, v := range m {
+					content[k] = deepCopy(v)
+				}
+			} else {
+				content[field] = deepCopy(item)
+			}
+			contents = append(contents, content)
+		}
+		return contents, nil
+	})
+}
@@ -0,0 +1,74 @@
+package builtin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/savaki/dag"
+	"github.com/tj/assert"
+)
+
+func TestSplitField(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		splitter = SplitField("members")
+	)
+
+	t.Run("maps", func(t *testing.T) {
+		record := &dag.Record{}
+		record.Set("household", "h1")
+		record.Set("members", []interface{}{
+			map[string]interface{}{"name": "joe"},
+			map[string]interface{}{"name": "sue", "household": "override"},
+		})
+
+		got, err := splitter.Split(ctx, record)
+		assert.Nil(t, err)
+		assert.Equal(t, []map[string]interface{}{
+			{"household": "h1", "name": "joe"},
+			{"household": "override", "name": "sue"},
+		}, got)
+	})
+
+	t.Run("values", func(t *testing.T) {
+		record := &dag.Record{}
+		record.Set("members", []string{"joe", "sue"})
+
+		got, err := splitter.Split(ctx, record)
+		assert.Nil(t, err)
+		assert.Equal(t, []map[string]interface{}{{"members": "joe"}, {"members": "sue"}}, got)
+	})
+
+	t.Run("nested values are copied", func(t *testing.T) {
+		record := &dag.Record{}
+		record.Set("address", map[string]interface{}{"tags": []interface{}{"home"}})
+		record.Set("members", []interface{}{
+			map[string]interface{}{"name": "joe", "pets": []string{"rex"}},
+			"sue",
+		})
+
+		got, err := splitter.Split(ctx, record)
+		assert.Nil(t, err)
+		got[0]["address"].(map[string]interface{})["tags"].([]interface{})[0] = "work"
+		got[0]["pets"].([]string)[0] = "fido"
+
+		assert.Equal(t, "home", got[1]["address"].(map[string]interface{})["tags"].([]interface{})[0])
+		v, _ := record.Get("address")
+		assert.Equal(t, map[string]interface{}{"tags": []interface{}{"home"}}, v)
+		v, _ = record.Get("members")
+		assert.Equal(t, []string{"rex"}, v.([]interface{})[0].(map[string]interface{})["pets"])
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		got, err := splitter.Split(ctx, &dag.Record{})
+		assert.Nil(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("not a list", func(t *testing.T) {
+		record := &dag.Record{}
+		record.Set("members", "joe")
+		_, err := splitter.Split(ctx, record)
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,251 @@
+package builtin
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// keysPlaceholder is replaced by the placeholders for each key within a batch
+// query
+const keysPlaceholder = "{keys}"
+
+// sqlMaxBatch bounds the number of keys bound to a single batch query
+const sqlMaxBatch = 500
+
+// Placeholder returns the bind parameter for the nth, starting at 1, argument
+// of a query
+type Placeholder func(n int) string
+
+var (
+	// QuestionPlaceholder binds arguments with ? as used by SQLite and MySQL
+	QuestionPlaceholder Placeholder = func(int) string { return "?" }
+	// DollarPlaceholder binds arguments with $1, $2, ... as used by Postgres
+	DollarPlaceholder Placeholder = func(n int) string { return "$" + strconv.Itoa(n) }
+)
+
+type sqlOptions struct {
+	batchQuery  string
+	keyColumn   string
+	placeholder Placeholder
+}
+
+// SQLOption provides functional options for SQLDataSource
+type SQLOption func(*sqlOptions)
+
+// WithBatchQuery provides the query used by GetMany.  The query must contain
+// {keys}, which is replaced by a placeholder for each key, and return keyColumn
+// so that rows can be matched to keys e.g.
+//
+//	SELECT id, name FROM users WHERE id IN ({keys})
+func WithBatchQuery(query, keyColumn string) SQLOption {
+	return func(o *sqlOptions) {
+		o.batchQuery = query
+		o.keyColumn = keyColumn
+	}
+}
+
+// WithPlaceholder sets the bind parameter style used to expand the batch
+// query.  Defaults to QuestionPlaceholder
+func WithPlaceholder(placeholder Placeholder) SQLOption {
+	return func(o *sqlOptions) {
+		o.placeholder = placeholder
+	}
+}
+
+type sqlDataSource struct {
+	db      *sql.DB
+	query   string
+	options sqlOptions
+}
+
+// SQLDataSource returns a DataSource that runs query, which must take the key
+// as its only parameter, and returns the first row as a map of column name to
+// value e.g.
+//
+//	SELECT name, age FROM users WHERE id = ?
+//
+// Values take the Go type provided by the driver, typically int64, float64,
+// bool, string, time.Time or []byte; text returned as []byte is converted to a
+// string.  A query that returns no rows is reported as not found.  Without
+// WithBatchQuery, GetMany runs query once per key.  The DataSource is also a
+// MultiDataSource whose GetAll returns every row, for use with WithTargetList
+func SQLDataSource(db *sql.DB, query string, opts ...SQLOption) BatchDataSource {
+	options := sqlOptions{
+		placeholder: QuestionPlaceholder,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &sqlDataSource{
+		db:      db,
+		query:   query,
+		options: options,
+	}
+}
+
+// Get implements DataSource
+func (s *sqlDataSource) Get(ctx context.Context, key string) (map[string]interface{}, error) {
+	rows, err := s.db.QueryContext(ctx, s.query, key)
+	if err != nil {
+		return nil, xerrors.Errorf("query for key, %v, failed: %w", key, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, xerrors.Errorf("query for key, %v, failed: %w", key, err)
+		}
+		return nil, &notFoundError{key: key}
+	}
+
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, xerrors.Errorf("unable to read columns: %w", err)
+	}
+	return scanRow(rows, columns)
+}
+
+// GetAll implements MultiDataSource
+func (s *sqlDataSource) GetAll(ctx context.Context, key string) ([]map[string]interface{}, error) {
+	rows, err := s.db.QueryContext(ctx, s.query, key)
+	if err != nil {
+		return nil, xerrors.Errorf("query for key, %v, failed: %w", key, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, xerrors.Errorf("unable to read columns: %w", err)
+	}
+
+	var results []map[string]interface{}
+	for rows.Next() {
+		row, err := scanRow(rows, columns)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.Errorf("query for key, %v, failed: %w", key, err)
+	}
+	if len(results) == 0 {
+		return nil, &notFoundError{key: key}
+	}
+	return results, nil
+}
+
+// GetMany implements BatchDataSource
+func (s *sqlDataSource) GetMany(ctx context.Context, keys []string) (map[string]map[string]interface{}, error) {
+	found := map[string]map[string]interface{}{}
+
+	if s.options.batchQuery == "" {
+		for _, key := range keys {
+			v, err := s.Get(ctx, key)
+			if err != nil {
+				if IsNotFound(err) {
+					continue
+				}
+				return nil, err
+			}
+			found[key] = v
+		}
+		return found, nil
+	}
+
+	if !strings.Contains(s.options.batchQuery, keysPlaceholder) {
+		return nil, xerrors.Errorf("invalid batch query, %v: missing %v", s.options.batchQuery, keysPlaceholder)
+	}
+
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > sqlMaxBatch {
+			n = sqlMaxBatch
+		}
+		if err := s.getMany(ctx, keys[:n], found); err != nil {
+			return nil, err
+		}
+		keys = keys[n:]
+	}
+	return found, nil
+}
+
+// getMany runs the batch query for keys adding the first row for each key to
+// found
+func (s *sqlDataSource) getMany(ctx context.Context, keys []string, found map[string]map[string]interface{}) error {
+	var (
+		placeholders = make([]string, 0, len(keys))
+		args         = make([]interface{}, 0, len(keys))
+	)
+	for i, key := range keys {
+		placeholders = append(placeholders, s.options.placeholder(i+1))
+		args = append(args, key)
+	}
+	query := strings.Replace(s.options.batchQuery, keysPlaceholder, strings.Join(placeholders, ", "), 1)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return xerrors.Errorf("batch query for %v keys failed: %w", len(keys), err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return xerrors.Errorf("unable to read columns: %w", err)
+	}
+
+	for rows.Next() {
+		row, err := scanRow(rows, columns)
+		if err != nil {
+			return err
+		}
+
+		v, ok := row[s.options.keyColumn]
+		if !ok {
+			return xerrors.Errorf("batch query did not return key column, %v", s.options.keyColumn)
+		}
+		if key := toString(v); found[key] == nil {
+			found[key] = row
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return xerrors.Errorf("batch query for %v keys failed: %w", len(keys), err)
+	}
+	return nil
+}
+
+// scanRow returns the current row as a map of column name to value
+func scanRow(rows *sql.Rows, columns []*sql.ColumnType) (map[string]interface{}, error) {
+	var (
+		values = make([]interface{}, len(columns))
+		dest   = make([]interface{}, len(columns))
+	)
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, xerrors.Errorf("unable to scan row: %w", err)
+	}
+
+	row := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		v := values[i]
+		if data, ok := v.([]byte); ok && !isBinaryColumn(column) {
+			v = string(data)
+		}
+		row[column.Name()] = v
+	}
+	return row, nil
+}
+
+// isBinaryColumn reports whether the column holds binary, rather than text,
+// data
+func isBinaryColumn(column *sql.ColumnType) bool {
+	name := strings.ToUpper(column.DatabaseTypeName())
+	return strings.Contains(name, "BLOB") || strings.Contains(name, "BINARY") || name == "BYTEA"
+}
@@ -0,0 +1,173 @@
+package builtin
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/savaki/dag"
+	"github.com/tj/assert"
+	_ "modernc.org/sqlite"
+)
+
+func newSQLDatabase(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.Nil(t, err)
+	db.SetMaxOpenConns(1) // each connection to :memory: is a separate database
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE users (
+			id      TEXT PRIMARY KEY,
+			name    TEXT,
+			age     INTEGER,
+			score   REAL,
+			avatar  BLOB,
+			created DATETIME
+		);
+		INSERT INTO users VALUES ('a', 'alpha', 21, 1.5, x'0102', '2020-01-02 03:04:05');
+		INSERT INTO users VALUES ('b', 'bravo', NULL, NULL, NULL, NULL);
+		INSERT INTO users VALUES ('3', 'three', 3, 3, NULL, NULL);
+	`)
+	assert.Nil(t, err)
+	return db
+}
+
+func TestSQLDataSource(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("get", func(t *testing.T) {
+		ds := SQLDataSource(newSQLDatabase(t), "SELECT name, age, score, avatar, created FROM users WHERE id = ?")
+
+		v, err := ds.Get(ctx, "a")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"name":    "alpha",
+			"age":     int64(21),
+			"score":   1.5,
+			"avatar":  []byte{1, 2},
+			"created": time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		}, v)
+
+		v, err = ds.Get(ctx, "b")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"name":    "bravo",
+			"age":     nil,
+			"score":   nil,
+			"avatar":  nil,
+			"created": nil,
+		}, v)
+	})
+
+	t.Run("no rows", func(t *testing.T) {
+		ds := SQLDataSource(newSQLDatabase(t), "SELECT name FROM users WHERE id = ?")
+		_, err := ds.Get(ctx, "missing")
+		assert.True(t, IsNotFound(err))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ds := SQLDataSource(newSQLDatabase(t), "SELECT name FROM nope WHERE id = ?")
+		_, err := ds.Get(ctx, "a")
+		assert.NotNil(t, err)
+		assert.False(t, IsNotFound(err))
+	})
+
+	t.Run("get many", func(t *testing.T) {
+		db := newSQLDatabase(t)
+		ds := SQLDataSource(db, "SELECT id, name FROM users WHERE id = ?",
+			WithBatchQuery("SELECT id, name FROM users WHERE id IN ({keys})", "id"),
+		)
+
+		found, err := ds.GetMany(ctx, []string{"a", "missing", "3"})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]map[string]interface{}{
+			"a": {"id": "a", "name": "alpha"},
+			"3": {"id": "3", "name": "three"},
+		}, found)
+	})
+
+	t.Run("get many by numeric key", func(t *testing.T) {
+		ds := SQLDataSource(newSQLDatabase(t), "SELECT age, name FROM users WHERE age = ?",
+			WithBatchQuery("SELECT age, name FROM users WHERE age IN ({keys})", "age"),
+		)
+
+		found, err := ds.GetMany(ctx, []string{"21", "3"})
+		assert.Nil(t, err)
+		assert.Equal(t, "alpha", found["21"]["name"])
+		assert.Equal(t, "three", found["3"]["name"])
+	})
+
+	t.Run("get many without batch query", func(t *testing.T) {
+		ds := SQLDataSource(newSQLDatabase(t), "SELECT name FROM users WHERE id = ?")
+
+		found, err := ds.GetMany(ctx, []string{"a", "missing"})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]map[string]interface{}{"a": {"name": "alpha"}}, found)
+	})
+
+	t.Run("invalid batch query", func(t *testing.T) {
+		db := newSQLDatabase(t)
+
+		ds := SQLDataSource(db, "SELECT id FROM users WHERE id = ?",
+			WithBatchQuery("SELECT id FROM users WHERE id IN (?)", "id"),
+		)
+		_, err := ds.GetMany(ctx, []string{"a"})
+		assert.NotNil(t, err)
+
+		ds = SQLDataSource(db, "SELECT id FROM users WHERE id = ?",
+			WithBatchQuery("SELECT name FROM users WHERE id IN ({keys})", "id"),
+		)
+		_, err = ds.GetMany(ctx, []string{"a"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("placeholder", func(t *testing.T) {
+		assert.Equal(t, "?", QuestionPlaceholder(2))
+		assert.Equal(t, "$2", DollarPlaceholder(2))
+
+		ds := SQLDataSource(newSQLDatabase(t), "SELECT id FROM users WHERE id = $1",
+			WithBatchQuery("SELECT id FROM users WHERE id IN ({keys})", "id"),
+			WithPlaceholder(DollarPlaceholder),
+		)
+		found, err := ds.GetMany(ctx, []string{"a", "b"})
+		assert.Nil(t, err)
+		assert.Len(t, found, 2)
+	})
+
+	t.Run("get all", func(t *testing.T) {
+		db := newSQLDatabase(t)
+		ds := SQLDataSource(db, "SELECT name FROM users WHERE age >= ? ORDER BY name").(MultiDataSource)
+
+		rows, err := ds.GetAll(ctx, "3")
+		assert.Nil(t, err)
+		assert.Equal(t, []map[string]interface{}{{"name": "alpha"}, {"name": "three"}}, rows)
+
+		_, err = ds.GetAll(ctx, "100")
+		assert.True(t, IsNotFound(err))
+
+		record := &dag.Record{}
+		record.Set("min_age", "3")
+		task := Enrich("enrich", ds, BasicKeyFunc("min_age"), WithTargetList("users"))
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, rows, record.Copy()["users"])
+	})
+
+	t.Run("enrich batch", func(t *testing.T) {
+		ds := SQLDataSource(newSQLDatabase(t), "SELECT id, name FROM users WHERE id = ?",
+			WithBatchQuery("SELECT id, name FROM users WHERE id IN ({keys})", "id"),
+		)
+		task := Enrich("enrich", ds, BasicKeyFunc("id"), WithFields("name")).(dag.BatchTask)
+
+		var records []*dag.Record
+		for _, id := range []string{"a", "b"} {
+			record := &dag.Record{}
+			record.Set("id", id)
+			records = append(records, record)
+		}
+		assert.Nil(t, task.ApplyBatch(ctx, records))
+		assert.Equal(t, "alpha", records[0].Copy()["name"])
+		assert.Equal(t, "bravo", records[1].Copy()["name"])
+	})
+}
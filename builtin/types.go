@@ -2,19 +2,62 @@ package builtin
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 
 	"github.com/savaki/dag"
+	"golang.org/x/xerrors"
 )
 
+// ErrNotFound indicates a DataSource has no record for a key.  DataSources
+// should return an error that wraps ErrNotFound so that callers, such as
+// CachedDataSource, can distinguish missing records from failures
+var ErrNotFound = errors.New("not found")
+
+// IsNotFound reports whether the error indicates the key was not found
+func IsNotFound(err error) bool {
+	return xerrors.Is(err, ErrNotFound)
+}
+
+// notFoundError reports the key that was not found
+type notFoundError struct {
+	key string
+}
+
+func (e *notFoundError) Error() string {
+	return fmt.Sprintf("key, %v, not found", e.key)
+}
+
+func (e *notFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
 // DataSource provides an abstraction for a remote data source for enrichment
 type DataSource interface {
 	// Get the record from the remote data source
 	Get(ctx context.Context, key string) (map[string]interface{}, error)
 }
 
+// BatchDataSource is a DataSource that can retrieve many records in one call
+type BatchDataSource interface {
+	DataSource
+
+	// GetMany returns the records found for the keys, indexed by key.  Keys
+	// that are not found are omitted
+	GetMany(ctx context.Context, keys []string) (map[string]map[string]interface{}, error)
+}
+
+// MultiDataSource is a DataSource that may hold many rows for a key
+type MultiDataSource interface {
+	DataSource
+
+	// GetAll returns every row for the key.  If there are none, GetAll returns
+	// an error wrapping ErrNotFound
+	GetAll(ctx context.Context, key string) ([]map[string]interface{}, error)
+}
+
 // KeyFunc constructs a lookup key given a record.  Returns nil if the fields are not found
 type KeyFunc func(record *dag.Record) (string, error)
 
@@ -66,12 +109,23 @@ type NestedMapDataSource map[string]map[string]interface{}
 func (s NestedMapDataSource) Get(ctx context.Context, key string) (map[string]interface{}, error) {
 	m, ok := s[key]
 	if !ok {
-		return nil, fmt.Errorf("key, %v, not found", key)
+		return nil, &notFoundError{key: key}
 	}
 
 	return m, nil
 }
 
+// GetMany implements BatchDataSource
+func (s NestedMapDataSource) GetMany(ctx context.Context, keys []string) (map[string]map[string]interface{}, error) {
+	found := map[string]map[string]interface{}{}
+	for _, key := range keys {
+		if m, ok := s[key]; ok {
+			found[key] = m
+		}
+	}
+	return found, nil
+}
+
 func toString(raw interface{}) string {
 	switch v := raw.(type) {
 	case string:
@@ -24,3 +24,60 @@ func (fn transportFunc) RoundTrip(req *http.Request) (*http.Response, error) {
 func withName(name string, target dag.TaskFunc) dag.NamedTask {
 	return dag.WithName(name, target)
 }
+
+// batchError returns a *dag.BatchError if any of the errs are non-nil
+func batchError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return &dag.BatchError{Errs: errs}
+		}
+	}
+	return nil
+}
+
+// deepCopy returns a copy of v in which nested maps and slices are copied too
+// so that the copy may be modified independently of v
+func deepCopy(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		dupe := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			dupe[k] = deepCopy(item)
+		}
+		return dupe
+	case []interface{}:
+		dupe := make([]interface{}, len(value))
+		for i, item := range value {
+			dupe[i] = deepCopy(item)
+		}
+		return dupe
+	case []map[string]interface{}:
+		dupe := make([]map[string]interface{}, len(value))
+		for i, item := range value {
+			dupe[i], _ = deepCopy(item).(map[string]interface{})
+		}
+		return dupe
+	case []string:
+		return append([]string(nil), value...)
+	default:
+		return v
+	}
+}
+
+// isEmpty reports whether v is nil, an empty string, or an empty slice or map
+func isEmpty(v interface{}) bool {
+	switch value := v.(type) {
+	case nil:
+		return true
+	case string:
+		return value == ""
+	case []interface{}:
+		return len(value) == 0
+	case []string:
+		return len(value) == 0
+	case map[string]interface{}:
+		return len(value) == 0
+	default:
+		return false
+	}
+}
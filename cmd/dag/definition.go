@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+
+	"github.com/savaki/dag"
+	"github.com/savaki/dag/pipeline"
+	"golang.org/x/xerrors"
+)
+
+// loadPipeline reads and builds the pipeline definition at path with the data
+// sources named on the command line
+func loadPipeline(path string, sources *sourceFlags) (*pipeline.Definition, dag.Task, error) {
+	if path == "" {
+		return nil, nil, xerrors.New("-pipeline is required")
+	}
+
+	registry, err := sources.registry()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("unable to open pipeline: %w", err)
+	}
+	defer f.Close()
+
+	def, err := pipeline.Load(f)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("%v: %w", path, err)
+	}
+
+	task, err := def.Build(registry)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("%v: %w", path, err)
+	}
+
+	return def, task, nil
+}
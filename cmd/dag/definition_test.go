@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/savaki/dag"
+	"github.com/tj/assert"
+)
+
+func TestLoadPipeline(t *testing.T) {
+	var (
+		ctx = context.Background()
+		dir = t.TempDir()
+	)
+
+	t.Run("build", func(t *testing.T) {
+		path := writeFile(t, dir, "people.yaml", `name: people
+steps:
+  - type: canonicalize
+    label: lower
+    mapper: lower
+  - parallel:
+      - type: normalize
+        field: name
+        mapper: upper
+      - type: delete
+        fields: [ssn]
+`)
+		def, task, err := loadPipeline(path, &sourceFlags{})
+		assert.Nil(t, err)
+		assert.Equal(t, "people", def.Name)
+		assert.Equal(t, "people", dag.Name(task))
+
+		record := &dag.Record{}
+		record.Set("Name", "joe")
+		record.Set("SSN", "123")
+		err = task.Apply(ctx, record)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{"name": "JOE"}, record.Copy())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		path := writeFile(t, dir, "invalid.yaml", "name: invalid\nsteps:\n  - type: blah\n")
+		tests := map[string]string{
+			"":                              "-pipeline is required",
+			filepath.Join(dir, "none.yaml"): "unable to open pipeline",
+			path:                            path + ": line 3: steps[0]: unknown type, blah",
+		}
+		for path, want := range tests {
+			_, _, err := loadPipeline(path, &sourceFlags{})
+			assert.NotNil(t, err)
+			assert.Contains(t, err.Error(), want)
+		}
+	})
+}
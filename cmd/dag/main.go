@@ -0,0 +1,409 @@
+// Command dag runs pipeline definitions over files of records.
+//
+// Usage:
+//
+//	dag run -pipeline pipeline.yaml [flags] [files...]
+//	dag graph -pipeline pipeline.yaml
+//	dag validate -pipeline pipeline.yaml
+//
+// Records are read from the named files, or stdin if none are provided, and the
+// results are written to stdout.  Records that fail are written, along with the
+// details of the task that failed, to the rejects file.  Dropped records are
+// discarded.
+//
+// Data sources used by enrich steps may be registered with the -datasource and
+// -http-datasource flags e.g.
+//
+//	dag run -pipeline pipeline.yaml -datasource states=states.csv:code people.csv
+//
+// SQL data sources and geocoders require code to construct; register them with
+// the pipeline package in a command of your own.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/savaki/dag"
+	"github.com/savaki/dag/recordio"
+	"golang.org/x/xerrors"
+)
+
+const usage = `usage: dag <command> [flags]
+
+commands:
+  run       run a pipeline over records read from files or stdin
+  graph     render a pipeline in the graphviz dot language
+  validate  check a pipeline definition
+
+Run "dag <command> -h" for the flags of each command.
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "run":
+		return runCommand(ctx, args[1:], stdin, stdout, stderr)
+	case "graph":
+		return graphCommand(args[1:], stdout, stderr)
+	case "validate":
+		return validateCommand(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "dag: unknown command, %v\n\n%v", args[0], usage)
+		return 2
+	}
+}
+
+func graphCommand(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("graph", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	path := fs.String("pipeline", "", "path to the yaml or json pipeline definition")
+	var sources sourceFlags
+	sources.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	_, task, err := loadPipeline(*path, &sources)
+	if err != nil {
+		fmt.Fprintf(stderr, "dag graph: %v\n", err)
+		return 1
+	}
+
+	if err := dag.WriteDOT(stdout, task); err != nil {
+		fmt.Fprintf(stderr, "dag graph: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func validateCommand(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	path := fs.String("pipeline", "", "path to the yaml or json pipeline definition")
+	var sources sourceFlags
+	sources.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if _, _, err := loadPipeline(*path, &sources); err != nil {
+		fmt.Fprintf(stderr, "dag validate: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "%v: ok\n", *path)
+	return 0
+}
+
+type runConfig struct {
+	pipeline     string
+	format       string
+	outputFormat string
+	workers      int
+	ordered      bool
+	rejects      string
+	idField      string
+	infer        bool
+	sources      sourceFlags
+}
+
+func runCommand(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var config runConfig
+
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&config.pipeline, "pipeline", "", "path to the yaml or json pipeline definition")
+	fs.StringVar(&config.format, "format", "", "input format: jsonl, csv or tsv; defaults to the file extension or jsonl")
+	fs.StringVar(&config.outputFormat, "output-format", "", "output format: jsonl, csv or tsv; defaults to the input format")
+	fs.IntVar(&config.workers, "workers", runtime.NumCPU(), "number of records to process concurrently")
+	fs.BoolVar(&config.ordered, "ordered", false, "write records in the order they were read")
+	fs.StringVar(&config.rejects, "rejects", "", "path to write failed records as json lines")
+	fs.StringVar(&config.idField, "id-field", "", "field containing the record id; defaults to the line number, prefixed by the file name when reading more than one file")
+	fs.BoolVar(&config.infer, "infer", false, "infer numeric and boolean csv and tsv column types")
+	config.sources.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	failed, err := runPipeline(ctx, config, fs.Args(), stdin, stdout, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "dag run: %v\n", err)
+		return 1
+	}
+	if failed > 0 && config.rejects == "" {
+		return 1
+	}
+	return 0
+}
+
+// runPipeline returns the number of failed records
+func runPipeline(ctx context.Context, config runConfig, files []string, stdin io.Reader, stdout, stderr io.Writer) (uint64, error) {
+	def, task, err := loadPipeline(config.pipeline, &config.sources)
+	if err != nil {
+		return 0, err
+	}
+
+	if config.format == "" {
+		config.format = "jsonl"
+		if len(files) > 0 {
+			// unrecognized extensions, e.g. .txt, are read as json lines
+			ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(files[0]), "."))
+			if _, err := sourceFactory(ext); err == nil {
+				config.format = ext
+			}
+		}
+	}
+	if config.outputFormat == "" {
+		config.outputFormat = config.format
+	}
+
+	var opts []recordio.Option
+	if config.idField != "" {
+		opts = append(opts, recordio.WithIDField(config.idField))
+	}
+	if config.infer {
+		opts = append(opts, recordio.WithTypeInference())
+	}
+
+	newSource, err := sourceFactory(config.format)
+	if err != nil {
+		return 0, err
+	}
+	sink, err := newSink(config.outputFormat, stdout, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	var rejects *json.Encoder
+	if config.rejects != "" {
+		f, err := os.Create(config.rejects)
+		if err != nil {
+			return 0, xerrors.Errorf("unable to create rejects file: %w", err)
+		}
+		defer f.Close()
+		rejects = json.NewEncoder(f)
+	}
+
+	runnerOpts := []dag.RunnerOption{dag.WithWorkers(config.workers)}
+	if config.ordered {
+		runnerOpts = append(runnerOpts, dag.WithOrdered(4*config.workers))
+	}
+
+	var (
+		source = &multiSource{
+			files:     files,
+			stdin:     stdin,
+			newSource: newSource,
+			opts:      opts,
+			prefix:    config.idField == "" && len(files) > 1,
+		}
+		runner = dag.NewRunner(dag.Wrap(task, dag.Recover, dag.Annotate), runnerOpts...)
+		fatal  error
+	)
+	defer source.Close()
+
+	for result := range runner.RunIterator(ctx, source) {
+		switch {
+		case result.Record == nil:
+			fatal = result.Err
+
+		case result.Dropped():
+			continue
+
+		case result.Err != nil:
+			if rejects == nil {
+				fmt.Fprintf(stderr, "%v\n", result.Err)
+				continue
+			}
+			if err := rejects.Encode(newReject(result)); err != nil && fatal == nil {
+				fatal = xerrors.Errorf("unable to write reject: %w", err)
+			}
+
+		default:
+			if err := sink.Write(ctx, result.Record); err != nil && fatal == nil {
+				fatal = err
+			}
+		}
+	}
+
+	if err := sink.Flush(); err != nil && fatal == nil {
+		fatal = err
+	}
+
+	stats := runner.Stats()
+	fmt.Fprintf(stderr, "%v: processed %v records (%v succeeded, %v failed, %v dropped) in %v; %.1f records/sec\n",
+		def.Name, stats.Processed, stats.Succeeded, stats.Failed, stats.Dropped, stats.Elapsed, stats.Throughput())
+
+	return stats.Failed, fatal
+}
+
+// reject is written to the rejects file for each failed record
+type reject struct {
+	ID     string                 `json:"id"`
+	Record map[string]interface{} `json:"record"`
+	Error  string                 `json:"error"`
+	Task   string                 `json:"task,omitempty"`
+	Path   string                 `json:"path,omitempty"`
+}
+
+func newReject(result dag.Result) reject {
+	r := reject{
+		ID:     result.Record.Meta().ID,
+		Record: result.Record.Copy(),
+		Error:  result.Err.Error(),
+	}
+
+	var te *dag.TaskError
+	if xerrors.As(result.Err, &te) {
+		r.Error = te.Err.Error()
+		r.Task = te.Task
+		r.Path = strings.Join(te.Path, "/")
+	}
+
+	return r
+}
+
+func sourceFactory(format string) (func(io.Reader, ...recordio.Option) recordio.Source, error) {
+	switch format {
+	case "jsonl", "json", "ndjson":
+		return recordio.NewJSONLinesSource, nil
+	case "csv":
+		return recordio.NewCSVSource, nil
+	case "tsv":
+		return recordio.NewTSVSource, nil
+	default:
+		return nil, xerrors.Errorf("unsupported format, %v", format)
+	}
+}
+
+func newSink(format string, w io.Writer, opts ...recordio.Option) (recordio.Sink, error) {
+	switch format {
+	case "jsonl", "json", "ndjson":
+		return recordio.NewJSONLinesSink(w, opts...), nil
+	case "csv":
+		return recordio.NewCSVSink(w, opts...), nil
+	case "tsv":
+		return recordio.NewTSVSink(w, opts...), nil
+	default:
+		return nil, xerrors.Errorf("unsupported output format, %v", format)
+	}
+}
+
+// multiSource reads each of the files in turn or stdin if no files were given
+type multiSource struct {
+	files     []string
+	stdin     io.Reader
+	newSource func(io.Reader, ...recordio.Option) recordio.Source
+	opts      []recordio.Option
+	prefix    bool // prefix ids with the file name so they are unique across files
+
+	started bool
+	name    string // name of the current file
+	current recordio.Source
+	closer  io.Closer
+}
+
+// Next implements dag.Iterator
+func (m *multiSource) Next(ctx context.Context) (*dag.Record, error) {
+	for {
+		if m.current == nil {
+			if err := m.open(); err != nil {
+				return nil, err
+			}
+		}
+
+		record, err := m.current.Next(ctx)
+		if err == io.EOF {
+			m.Close()
+			m.current = nil
+			continue
+		}
+		if err != nil || !m.prefix {
+			return record, err
+		}
+		return m.withFile(record), nil
+	}
+}
+
+// withFile returns a copy of record whose id is prefixed by the current file
+// name e.g. people.csv:2
+func (m *multiSource) withFile(record *dag.Record) *dag.Record {
+	meta := record.Meta()
+	meta.ID = m.name + ":" + meta.ID
+
+	properties := make(map[string]string, len(meta.Properties)+1)
+	for k, v := range meta.Properties {
+		properties[k] = v
+	}
+	properties["file"] = m.name
+	meta.Properties = properties
+
+	dupe := dag.NewRecord(meta)
+	for k, v := range record.Copy() {
+		dupe.Set(k, v)
+	}
+	return dupe
+}
+
+func (m *multiSource) open() error {
+	if !m.started && len(m.files) == 0 {
+		m.started = true
+		m.current = m.newSource(m.stdin, m.opts...)
+		return nil
+	}
+	m.started = true
+
+	if len(m.files) == 0 {
+		return io.EOF
+	}
+
+	path := m.files[0]
+	m.files = m.files[1:]
+	m.name = path
+	if path == "-" {
+		m.name = "stdin"
+		m.current = m.newSource(m.stdin, m.opts...)
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return xerrors.Errorf("unable to open input: %w", err)
+	}
+	m.closer = f
+	m.current = m.newSource(f, m.opts...)
+	return nil
+}
+
+// Close the currently open file, if any
+func (m *multiSource) Close() error {
+	if m.closer == nil {
+		return nil
+	}
+	err := m.closer.Close()
+	m.closer = nil
+	return err
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/savaki/dag"
+	"github.com/tj/assert"
+)
+
+const testPipeline = `{
+  "name": "people",
+  "steps": [
+    {"type": "canonicalize", "label": "lower", "mapper": "lower"},
+    {"type": "normalize", "label": "upper-name", "field": "name", "mapper": "upper"},
+    {"type": "delete", "label": "drop-ssn", "fields": ["ssn"]}
+  ]
+}`
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	assert.Nil(t, err)
+	return path
+}
+
+func TestRun(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		dir      = t.TempDir()
+		pipeline = writeFile(t, dir, "pipeline.json", testPipeline)
+	)
+
+	t.Run("jsonl from stdin", func(t *testing.T) {
+		var (
+			stdin  = strings.NewReader("{\"Name\":\"joe\",\"SSN\":\"123\"}\n{\"Name\":\"sue\"}\n")
+			stdout = &bytes.Buffer{}
+			stderr = &bytes.Buffer{}
+		)
+		code := run(ctx, []string{"run", "-pipeline", pipeline, "-ordered", "-workers", "2"}, stdin, stdout, stderr)
+		assert.Equal(t, 0, code, stderr.String())
+		assert.Equal(t, "{\"name\":\"JOE\"}\n{\"name\":\"SUE\"}\n", stdout.String())
+		assert.Contains(t, stderr.String(), "processed 2 records")
+	})
+
+	t.Run("csv files", func(t *testing.T) {
+		var (
+			input  = writeFile(t, dir, "people.csv", "id,Name\na,joe\nb,sue\n")
+			stdout = &bytes.Buffer{}
+			stderr = &bytes.Buffer{}
+		)
+
+		code := run(ctx, []string{"run", "-pipeline", pipeline, "-id-field", "id", "-ordered", input}, nil, stdout, stderr)
+		assert.Equal(t, 0, code, stderr.String())
+		assert.Equal(t, "id,name\na,JOE\nb,SUE\n", stdout.String())
+	})
+
+	t.Run("unknown extension", func(t *testing.T) {
+		var (
+			input  = writeFile(t, dir, "people.txt", "{\"Name\":\"joe\"}\n")
+			stdout = &bytes.Buffer{}
+			stderr = &bytes.Buffer{}
+		)
+		code := run(ctx, []string{"run", "-pipeline", pipeline, input}, nil, stdout, stderr)
+		assert.Equal(t, 0, code, stderr.String())
+		assert.Equal(t, "{\"name\":\"JOE\"}\n", stdout.String())
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		var (
+			stdin  = strings.NewReader("{\"Name\":\"joe\"}\nnot json\n")
+			stdout = &bytes.Buffer{}
+			stderr = &bytes.Buffer{}
+		)
+		code := run(ctx, []string{"run", "-pipeline", pipeline, "-ordered"}, stdin, stdout, stderr)
+		assert.Equal(t, 1, code)
+		assert.Equal(t, "{\"name\":\"JOE\"}\n", stdout.String())
+		assert.Contains(t, stderr.String(), "line 2")
+	})
+
+	t.Run("dropped", func(t *testing.T) {
+		var (
+			filter = writeFile(t, dir, "filter.yaml", "name: adults\nsteps:\n  - type: filter\n    expr: age >= 21\n")
+			stdin  = strings.NewReader("{\"age\":30}\n{\"age\":12}\n")
+			stdout = &bytes.Buffer{}
+			stderr = &bytes.Buffer{}
+		)
+		code := run(ctx, []string{"run", "-pipeline", filter}, stdin, stdout, stderr)
+		assert.Equal(t, 0, code, stderr.String())
+		assert.Equal(t, "{\"age\":30}\n", stdout.String())
+		assert.Contains(t, stderr.String(), "1 succeeded, 0 failed, 1 dropped")
+	})
+
+	t.Run("datasource", func(t *testing.T) {
+		var (
+			states = writeFile(t, dir, "states.csv", "code,state_name\nCA,California\n")
+			enrich = writeFile(t, dir, "enrich.yaml", "name: states\nsteps:\n  - type: enrich\n    datasource: states\n    key: [state]\n")
+			stdin  = strings.NewReader("{\"state\":\"CA\"}\n")
+			stdout = &bytes.Buffer{}
+			stderr = &bytes.Buffer{}
+		)
+		code := run(ctx, []string{"run", "-pipeline", enrich, "-datasource", "states=" + states + ":code"}, stdin, stdout, stderr)
+		assert.Equal(t, 0, code, stderr.String())
+		assert.Equal(t, "{\"code\":\"CA\",\"state\":\"CA\",\"state_name\":\"California\"}\n", stdout.String())
+
+		stderr = &bytes.Buffer{}
+		assert.Equal(t, 1, run(ctx, []string{"validate", "-pipeline", enrich}, nil, stdout, stderr))
+		assert.Contains(t, stderr.String(), "unknown datasource, states")
+
+		stderr = &bytes.Buffer{}
+		assert.Equal(t, 1, run(ctx, []string{"validate", "-pipeline", enrich, "-datasource", "states"}, nil, stdout, stderr))
+		assert.Contains(t, stderr.String(), "invalid -datasource")
+
+		stderr = &bytes.Buffer{}
+		assert.Equal(t, 1, run(ctx, []string{"validate", "-pipeline", enrich, "-http-datasource", "states"}, nil, stdout, stderr))
+		assert.Contains(t, stderr.String(), "invalid -http-datasource")
+	})
+
+	t.Run("ids unique across files", func(t *testing.T) {
+		var (
+			a       = writeFile(t, dir, "a.csv", "Name,name\njoe,joe\n")
+			b       = writeFile(t, dir, "b.csv", "Name,name\nsue,sue\n")
+			rejects = filepath.Join(dir, "rejects.jsonl")
+			stdout  = &bytes.Buffer{}
+			stderr  = &bytes.Buffer{}
+		)
+		code := run(ctx, []string{"run", "-pipeline", pipeline, "-rejects", rejects, "-ordered", a, b}, nil, stdout, stderr)
+		assert.Equal(t, 0, code, stderr.String())
+
+		data, err := ioutil.ReadFile(rejects)
+		assert.Nil(t, err)
+		assert.Contains(t, string(data), `"id":"`+a+`:2"`)
+		assert.Contains(t, string(data), `"id":"`+b+`:2"`)
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		stderr := &bytes.Buffer{}
+		assert.Equal(t, 2, run(ctx, nil, nil, nil, stderr))
+		assert.Equal(t, 2, run(ctx, []string{"blah"}, nil, nil, stderr))
+		assert.Equal(t, 1, run(ctx, []string{"run"}, nil, nil, stderr))
+		assert.Contains(t, stderr.String(), "-pipeline is required")
+	})
+}
+
+func Test_newReject(t *testing.T) {
+	record := dag.NewRecord(dag.Meta{ID: "abc"})
+	record.Set("name", "joe")
+
+	task := dag.Wrap(dag.Serial(dag.WithName("boom", dag.TaskFunc(func(ctx context.Context, record *dag.Record) error {
+		return io.EOF
+	}))), dag.Annotate)
+	err := task.Apply(context.Background(), record)
+
+	got := newReject(dag.Result{Record: record, Err: err})
+	want := reject{
+		ID:     "abc",
+		Record: map[string]interface{}{"name": "joe"},
+		Error:  "EOF",
+		Task:   "boom",
+		Path:   "Serial/boom",
+	}
+	assert.Equal(t, want, got)
+}
+
+func TestGraph(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		pipeline = writeFile(t, dir, "pipeline.json", testPipeline)
+		stdout   = &bytes.Buffer{}
+		stderr   = &bytes.Buffer{}
+	)
+
+	code := run(context.Background(), []string{"graph", "-pipeline", pipeline}, nil, stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.True(t, strings.HasPrefix(stdout.String(), "digraph dag {"))
+	assert.Contains(t, stdout.String(), `label="people"`)
+	assert.Contains(t, stdout.String(), `label="drop-ssn"`)
+}
+
+func TestValidate(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		dir     = t.TempDir()
+		valid   = writeFile(t, dir, "valid.json", testPipeline)
+		invalid = writeFile(t, dir, "invalid.json", `{"steps":[{"type":"blah"}]}`)
+	)
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	assert.Equal(t, 0, run(ctx, []string{"validate", "-pipeline", valid}, nil, stdout, stderr))
+	assert.Contains(t, stdout.String(), "ok")
+
+	stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	assert.Equal(t, 1, run(ctx, []string{"validate", "-pipeline", invalid}, nil, stdout, stderr))
+	assert.Contains(t, stderr.String(), "unknown type, blah")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/savaki/dag/builtin"
+	"github.com/savaki/dag/pipeline"
+	"golang.org/x/xerrors"
+)
+
+// stringList is a flag that may be repeated
+type stringList []string
+
+// String implements flag.Value
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+// Set implements flag.Value
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// sourceFlags holds the data sources named on the command line.  Sources that
+// require code, such as SQL data sources and geocoders, must be registered
+// with the pipeline package by a custom command
+type sourceFlags struct {
+	files stringList // name=path:key[,key...]
+	urls  stringList // name=url
+}
+
+// bind adds the flags to fs
+func (s *sourceFlags) bind(fs *flag.FlagSet) {
+	fs.Var(&s.files, "datasource", "register a csv, tsv, json or jsonl file indexed by its key columns as a data source, `name=path:key[,key...]`; may be repeated")
+	fs.Var(&s.urls, "http-datasource", "register a data source that gets a json object from a url containing {key}, `name=url`; may be repeated")
+}
+
+// registry returns a registry holding the builtin task types and the data
+// sources named on the command line
+func (s *sourceFlags) registry() (*pipeline.Registry, error) {
+	registry := pipeline.NewRegistry()
+
+	for _, value := range s.files {
+		name, spec, ok := strings.Cut(value, "=")
+		i := strings.LastIndex(spec, ":")
+		if !ok || name == "" || i <= 0 || i == len(spec)-1 {
+			return nil, xerrors.Errorf("invalid -datasource, %v: expected name=path:key[,key...]", value)
+		}
+
+		ds, err := builtin.FileDataSource(spec[:i], strings.Split(spec[i+1:], ","))
+		if err != nil {
+			return nil, xerrors.Errorf("datasource, %v: %w", name, err)
+		}
+		registry.RegisterDataSource(name, ds)
+	}
+
+	for _, value := range s.urls {
+		name, template, ok := strings.Cut(value, "=")
+		if !ok || name == "" {
+			return nil, xerrors.Errorf("invalid -http-datasource, %v: expected name=url", value)
+		}
+
+		ds, err := builtin.HTTPDataSource(template)
+		if err != nil {
+			return nil, xerrors.Errorf("datasource, %v: %w", name, err)
+		}
+		registry.RegisterDataSource(name, ds)
+	}
+
+	return registry, nil
+}
@@ -3,7 +3,6 @@ package dag
 import (
 	"context"
 	"errors"
-	"fmt"
 	"reflect"
 	"sort"
 	"sync"
@@ -37,7 +36,10 @@ type Meta struct {
 
 type contextKey string
 
-const depthKey contextKey = "depth"
+const (
+	depthKey contextKey = "depth"
+	pathKey  contextKey = "path"
+)
 
 // Depth within the dag
 func Depth(ctx context.Context) int {
@@ -55,6 +57,23 @@ func Push(ctx context.Context) context.Context {
 	return context.WithValue(ctx, depthKey, n+1)
 }
 
+// Path returns the names of the wrapped tasks from the root of the dag to the
+// currently executing task.  Only tasks that have been passed through Wrap are
+// recorded
+func Path(ctx context.Context) []string {
+	v, _ := ctx.Value(pathKey).([]string)
+	return v
+}
+
+// pushPath appends name to the task path; the slice is copied as siblings
+// within a Parallel share the parent path
+func pushPath(ctx context.Context, name string) context.Context {
+	parent := Path(ctx)
+	path := make([]string, len(parent), len(parent)+1)
+	copy(path, parent)
+	return context.WithValue(ctx, pathKey, append(path, name))
+}
+
 // Record to be modified
 type Record struct {
 	meta    Meta
@@ -246,6 +265,18 @@ func (n namedTask) Wrap(middleware ...func(Task) Task) {
 	}
 }
 
+// wrappedTask is the named task returned by Wrap.  It records its name on the
+// task path so middleware can identify the task regardless of ordering
+type wrappedTask struct {
+	namedTask
+	original Task // task prior to the application of middleware
+}
+
+// Apply invokes this task
+func (w wrappedTask) Apply(ctx context.Context, record *Record) error {
+	return w.target.Apply(pushPath(ctx, w.name), record)
+}
+
 // WithName adds a name to a task
 func WithName(name string, target Task) NamedTask {
 	return namedTask{
@@ -288,7 +319,8 @@ func (p *parallel) Apply(ctx context.Context, record *Record) error {
 	for _, t := range p.tasks {
 		task := t
 		group.Go(func() error {
-			return task.Apply(ctx, record)
+			// a panic within a goroutine cannot be recovered by the caller
+			return safeApply(ctx, Name(task), task, record)
 		})
 	}
 	return group.Wait()
@@ -304,7 +336,8 @@ func (p *parallel) Wrap(middleware ...func(Task) Task) {
 	p.tasks = wrapAll(p.raw, p.middleware...)
 }
 
-// Parallel executes the requested tasks in parallel
+// Parallel executes the requested tasks in parallel.  A panic within any of the
+// tasks is returned as a *PanicError
 func Parallel(tasks ...Task) Task {
 	return &parallel{
 		raw:   tasks,
@@ -346,6 +379,58 @@ func Serial(tasks ...Task) Task {
 	}
 }
 
+// Predicate reports whether the record satisfies a condition
+type Predicate func(ctx context.Context, record *Record) (bool, error)
+
+type conditional struct {
+	predicate  Predicate
+	middleware []func(Task) Task
+	raw        []Task // then followed by the optional otherwise
+	tasks      []Task
+}
+
+func (c *conditional) Apply(ctx context.Context, record *Record) error {
+	ok, err := c.predicate(ctx, record)
+	if err != nil {
+		return err
+	}
+
+	ctx = Push(ctx)
+	switch {
+	case ok:
+		return c.tasks[0].Apply(ctx, record)
+	case len(c.tasks) > 1:
+		return c.tasks[1].Apply(ctx, record)
+	default:
+		return nil
+	}
+}
+
+// Name of conditional task
+func (c *conditional) Name() string {
+	return "If"
+}
+
+func (c *conditional) Wrap(middleware ...func(Task) Task) {
+	c.middleware = append(c.middleware, middleware...)
+	c.tasks = wrapAll(c.raw, c.middleware...)
+}
+
+// If applies then when the predicate is satisfied and otherwise, which may be
+// nil, when it is not
+func If(predicate Predicate, then, otherwise Task) Task {
+	raw := []Task{then}
+	if otherwise != nil {
+		raw = append(raw, otherwise)
+	}
+
+	return &conditional{
+		predicate: predicate,
+		raw:       raw,
+		tasks:     raw,
+	}
+}
+
 func wrapAll(tasks []Task, middleware ...func(Task) Task) []Task {
 	var wrapped []Task
 	for _, t := range tasks {
@@ -356,8 +441,8 @@ func wrapAll(tasks []Task, middleware ...func(Task) Task) []Task {
 
 // Wrap the Task and all its children with the specified middleware
 func Wrap(task Task, middleware ...func(Task) Task) Task {
+	original := task
 	name := Name(task)
-	fmt.Println(name)
 
 	if v, ok := task.(container); ok {
 		v.Wrap(middleware...)
@@ -367,5 +452,11 @@ func Wrap(task Task, middleware ...func(Task) Task) Task {
 		task = m(task)
 	}
 
-	return WithName(name, task)
+	return wrappedTask{
+		namedTask: namedTask{
+			name:   name,
+			target: task,
+		},
+		original: original,
+	}
 }
@@ -266,3 +266,62 @@ func BenchmarkSerial(t *testing.B) {
 		}
 	}
 }
+
+func TestIf(t *testing.T) {
+	ctx := context.Background()
+	isCA := func(ctx context.Context, record *Record) (bool, error) {
+		v, _ := record.String("state")
+		return v == "CA", nil
+	}
+
+	t.Run("then", func(t *testing.T) {
+		var then, otherwise int64
+		task := If(isCA, counterTask(&then), counterTask(&otherwise))
+
+		record := &Record{}
+		record.Set("state", "CA")
+		err := task.Apply(ctx, record)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, int(then))
+		assert.Equal(t, 0, int(otherwise))
+	})
+
+	t.Run("otherwise", func(t *testing.T) {
+		var then, otherwise int64
+		task := If(isCA, counterTask(&then), counterTask(&otherwise))
+		err := task.Apply(ctx, &Record{})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, int(then))
+		assert.Equal(t, 1, int(otherwise))
+	})
+
+	t.Run("no otherwise", func(t *testing.T) {
+		var then int64
+		task := If(isCA, counterTask(&then), nil)
+		err := task.Apply(ctx, &Record{})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, int(then))
+	})
+
+	t.Run("predicate error", func(t *testing.T) {
+		var then int64
+		task := If(func(ctx context.Context, record *Record) (bool, error) {
+			return false, errWrongType
+		}, counterTask(&then), nil)
+		err := task.Apply(ctx, &Record{})
+		assert.Equal(t, errWrongType, err)
+	})
+
+	t.Run("middleware", func(t *testing.T) {
+		var (
+			then  int64
+			order []string
+		)
+		task := Wrap(If(isCA, counterTask(&then), nil), middleware(&order, "a"))
+		record := &Record{}
+		record.Set("state", "CA")
+		err := task.Apply(ctx, record)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"a", "a"}, order)
+	})
+}
@@ -0,0 +1,67 @@
+// Package dagotel adapts an OpenTelemetry tracer to dag.Tracer
+package dagotel
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/savaki/dag"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracer struct {
+	target trace.Tracer
+}
+
+// NewTracer returns a dag.Tracer that creates OpenTelemetry spans
+func NewTracer(target trace.Tracer) dag.Tracer {
+	return tracer{target: target}
+}
+
+// Start implements dag.Tracer
+func (t tracer) Start(ctx context.Context, name string) (context.Context, dag.Span) {
+	ctx, span := t.target.Start(ctx, name)
+	return ctx, spanAdapter{target: span}
+}
+
+type spanAdapter struct {
+	target trace.Span
+}
+
+func (s spanAdapter) SetAttributes(attrs ...dag.Attribute) {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		kvs = append(kvs, keyValue(attr))
+	}
+	s.target.SetAttributes(kvs...)
+}
+
+func (s spanAdapter) RecordError(err error) {
+	s.target.RecordError(err)
+	s.target.SetStatus(codes.Error, err.Error())
+}
+
+func (s spanAdapter) End() {
+	s.target.End()
+}
+
+func keyValue(attr dag.Attribute) attribute.KeyValue {
+	switch v := attr.Value.(type) {
+	case string:
+		return attribute.String(attr.Key, v)
+	case bool:
+		return attribute.Bool(attr.Key, v)
+	case int:
+		return attribute.Int(attr.Key, v)
+	case int64:
+		return attribute.Int64(attr.Key, v)
+	case float64:
+		return attribute.Float64(attr.Key, v)
+	case []string:
+		return attribute.StringSlice(attr.Key, v)
+	default:
+		return attribute.String(attr.Key, fmt.Sprintf("%v", v))
+	}
+}
@@ -0,0 +1,74 @@
+package dagotel
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/savaki/dag"
+	"github.com/tj/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type fakeSpan struct {
+	noop.Span
+	name   string
+	parent *fakeSpan
+	attrs  map[attribute.Key]attribute.Value
+	code   codes.Code
+	ended  bool
+}
+
+func (s *fakeSpan) SetAttributes(kvs ...attribute.KeyValue) {
+	for _, kv := range kvs {
+		s.attrs[kv.Key] = kv.Value
+	}
+}
+
+func (s *fakeSpan) SetStatus(code codes.Code, _ string) { s.code = code }
+
+func (s *fakeSpan) End(...trace.SpanEndOption) { s.ended = true }
+
+type spanKey struct{}
+
+type fakeTracer struct {
+	noop.Tracer
+	spans []*fakeSpan
+}
+
+func (f *fakeTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	parent, _ := ctx.Value(spanKey{}).(*fakeSpan)
+	span := &fakeSpan{
+		name:   name,
+		parent: parent,
+		attrs:  map[attribute.Key]attribute.Value{},
+	}
+	f.spans = append(f.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func TestTracer(t *testing.T) {
+	target := &fakeTracer{}
+	task := dag.Serial(
+		dag.WithName("boom", dag.TaskFunc(func(ctx context.Context, record *dag.Record) error {
+			return io.EOF
+		})),
+	)
+	task = dag.Wrap(task, dag.Trace(NewTracer(target)))
+
+	err := task.Apply(context.Background(), dag.NewRecord(dag.Meta{ID: "abc"}))
+	assert.Equal(t, io.EOF, err)
+
+	assert.Len(t, target.spans, 2)
+	root, child := target.spans[0], target.spans[1]
+	assert.Equal(t, "Serial", root.name)
+	assert.Equal(t, "boom", child.name)
+	assert.Equal(t, root, child.parent)
+	assert.Equal(t, "abc", child.attrs["dag.record_id"].AsString())
+	assert.Equal(t, codes.Error, child.code)
+	assert.True(t, root.ended)
+	assert.True(t, child.ended)
+}
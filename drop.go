@@ -0,0 +1,50 @@
+package dag
+
+import (
+	"errors"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrDrop may be returned by a task to discard the record.  Processing of the
+// record stops, as with any other error, but runners, metrics and logging
+// report the record as dropped rather than failed
+var ErrDrop = errors.New("record dropped")
+
+// DropError discards the record, recording the reason it was dropped
+type DropError struct {
+	// Reason the record was dropped
+	Reason string
+}
+
+// Error implements error
+func (d *DropError) Error() string {
+	if d.Reason == "" {
+		return ErrDrop.Error()
+	}
+	return ErrDrop.Error() + ": " + d.Reason
+}
+
+// Is reports DropError as equivalent to ErrDrop
+func (d *DropError) Is(target error) bool {
+	return target == ErrDrop
+}
+
+// Drop returns an error that discards the record for the provided reason
+func Drop(reason string) error {
+	return &DropError{Reason: reason}
+}
+
+// IsDropped reports whether the error indicates the record was dropped
+func IsDropped(err error) bool {
+	return xerrors.Is(err, ErrDrop)
+}
+
+// dropReason returns the reason the record was dropped, if any
+func dropReason(err error) string {
+	var d *DropError
+	if xerrors.As(err, &d) {
+		return d.Reason
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package dag
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/tj/assert"
+	"golang.org/x/xerrors"
+)
+
+func TestDrop(t *testing.T) {
+	err := Drop("too old")
+	assert.True(t, IsDropped(err))
+	assert.True(t, xerrors.Is(err, ErrDrop))
+	assert.Equal(t, "record dropped: too old", err.Error())
+	assert.Equal(t, "too old", dropReason(xerrors.Errorf("wrapped: %w", err)))
+
+	assert.True(t, IsDropped(ErrDrop))
+	assert.Equal(t, "", dropReason(ErrDrop))
+	assert.False(t, IsDropped(io.EOF))
+	assert.False(t, IsDropped(nil))
+}
+
+func TestDrop_Containers(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		counter int64
+		drop    = TaskFunc(func(ctx context.Context, record *Record) error {
+			return Drop("nope")
+		})
+	)
+
+	err := Serial(drop, counterTask(&counter)).Apply(ctx, &Record{})
+	assert.True(t, IsDropped(err))
+	assert.Equal(t, 0, int(counter))
+
+	err = Parallel(drop, counterTask(&counter)).Apply(ctx, &Record{})
+	assert.True(t, IsDropped(err))
+
+	err = Wrap(Serial(drop), Annotate).Apply(ctx, &Record{})
+	assert.Equal(t, Drop("nope"), err)
+}
@@ -0,0 +1,361 @@
+package expr
+
+import (
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/savaki/dag"
+	"golang.org/x/xerrors"
+)
+
+// node is an element of a parsed expression
+type node interface {
+	eval(record *dag.Record) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(record *dag.Record) (interface{}, error) {
+	return n.value, nil
+}
+
+type fieldNode struct {
+	field string
+}
+
+// eval returns the value of the field or nil if the field is not present
+func (n *fieldNode) eval(record *dag.Record) (interface{}, error) {
+	v, err := record.Get(n.field)
+	if err != nil {
+		if dag.IsFieldNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+type listNode struct {
+	items []node
+}
+
+func (n *listNode) eval(record *dag.Record) (interface{}, error) {
+	values := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		v, err := item.eval(record)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n *unaryNode) eval(record *dag.Record) (interface{}, error) {
+	v, err := n.operand.eval(record)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "not":
+		b, err := toBool(v)
+		if err != nil {
+			return nil, err
+		}
+		return !b, nil
+
+	default: // -
+		if v == nil {
+			return nil, nil
+		}
+		if i, ok := toInt(v); ok {
+			return -i, nil
+		}
+		if f, ok := toFloat(v); ok {
+			return -f, nil
+		}
+		return nil, xerrors.Errorf("unable to negate %T", v)
+	}
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(record *dag.Record) (interface{}, error) {
+	left, err := n.left.eval(record)
+	if err != nil {
+		return nil, err
+	}
+
+	// and and or short circuit
+	switch n.op {
+	case "and", "or":
+		b, err := toBool(left)
+		if err != nil {
+			return nil, err
+		}
+		if b == (n.op == "or") {
+			return b, nil
+		}
+		right, err := n.right.eval(record)
+		if err != nil {
+			return nil, err
+		}
+		return toBool(right)
+	}
+
+	right, err := n.right.eval(record)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "<", "<=", ">", ">=":
+		return compare(n.op, left, right)
+	case "in":
+		return in(left, right)
+	default:
+		return arithmetic(n.op, left, right)
+	}
+}
+
+type callNode struct {
+	name string
+	fn   function
+	args []node
+}
+
+func (n *callNode) eval(record *dag.Record) (interface{}, error) {
+	if n.fn.lazy != nil {
+		return n.evalLazy(record)
+	}
+
+	args := make([]interface{}, 0, len(n.args))
+	for _, arg := range n.args {
+		v, err := arg.eval(record)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+
+	v, err := n.fn.call(args)
+	if err != nil {
+		return nil, xerrors.Errorf("%v: %w", n.name, err)
+	}
+	return v, nil
+}
+
+// evalLazy calls a lazy function; as with eager functions, errors from
+// evaluating the arguments are returned as is
+func (n *callNode) evalLazy(record *dag.Record) (interface{}, error) {
+	var argErr error
+	args := make([]thunk, 0, len(n.args))
+	for _, arg := range n.args {
+		arg := arg
+		args = append(args, func() (interface{}, error) {
+			v, err := arg.eval(record)
+			if err != nil && argErr == nil {
+				argErr = err
+			}
+			return v, err
+		})
+	}
+
+	v, err := n.fn.lazy(args)
+	if argErr != nil {
+		return nil, argErr
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("%v: %w", n.name, err)
+	}
+	return v, nil
+}
+
+// toBool treats null as false; any other non-boolean value is an error
+func toBool(v interface{}) (bool, error) {
+	switch b := v.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return b, nil
+	default:
+		return false, xerrors.Errorf("expected boolean; got %T", v)
+	}
+}
+
+func toInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	if i, ok := toInt(v); ok {
+		return float64(i), true
+	}
+	switch n := v.(type) {
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+// equal compares values; numbers are compared by value regardless of type
+func equal(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return x == y
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compare orders numbers or strings.  Comparisons involving null are false
+func compare(op string, a, b interface{}) (interface{}, error) {
+	if a == nil || b == nil {
+		return false, nil
+	}
+
+	var cmp int
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		if !ok {
+			return nil, xerrors.Errorf("unable to compare %T with %T", a, b)
+		}
+		cmp = compareFloats(x, y)
+	} else if x, ok := a.(string); ok {
+		y, ok := b.(string)
+		if !ok {
+			return nil, xerrors.Errorf("unable to compare %T with %T", a, b)
+		}
+		cmp = strings.Compare(x, y)
+	} else {
+		return nil, xerrors.Errorf("unable to compare %T with %T", a, b)
+	}
+
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func in(v, list interface{}) (interface{}, error) {
+	if list == nil {
+		return false, nil
+	}
+	items, ok := list.([]interface{})
+	if !ok {
+		return nil, xerrors.Errorf("in requires a list; got %T", list)
+	}
+	for _, item := range items {
+		if equal(v, item) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// arithmetic applies +, -, *, / or %.  Null operands yield null and + joins
+// strings
+func arithmetic(op string, a, b interface{}) (interface{}, error) {
+	if a == nil || b == nil {
+		return nil, nil
+	}
+
+	if op == "+" {
+		_, x := a.(string)
+		_, y := b.(string)
+		if x || y {
+			return toString(a) + toString(b), nil
+		}
+	}
+
+	if x, ok := toInt(a); ok && op != "/" {
+		if y, ok := toInt(b); ok {
+			switch op {
+			case "+":
+				return x + y, nil
+			case "-":
+				return x - y, nil
+			case "*":
+				return x * y, nil
+			default: // %
+				if y == 0 {
+					return nil, xerrors.New("division by zero")
+				}
+				return x % y, nil
+			}
+		}
+	}
+
+	x, ok := toFloat(a)
+	if !ok {
+		return nil, xerrors.Errorf("unable to apply %v to %T", op, a)
+	}
+	y, ok := toFloat(b)
+	if !ok {
+		return nil, xerrors.Errorf("unable to apply %v to %T", op, b)
+	}
+
+	switch op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		if y == 0 {
+			return nil, xerrors.New("division by zero")
+		}
+		return x / y, nil
+	default: // %
+		if y == 0 {
+			return nil, xerrors.New("division by zero")
+		}
+		return math.Mod(x, y), nil
+	}
+}
@@ -0,0 +1,109 @@
+// Package expr provides a small, safe expression language evaluated against a
+// dag.Record:
+//
+//	first + " " + last
+//	state == "CA" and age >= 21
+//	coalesce(nickname, first)
+//	lower(trim(email)) in ["a@example.com", "b@example.com"]
+//
+// Identifiers refer to record fields; field names that are not valid
+// identifiers may be quoted with backticks e.g. `first name`.  Missing fields
+// evaluate to null.  Arithmetic and functions given null return null, ordering
+// comparisons with null are false, and null is treated as false by and, or and
+// not.
+//
+// Operators, loosest binding first: or (||), and (&&), not (!), comparisons
+// (== != < <= > >= in), + -, * / %, unary -.  + joins strings.
+//
+// Functions: lower, upper, trim, len, concat, contains, starts_with, ends_with,
+// replace, substr, coalesce, is_null, if, string, number, abs, floor, ceil and
+// round.  if evaluates only the branch chosen, and coalesce only up to the first
+// argument that is not null, so that if(x == 0, 0, 10 / x) is safe
+package expr
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/savaki/dag"
+	"golang.org/x/xerrors"
+)
+
+// SyntaxError describes an invalid expression
+type SyntaxError struct {
+	// Pos is the byte offset of the error within the expression
+	Pos int
+	// Err describing the problem
+	Err error
+}
+
+// Error implements error
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("column %v: %v", e.Pos+1, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// Expression is a compiled expression safe for concurrent use
+type Expression struct {
+	src  string
+	root node
+}
+
+// Compile parses the expression
+func Compile(src string) (*Expression, error) {
+	root, err := parse(src)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid expression, %q: %w", src, err)
+	}
+	return &Expression{src: src, root: root}, nil
+}
+
+// MustCompile is like Compile, but panics if the expression is invalid
+func MustCompile(src string) *Expression {
+	e, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// String returns the source of the expression
+func (e *Expression) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression against the record.  Numbers are returned as
+// int64 or float64
+func (e *Expression) Eval(record *dag.Record) (interface{}, error) {
+	v, err := e.root.eval(record)
+	if err != nil {
+		return nil, xerrors.Errorf("%v: %w", e.src, err)
+	}
+	return v, nil
+}
+
+// Bool evaluates an expression that yields a boolean; null is false
+func (e *Expression) Bool(record *dag.Record) (bool, error) {
+	v, err := e.Eval(record)
+	if err != nil {
+		return false, err
+	}
+
+	b, err := toBool(v)
+	if err != nil {
+		return false, xerrors.Errorf("%v: %w", e.src, err)
+	}
+	return b, nil
+}
+
+// Predicate returns a dag.Predicate, suitable for dag.If, that evaluates the
+// expression
+func (e *Expression) Predicate() dag.Predicate {
+	return func(ctx context.Context, record *dag.Record) (bool, error) {
+		return e.Bool(record)
+	}
+}
@@ -0,0 +1,185 @@
+package expr
+
+import (
+	"context"
+	"testing"
+
+	"github.com/savaki/dag"
+	"github.com/tj/assert"
+	"golang.org/x/xerrors"
+)
+
+func testRecord() *dag.Record {
+	record := &dag.Record{}
+	record.Set("first", "Joe")
+	record.Set("last", "Public")
+	record.Set("state", "CA")
+	record.Set("age", 30)
+	record.Set("price", 2.5)
+	record.Set("active", true)
+	record.Set("first name", "Joe")
+	record.Set("café", "latte")
+	record.Set("größe", 3)
+	return record
+}
+
+func TestExpression_Eval(t *testing.T) {
+	tests := map[string]interface{}{
+		// literals
+		`1`:        int64(1),
+		`1.5`:      1.5,
+		`"a"`:      "a",
+		`'a\'b'`:   "a'b",
+		`true`:     true,
+		`null`:     nil,
+		`[1, "a"]`: []interface{}{int64(1), "a"},
+
+		// fields
+		`first`:        "Joe",
+		"`first name`": "Joe",
+		`missing`:      nil,
+		`café`:         "latte",
+		`größe * 2`:    int64(6),
+		`upper(café)`:  "LATTE",
+
+		// arithmetic
+		`age + 1`:            int64(31),
+		`age - 1`:            int64(29),
+		`age * 2`:            int64(60),
+		`age / 4`:            7.5,
+		`age % 7`:            int64(2),
+		`price * 2`:          5.0,
+		`-age`:               int64(-30),
+		`1 + 2 * 3`:          int64(7),
+		`(1 + 2) * 3`:        int64(9),
+		`first + " " + last`: "Joe Public",
+		`"n" + age`:          "n30",
+		`missing + 1`:        nil,
+
+		// comparison
+		`age == 30`:             true,
+		`age == 30.0`:           true,
+		`state != "CA"`:         false,
+		`age > 21`:              true,
+		`age >= 31`:             false,
+		`first < last`:          true,
+		`missing < 1`:           false,
+		`missing == null`:       true,
+		`state == null`:         false,
+		`state in ["NV", "CA"]`: true,
+		`state in missing`:      false,
+
+		// logic
+		`active and age > 21`:     true,
+		`active && false`:         false,
+		`false or state == "CA"`:  true,
+		`false || missing`:        false,
+		`not active`:              false,
+		`!missing`:                true,
+		`not state == "NV"`:       true,
+		`NOT age < 10 AND active`: true,
+
+		// functions
+		`upper(first)`:                   "JOE",
+		`coalesce(missing, first)`:       "Joe",
+		`if(age > 21, "adult", "minor")`: "adult",
+	}
+
+	record := testRecord()
+	for src, want := range tests {
+		t.Run(src, func(t *testing.T) {
+			e, err := Compile(src)
+			assert.Nil(t, err)
+
+			got, err := e.Eval(record)
+			assert.Nil(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestExpression_EvalErrors(t *testing.T) {
+	tests := map[string]string{
+		`first * 2`:        "first * 2: unable to apply * to string",
+		`age / 0`:          "age / 0: division by zero",
+		`age % 0`:          "age % 0: division by zero",
+		`first and active`: "first and active: expected boolean; got string",
+		`age < "a"`:        `age < "a": unable to compare int with string`,
+		`active > false`:   "active > false: unable to compare bool with bool",
+		`-first`:           "-first: unable to negate string",
+		`age in 1`:         "age in 1: in requires a list; got int64",
+		`number("abc")`:    `number("abc"): number: unable to convert "abc" to a number`,
+	}
+
+	record := testRecord()
+	for src, want := range tests {
+		t.Run(src, func(t *testing.T) {
+			e, err := Compile(src)
+			assert.Nil(t, err)
+
+			_, err = e.Eval(record)
+			assert.NotNil(t, err)
+			assert.Equal(t, want, err.Error())
+		})
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := map[string]string{
+		``:            "column 1: unexpected end of expression",
+		`1 +`:         "column 4: unexpected end of expression",
+		`(1 + 2`:      "column 7: expected )",
+		`1 2`:         "column 3: unexpected 2",
+		`"abc`:        "column 1: unterminated string",
+		"`abc":        "column 1: unterminated field name",
+		`a # b`:       "column 3: unexpected character, '#'",
+		`a → b`:       "column 3: unexpected character, '→'",
+		`blah(a)`:     "column 1: unknown function, blah",
+		`lower(a, b)`: "column 1: lower: wrong number of arguments, 2",
+		`[1, 2`:       "column 6: expected , or ]",
+		`1..2`:        "column 1: invalid number, 1..2",
+	}
+
+	for src, want := range tests {
+		t.Run(src, func(t *testing.T) {
+			_, err := Compile(src)
+			assert.NotNil(t, err)
+
+			var se *SyntaxError
+			assert.True(t, xerrors.As(err, &se))
+			assert.Equal(t, want, se.Error())
+		})
+	}
+}
+
+func TestMustCompile(t *testing.T) {
+	assert.Equal(t, "a + 1", MustCompile("a + 1").String())
+	assert.Panics(t, func() { MustCompile("a +") })
+}
+
+func TestExpression_Predicate(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		record = testRecord()
+	)
+
+	got, err := MustCompile(`state == "CA"`).Predicate()(ctx, record)
+	assert.Nil(t, err)
+	assert.True(t, got)
+
+	got, err = MustCompile(`missing`).Predicate()(ctx, record)
+	assert.Nil(t, err)
+	assert.False(t, got)
+
+	_, err = MustCompile(`age`).Predicate()(ctx, record)
+	assert.NotNil(t, err)
+
+	var then int
+	task := dag.If(MustCompile(`age >= 21`).Predicate(), dag.TaskFunc(func(ctx context.Context, record *dag.Record) error {
+		then++
+		return nil
+	}), nil)
+	err = task.Apply(ctx, record)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, then)
+}
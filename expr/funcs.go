@@ -0,0 +1,196 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+type function struct {
+	min, max int  // number of arguments; max < 0 is variadic
+	nullable bool // when false, any null argument yields null without calling fn
+	fn       func(args []interface{}) (interface{}, error)
+	// lazy, when set, is called in place of fn with arguments that are
+	// evaluated only on demand, so that e.g. only the chosen branch of an if
+	// is evaluated
+	lazy func(args []thunk) (interface{}, error)
+}
+
+// thunk evaluates an argument of a lazy function
+type thunk func() (interface{}, error)
+
+func (f function) call(args []interface{}) (interface{}, error) {
+	if !f.nullable {
+		for _, arg := range args {
+			if arg == nil {
+				return nil, nil
+			}
+		}
+	}
+	return f.fn(args)
+}
+
+// functions available to expressions
+var functions = map[string]function{
+	"lower":       stringFunc(strings.ToLower),
+	"upper":       stringFunc(strings.ToUpper),
+	"trim":        stringFunc(strings.TrimSpace),
+	"len":         {min: 1, max: 1, fn: length},
+	"concat":      {min: 1, max: -1, nullable: true, fn: concat},
+	"contains":    stringPredicate(strings.Contains),
+	"starts_with": stringPredicate(strings.HasPrefix),
+	"ends_with":   stringPredicate(strings.HasSuffix),
+	"replace":     {min: 3, max: 3, fn: replace},
+	"substr":      {min: 2, max: 3, fn: substr},
+	"coalesce":    {min: 1, max: -1, lazy: coalesce},
+	"is_null":     {min: 1, max: 1, nullable: true, fn: isNull},
+	"if":          {min: 3, max: 3, lazy: ifFunc},
+	"string":      {min: 1, max: 1, fn: func(args []interface{}) (interface{}, error) { return toString(args[0]), nil }},
+	"number":      {min: 1, max: 1, fn: number},
+	"abs":         mathFunc(math.Abs),
+	"floor":       mathFunc(math.Floor),
+	"ceil":        mathFunc(math.Ceil),
+	"round":       mathFunc(math.Round),
+}
+
+func stringFunc(fn func(string) string) function {
+	return function{min: 1, max: 1, fn: func(args []interface{}) (interface{}, error) {
+		return fn(toString(args[0])), nil
+	}}
+}
+
+func stringPredicate(fn func(s, substr string) bool) function {
+	return function{min: 2, max: 2, fn: func(args []interface{}) (interface{}, error) {
+		return fn(toString(args[0]), toString(args[1])), nil
+	}}
+}
+
+func mathFunc(fn func(float64) float64) function {
+	return function{min: 1, max: 1, fn: func(args []interface{}) (interface{}, error) {
+		if i, ok := toInt(args[0]); ok {
+			return int64(fn(float64(i))), nil
+		}
+		f, ok := toFloat(args[0])
+		if !ok {
+			return nil, xerrors.Errorf("expected number; got %T", args[0])
+		}
+		return fn(f), nil
+	}}
+}
+
+func length(args []interface{}) (interface{}, error) {
+	if items, ok := args[0].([]interface{}); ok {
+		return int64(len(items)), nil
+	}
+	return int64(len([]rune(toString(args[0])))), nil
+}
+
+// concat joins its arguments, ignoring nulls
+func concat(args []interface{}) (interface{}, error) {
+	var sb strings.Builder
+	for _, arg := range args {
+		if arg != nil {
+			sb.WriteString(toString(arg))
+		}
+	}
+	return sb.String(), nil
+}
+
+func replace(args []interface{}) (interface{}, error) {
+	return strings.ReplaceAll(toString(args[0]), toString(args[1]), toString(args[2])), nil
+}
+
+// substr returns the runes from start, optionally limited to length
+func substr(args []interface{}) (interface{}, error) {
+	s := []rune(toString(args[0]))
+
+	start, ok := toInt(args[1])
+	if !ok {
+		return nil, xerrors.Errorf("start must be an integer; got %T", args[1])
+	}
+	if start < 0 || start > int64(len(s)) {
+		return "", nil
+	}
+
+	end := int64(len(s))
+	if len(args) == 3 {
+		n, ok := toInt(args[2])
+		if !ok {
+			return nil, xerrors.Errorf("length must be an integer; got %T", args[2])
+		}
+		if start+n < end {
+			end = start + n
+		}
+	}
+	if end < start {
+		return "", nil
+	}
+	return string(s[start:end]), nil
+}
+
+// coalesce returns the first argument that is not null; later arguments are
+// not evaluated
+func coalesce(args []thunk) (interface{}, error) {
+	for _, arg := range args {
+		v, err := arg()
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+func isNull(args []interface{}) (interface{}, error) {
+	return args[0] == nil, nil
+}
+
+// ifFunc evaluates only the branch selected by the condition
+func ifFunc(args []thunk) (interface{}, error) {
+	cond, err := args[0]()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := toBool(cond)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return args[1]()
+	}
+	return args[2]()
+}
+
+func number(args []interface{}) (interface{}, error) {
+	if _, ok := toFloat(args[0]); ok {
+		return args[0], nil
+	}
+
+	s := strings.TrimSpace(toString(args[0]))
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to convert %q to a number", s)
+	}
+	return f, nil
+}
+
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case float32:
+		return strconv.FormatFloat(float64(s), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
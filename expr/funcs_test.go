@@ -0,0 +1,80 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func TestFunctions(t *testing.T) {
+	tests := map[string]interface{}{
+		`lower("ABC")`:                "abc",
+		`upper("abc")`:                "ABC",
+		`trim("  abc ")`:              "abc",
+		`upper(missing)`:              nil,
+		`len("héllo")`:                int64(5),
+		`len([1, 2])`:                 int64(2),
+		`concat(first, missing, "!")`: "Joe!",
+		`contains(first, "o")`:        true,
+		`starts_with(first, "J")`:     true,
+		`ends_with(first, "x")`:       false,
+		`replace("a-b-c", "-", "+")`:  "a+b+c",
+		`substr("hello", 1)`:          "ello",
+		`substr("hello", 1, 3)`:       "ell",
+		`substr("hello", 3, 10)`:      "lo",
+		`substr("hello", 10)`:         "",
+		`coalesce(missing, null)`:     nil,
+		`is_null(missing)`:            true,
+		`is_null(first)`:              false,
+		`if(missing, 1, 2)`:           int64(2),
+		`string(age)`:                 "30",
+		`string(price)`:               "2.5",
+		`number("42")`:                int64(42),
+		`number(" 4.5 ")`:             4.5,
+		`number(age)`:                 30,
+		`abs(-2)`:                     int64(2),
+		`abs(-2.5)`:                   2.5,
+		`floor(price)`:                2.0,
+		`ceil(price)`:                 3.0,
+		`round(price)`:                3.0,
+		`UPPER(first)`:                "JOE",
+	}
+
+	record := testRecord()
+	for src, want := range tests {
+		t.Run(src, func(t *testing.T) {
+			got, err := MustCompile(src).Eval(record)
+			assert.Nil(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestFunctions_Lazy(t *testing.T) {
+	tests := map[string]interface{}{
+		`if(zero == 0, 0, 10 / zero)`:   int64(0),
+		`if(age != 0, 60 / age, 1 / 0)`: 2.0,
+		`coalesce(first, 1 / 0)`:        "Joe",
+		`coalesce(missing, age, 1 / 0)`: 30,
+	}
+
+	record := testRecord()
+	record.Set("zero", 0)
+	for src, want := range tests {
+		t.Run(src, func(t *testing.T) {
+			got, err := MustCompile(src).Eval(record)
+			assert.Nil(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+
+	t.Run("evaluated branch fails", func(t *testing.T) {
+		_, err := MustCompile(`if(zero == 0, 10 / zero, 0)`).Eval(record)
+		assert.EqualError(t, err, "if(zero == 0, 10 / zero, 0): division by zero")
+	})
+
+	t.Run("invalid condition", func(t *testing.T) {
+		_, err := MustCompile(`if(first, 1, 2)`).Eval(record)
+		assert.EqualError(t, err, "if(first, 1, 2): if: expected boolean; got string")
+	})
+}
@@ -0,0 +1,135 @@
+package expr
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/xerrors"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+	tokenField // `quoted` field name
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int // offset of the token within the source
+}
+
+// operators are ordered longest first so that e.g. <= is matched before <
+var operators = []string{
+	"==", "!=", "<=", ">=", "&&", "||",
+	"+", "-", "*", "/", "%", "<", ">", "!", "(", ")", "[", "]", ",",
+}
+
+// lex splits src into tokens; identifiers may contain any unicode letter
+func lex(src string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(src); {
+		c, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(c):
+			i += size
+
+		case isIdentStart(c):
+			start := i
+			for i < len(src) {
+				c, size := utf8.DecodeRuneInString(src[i:])
+				if !isIdentPart(c) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{kind: tokenIdent, value: src[start:i], pos: start})
+
+		case c == '`':
+			end := strings.IndexByte(src[i+1:], '`')
+			if end < 0 {
+				return nil, &SyntaxError{Pos: i, Err: xerrors.New("unterminated field name")}
+			}
+			tokens = append(tokens, token{kind: tokenField, value: src[i+1 : i+1+end], pos: i})
+			i += end + 2
+
+		case isDigit(src[i]) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			start := i
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, value: src[start:i], pos: start})
+
+		case c == '"' || c == '\'':
+			value, n, err := lexString(src[i:])
+			if err != nil {
+				return nil, &SyntaxError{Pos: i, Err: err}
+			}
+			tokens = append(tokens, token{kind: tokenString, value: value, pos: i})
+			i += n
+
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{kind: tokenOperator, value: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, &SyntaxError{Pos: i, Err: xerrors.Errorf("unexpected character, %q", c)}
+			}
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(src)}), nil
+}
+
+// lexString reads a quoted string returning the unquoted value and the number
+// of bytes consumed
+func lexString(src string) (string, int, error) {
+	var (
+		quote = src[0]
+		sb    strings.Builder
+	)
+	for i := 1; i < len(src); i++ {
+		switch c := src[i]; {
+		case c == quote:
+			return sb.String(), i + 1, nil
+		case c == '\\' && i+1 < len(src):
+			i++
+			switch src[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				sb.WriteByte(src[i])
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", 0, xerrors.New("unterminated string")
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c rune) bool {
+	return c == '_' || unicode.IsLetter(c)
+}
+
+func isIdentPart(c rune) bool {
+	return isIdentStart(c) || unicode.IsDigit(c) || c == '.'
+}
@@ -0,0 +1,240 @@
+package expr
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// binary operator precedence; higher binds tighter
+var precedence = map[string]int{
+	"or":  1,
+	"and": 2,
+	"==":  3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3, "in": 3,
+	"+": 4, "-": 4,
+	"*": 5, "/": 5, "%": 5,
+}
+
+// aliases normalizes symbolic operators to their keyword equivalents
+var aliases = map[string]string{
+	"&&": "and",
+	"||": "or",
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(src string) (node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	n, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.unexpected(t)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(op string) error {
+	if t := p.next(); t.kind != tokenOperator || t.value != op {
+		return &SyntaxError{Pos: t.pos, Err: xerrors.Errorf("expected %v", op)}
+	}
+	return nil
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokenEOF {
+		return &SyntaxError{Pos: t.pos, Err: xerrors.New("unexpected end of expression")}
+	}
+	return &SyntaxError{Pos: t.pos, Err: xerrors.Errorf("unexpected %v", t.value)}
+}
+
+// operator returns the normalized binary operator at the current position, if any
+func (p *parser) operator() (string, bool) {
+	t := p.peek()
+	if t.kind != tokenOperator && t.kind != tokenIdent {
+		return "", false
+	}
+	op := strings.ToLower(t.value)
+	if t.kind == tokenOperator {
+		op = t.value
+	}
+	if alias, ok := aliases[op]; ok {
+		op = alias
+	}
+	if _, ok := precedence[op]; !ok {
+		return "", false
+	}
+	return op, true
+}
+
+// parseExpr parses binary expressions whose operators bind tighter than min
+func (p *parser) parseExpr(min int) (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.operator()
+		if !ok || precedence[op] <= min {
+			return left, nil
+		}
+		p.next()
+
+		right, err := p.parseExpr(precedence[op])
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	var op string
+	switch t := p.peek(); {
+	case t.kind == tokenOperator && t.value == "-":
+		op = "-"
+	case t.kind == tokenOperator && t.value == "!", t.kind == tokenIdent && strings.EqualFold(t.value, "not"):
+		op = "not"
+	default:
+		return p.parsePrimary()
+	}
+
+	p.next()
+
+	// not binds looser than comparisons so that not a == b is not (a == b)
+	var (
+		operand node
+		err     error
+	)
+	if op == "not" {
+		operand, err = p.parseExpr(precedence["and"])
+	} else {
+		operand, err = p.parseUnary()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &unaryNode{op: op, operand: operand}, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		if i, err := strconv.ParseInt(t.value, 10, 64); err == nil {
+			return &literalNode{value: i}, nil
+		}
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, &SyntaxError{Pos: t.pos, Err: xerrors.Errorf("invalid number, %v", t.value)}
+		}
+		return &literalNode{value: f}, nil
+
+	case tokenString:
+		return &literalNode{value: t.value}, nil
+
+	case tokenField:
+		return &fieldNode{field: t.value}, nil
+
+	case tokenIdent:
+		switch strings.ToLower(t.value) {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null", "nil":
+			return &literalNode{value: nil}, nil
+		}
+		if next := p.peek(); next.kind == tokenOperator && next.value == "(" {
+			return p.parseCall(t)
+		}
+		return &fieldNode{field: t.value}, nil
+
+	case tokenOperator:
+		switch t.value {
+		case "(":
+			n, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return n, nil
+		case "[":
+			items, err := p.parseList("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{items: items}, nil
+		}
+	}
+
+	return nil, p.unexpected(t)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	fn, ok := functions[strings.ToLower(name.value)]
+	if !ok {
+		return nil, &SyntaxError{Pos: name.pos, Err: xerrors.Errorf("unknown function, %v", name.value)}
+	}
+
+	p.next() // (
+	args, err := p.parseList(")")
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < fn.min || (fn.max >= 0 && len(args) > fn.max) {
+		return nil, &SyntaxError{Pos: name.pos, Err: xerrors.Errorf("%v: wrong number of arguments, %v", name.value, len(args))}
+	}
+
+	return &callNode{name: strings.ToLower(name.value), fn: fn, args: args}, nil
+}
+
+// parseList parses comma separated expressions up to and including the closing token
+func (p *parser) parseList(closing string) ([]node, error) {
+	var items []node
+	if t := p.peek(); t.kind == tokenOperator && t.value == closing {
+		p.next()
+		return items, nil
+	}
+
+	for {
+		item, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+
+		t := p.next()
+		if t.kind == tokenOperator && t.value == closing {
+			return items, nil
+		}
+		if t.kind != tokenOperator || t.value != "," {
+			return nil, &SyntaxError{Pos: t.pos, Err: xerrors.Errorf("expected , or %v", closing)}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package dag
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// parent is implemented by tasks that contain other tasks
+type parent interface {
+	children() []Task
+}
+
+func (n namedTask) children() []Task {
+	return []Task{n.target}
+}
+
+func (w wrappedTask) children() []Task {
+	return []Task{w.original}
+}
+
+func (p *parallel) children() []Task {
+	return p.raw
+}
+
+func (s *serial) children() []Task {
+	return s.raw
+}
+
+func (c *conditional) children() []Task {
+	return c.raw
+}
+
+// WriteDOT renders the task and its children as a graph in the Graphviz DOT
+// language.  Containers are rendered as clusters with edges reflecting the
+// order in which tasks execute
+func WriteDOT(w io.Writer, task Task) error {
+	g := &graph{}
+	g.walk(task, "", 1)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("digraph dag {\n")
+	buf.WriteString("  rankdir=LR;\n")
+	buf.WriteString("  node [shape=box];\n")
+	buf.Write(g.body.Bytes())
+	for _, edge := range g.edges {
+		fmt.Fprintf(buf, "  %v -> %v;\n", edge[0], edge[1])
+	}
+	buf.WriteString("}\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type graph struct {
+	body  bytes.Buffer
+	edges [][2]string
+	n     int
+}
+
+func (g *graph) id() string {
+	g.n++
+	return "n" + strconv.Itoa(g.n)
+}
+
+func (g *graph) connect(from, to []string) {
+	for _, a := range from {
+		for _, b := range to {
+			g.edges = append(g.edges, [2]string{a, b})
+		}
+	}
+}
+
+// walk renders task at the specified indent and returns the nodes through which
+// execution enters and exits the task
+func (g *graph) walk(task Task, name string, indent int) (entries, exits []string) {
+	if name == "" {
+		name = Name(task)
+	}
+	prefix := strings.Repeat("  ", indent)
+
+	switch v := task.(type) {
+	case *serial:
+		g.openCluster(prefix, name)
+		for _, child := range v.raw {
+			in, out := g.walk(child, "", indent+1)
+			if len(in) == 0 {
+				continue
+			}
+			if len(entries) == 0 {
+				entries = in
+			}
+			g.connect(exits, in)
+			exits = out
+		}
+		g.closeCluster(prefix)
+		return entries, exits
+
+	case *parallel, *conditional:
+		g.openCluster(prefix, name)
+		for _, child := range v.(parent).children() {
+			in, out := g.walk(child, "", indent+1)
+			entries = append(entries, in...)
+			exits = append(exits, out...)
+		}
+		g.closeCluster(prefix)
+		return entries, exits
+
+	case parent:
+		if children := v.children(); len(children) == 1 {
+			if _, ok := children[0].(parent); ok {
+				return g.walk(children[0], name, indent)
+			}
+		}
+	}
+
+	id := g.id()
+	fmt.Fprintf(&g.body, "%v%v [label=%v];\n", prefix, id, strconv.Quote(name))
+	return []string{id}, []string{id}
+}
+
+func (g *graph) openCluster(prefix, name string) {
+	fmt.Fprintf(&g.body, "%vsubgraph cluster_%v {\n", prefix, g.id())
+	fmt.Fprintf(&g.body, "%v  label=%v;\n", prefix, strconv.Quote(name))
+}
+
+func (g *graph) closeCluster(prefix string) {
+	fmt.Fprintf(&g.body, "%v}\n", prefix)
+}
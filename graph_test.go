@@ -0,0 +1,53 @@
+package dag
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func TestWriteDOT(t *testing.T) {
+	task := Serial(
+		WithName("a", nopTask()),
+		WithName("fan out", Parallel(
+			WithName("b", nopTask()),
+			WithName("c", nopTask()),
+		)),
+		WithName("d", nopTask()),
+	)
+
+	want := `digraph dag {
+  rankdir=LR;
+  node [shape=box];
+  subgraph cluster_n1 {
+    label="Serial";
+    n2 [label="a"];
+    subgraph cluster_n3 {
+      label="fan out";
+      n4 [label="b"];
+      n5 [label="c"];
+    }
+    n6 [label="d"];
+  }
+  n2 -> n4;
+  n2 -> n5;
+  n4 -> n6;
+  n5 -> n6;
+}
+`
+
+	t.Run("raw", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := WriteDOT(buf, task)
+		assert.Nil(t, err)
+		assert.Equal(t, want, buf.String())
+	})
+
+	t.Run("wrapped", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := WriteDOT(buf, Wrap(task, Recover))
+		assert.Nil(t, err)
+		assert.Equal(t, want, buf.String())
+	})
+}
@@ -0,0 +1,209 @@
+package dag
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Redacted replaces the value of sensitive fields in log output
+const Redacted = "[REDACTED]"
+
+type loggerOptions struct {
+	level      slog.Level
+	sampleRate int
+	changes    bool
+	redact     map[string]struct{}
+}
+
+// LoggerOption provides functional options for Logger
+type LoggerOption func(*loggerOptions)
+
+// WithLogLevel sets the level used for successful tasks and dropped records;
+// failures are always logged at slog.LevelError.  Defaults to slog.LevelInfo
+func WithLogLevel(level slog.Level) LoggerOption {
+	return func(o *loggerOptions) {
+		o.level = level
+	}
+}
+
+// WithLogSampling logs 1 in n successful records.  Failures are always logged.
+// Sampling is decided per record so either all or none of a record's tasks are
+// logged
+func WithLogSampling(n int) LoggerOption {
+	return func(o *loggerOptions) {
+		o.sampleRate = n
+	}
+}
+
+// WithLogChanges includes the fields changed by each task in the finish entry
+func WithLogChanges() LoggerOption {
+	return func(o *loggerOptions) {
+		o.changes = true
+	}
+}
+
+// WithLogRedaction replaces the values of the specified fields with Redacted
+func WithLogRedaction(fields ...string) LoggerOption {
+	return func(o *loggerOptions) {
+		for _, field := range fields {
+			o.redact[field] = struct{}{}
+		}
+	}
+}
+
+// Logger returns middleware that logs the start and finish of each task using
+// the provided slog.Logger.  If logger is nil, slog.Default() will be used
+func Logger(logger *slog.Logger, opts ...LoggerOption) func(Task) Task {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	options := loggerOptions{
+		level:  slog.LevelInfo,
+		redact: map[string]struct{}{},
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var counter uint64
+	sampled := func(meta Meta) bool {
+		n := uint64(options.sampleRate)
+		if n <= 1 {
+			return true
+		}
+		if meta.ID == "" {
+			return atomic.AddUint64(&counter, 1)%n == 0
+		}
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(meta.ID))
+		return h.Sum64()%n == 0
+	}
+
+	return func(task Task) Task {
+		// begin logs the start of the task for record, returning a func that
+		// logs its outcome
+		begin := func(ctx context.Context, record *Record) func(elapsed time.Duration, err error) {
+			var (
+				path  = Path(ctx)
+				meta  = record.Meta()
+				keep  = sampled(meta)
+				attrs = []slog.Attr{
+					slog.String("task", taskName(path, task)),
+					slog.String("path", strings.Join(path, "/")),
+					slog.Int("depth", Depth(ctx)),
+					slog.String("record_id", meta.ID),
+				}
+			)
+
+			if keep {
+				logger.LogAttrs(ctx, options.level, "task started", attrs...)
+			}
+
+			var before map[string]interface{}
+			if options.changes {
+				before = record.Copy()
+			}
+
+			return func(elapsed time.Duration, err error) {
+				attrs = append(attrs, slog.Duration("duration", elapsed))
+
+				if options.changes {
+					attrs = append(attrs, changes(before, record.Copy(), options.redact)...)
+				}
+
+				switch {
+				case IsDropped(err):
+					if keep {
+						attrs = append(attrs, slog.String("reason", dropReason(err)))
+						logger.LogAttrs(ctx, options.level, "record dropped", attrs...)
+					}
+				case err != nil:
+					attrs = append(attrs, slog.String("error", err.Error()))
+					logger.LogAttrs(ctx, slog.LevelError, "task failed", attrs...)
+				case keep:
+					logger.LogAttrs(ctx, options.level, "task finished", attrs...)
+				}
+			}
+		}
+
+		apply := func(ctx context.Context, record *Record) error {
+			finish := begin(ctx, record)
+
+			started := time.Now()
+			err := task.Apply(ctx, record)
+			finish(time.Since(started), err)
+
+			return err
+		}
+
+		// batch logs each record of the batch with the duration of the batch
+		batch := func(ctx context.Context, records []*Record) []error {
+			finishes := make([]func(time.Duration, error), 0, len(records))
+			for _, record := range records {
+				finishes = append(finishes, begin(ctx, record))
+			}
+
+			started := time.Now()
+			errs := applyBatch(ctx, task, records)
+			elapsed := time.Since(started)
+			for i, finish := range finishes {
+				finish(elapsed, errs[i])
+			}
+
+			return errs
+		}
+
+		return middlewareTask(task, apply, batch)
+	}
+}
+
+// taskName returns the name of the currently executing task
+func taskName(path []string, task Task) string {
+	if n := len(path); n > 0 {
+		return path[n-1]
+	}
+	return Name(task)
+}
+
+// changes returns the fields modified between before and after as log attributes
+func changes(before, after map[string]interface{}, redact map[string]struct{}) []slog.Attr {
+	var changed []slog.Attr
+	for k, v := range after {
+		if prev, ok := before[k]; ok && reflect.DeepEqual(prev, v) {
+			continue
+		}
+		if _, ok := redact[k]; ok {
+			v = Redacted
+		}
+		changed = append(changed, slog.Any(k, v))
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Key < changed[j].Key })
+
+	var deleted []string
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			deleted = append(deleted, k)
+		}
+	}
+	sort.Strings(deleted)
+
+	var attrs []slog.Attr
+	if len(changed) > 0 {
+		args := make([]interface{}, 0, len(changed))
+		for _, attr := range changed {
+			args = append(args, attr)
+		}
+		attrs = append(attrs, slog.Group("changed", args...))
+	}
+	if len(deleted) > 0 {
+		attrs = append(attrs, slog.Any("deleted", deleted))
+	}
+	return attrs
+}
@@ -0,0 +1,166 @@
+package dag
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strconv"
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func readEntries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var entries []map[string]interface{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		assert.Nil(t, err)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestLogger(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("start and finish", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		logger := slog.New(slog.NewJSONHandler(buf, nil))
+
+		task := Serial(WithName("a", nopTask()))
+		task = Wrap(task, Logger(logger))
+
+		record := NewRecord(Meta{ID: "abc"})
+		err := task.Apply(ctx, record)
+		assert.Nil(t, err)
+
+		entries := readEntries(t, buf)
+		assert.Len(t, entries, 4)
+		assert.Equal(t, "task started", entries[0]["msg"])
+		assert.Equal(t, "Serial", entries[0]["task"])
+		assert.Equal(t, "task started", entries[1]["msg"])
+		assert.Equal(t, "a", entries[1]["task"])
+		assert.Equal(t, "Serial/a", entries[1]["path"])
+		assert.EqualValues(t, 1, entries[1]["depth"])
+		assert.Equal(t, "abc", entries[1]["record_id"])
+		assert.Equal(t, "task finished", entries[2]["msg"])
+		assert.Contains(t, entries[2], "duration")
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		logger := slog.New(slog.NewJSONHandler(buf, nil))
+
+		task := Wrap(WithName("boom", TaskFunc(func(ctx context.Context, record *Record) error {
+			return io.EOF
+		})), Logger(logger))
+
+		err := task.Apply(ctx, &Record{})
+		assert.Equal(t, io.EOF, err)
+
+		entries := readEntries(t, buf)
+		assert.Len(t, entries, 2)
+		assert.Equal(t, "task failed", entries[1]["msg"])
+		assert.Equal(t, "ERROR", entries[1]["level"])
+		assert.Equal(t, io.EOF.Error(), entries[1]["error"])
+	})
+
+	t.Run("dropped", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		logger := slog.New(slog.NewJSONHandler(buf, nil))
+
+		task := Wrap(WithName("filter", TaskFunc(func(ctx context.Context, record *Record) error {
+			return Drop("too old")
+		})), Logger(logger))
+
+		err := task.Apply(ctx, &Record{})
+		assert.True(t, IsDropped(err))
+
+		entries := readEntries(t, buf)
+		assert.Len(t, entries, 2)
+		assert.Equal(t, "record dropped", entries[1]["msg"])
+		assert.Equal(t, "INFO", entries[1]["level"])
+		assert.Equal(t, "too old", entries[1]["reason"])
+		assert.NotContains(t, entries[1], "error")
+	})
+
+	t.Run("sampling", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		logger := slog.New(slog.NewJSONHandler(buf, nil))
+
+		var fail bool
+		task := Wrap(WithName("a", TaskFunc(func(ctx context.Context, record *Record) error {
+			if fail {
+				return io.EOF
+			}
+			return nil
+		})), Logger(logger, WithLogSampling(10)))
+
+		for i := 0; i < 100; i++ {
+			err := task.Apply(ctx, NewRecord(Meta{ID: strconv.Itoa(i)}))
+			assert.Nil(t, err)
+		}
+		successes := len(readEntries(t, buf))
+		assert.True(t, successes > 0)
+		assert.True(t, successes < 100)
+
+		fail = true
+		for i := 0; i < 10; i++ {
+			_ = task.Apply(ctx, NewRecord(Meta{ID: strconv.Itoa(i)}))
+		}
+		failures := 0
+		for _, entry := range readEntries(t, buf) {
+			if entry["msg"] == "task failed" {
+				failures++
+			}
+		}
+		assert.Equal(t, 10, failures)
+	})
+
+	t.Run("changes with redaction", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		logger := slog.New(slog.NewJSONHandler(buf, nil))
+
+		task := Wrap(WithName("a", TaskFunc(func(ctx context.Context, record *Record) error {
+			record.Set("name", "joe")
+			record.Set("ssn", "123-45-6789")
+			record.Delete("old")
+			return nil
+		})), Logger(logger, WithLogChanges(), WithLogRedaction("ssn")))
+
+		record := &Record{}
+		record.Set("old", "value")
+		record.Set("same", "value")
+		err := task.Apply(ctx, record)
+		assert.Nil(t, err)
+
+		entries := readEntries(t, buf)
+		assert.Len(t, entries, 2)
+		want := map[string]interface{}{
+			"name": "joe",
+			"ssn":  Redacted,
+		}
+		assert.Equal(t, want, entries[1]["changed"])
+		assert.Equal(t, []interface{}{"old"}, entries[1]["deleted"])
+	})
+}
+
+func TestPath(t *testing.T) {
+	var got []string
+	task := Serial(
+		Parallel(WithName("a", TaskFunc(func(ctx context.Context, record *Record) error {
+			got = Path(ctx)
+			return nil
+		}))),
+	)
+	task = Wrap(task)
+
+	err := task.Apply(context.Background(), &Record{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Serial", "Parallel", "a"}, got)
+}
@@ -0,0 +1,241 @@
+package dag
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Collector receives metrics from the Metrics middleware.  Implementations must
+// be safe for concurrent use
+type Collector interface {
+	// Started is invoked as a task begins
+	Started(pipeline, task string)
+
+	// Finished is invoked once a task completes; err is nil on success.  Use
+	// IsDropped to distinguish dropped records from failures
+	Finished(pipeline, task string, elapsed time.Duration, err error)
+}
+
+// Metrics returns middleware that reports each task to the collector labelled
+// with the pipeline and task name.  Each record of a batch is reported with the
+// elapsed time of the batch
+func Metrics(pipeline string, collector Collector) func(Task) Task {
+	return func(task Task) Task {
+		apply := func(ctx context.Context, record *Record) error {
+			name := taskName(Path(ctx), task)
+			collector.Started(pipeline, name)
+
+			started := time.Now()
+			err := task.Apply(ctx, record)
+			collector.Finished(pipeline, name, time.Since(started), err)
+
+			return err
+		}
+
+		batch := func(ctx context.Context, records []*Record) []error {
+			name := taskName(Path(ctx), task)
+			for range records {
+				collector.Started(pipeline, name)
+			}
+
+			started := time.Now()
+			errs := applyBatch(ctx, task, records)
+			elapsed := time.Since(started)
+			for _, err := range errs {
+				collector.Finished(pipeline, name, elapsed, err)
+			}
+
+			return errs
+		}
+
+		return middlewareTask(task, apply, batch)
+	}
+}
+
+// DefaultBuckets are the latency histogram buckets, in seconds, used when none
+// are provided to NewPrometheusCollector
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type seriesKey struct {
+	pipeline string
+	task     string
+}
+
+type series struct {
+	success  uint64
+	failure  uint64
+	dropped  uint64
+	inFlight int64
+	sum      float64
+	counts   []uint64 // per bucket, non-cumulative
+}
+
+// PrometheusCollector is an in-memory Collector that exposes its metrics in the
+// Prometheus text exposition format
+type PrometheusCollector struct {
+	buckets []float64
+	mutex   sync.Mutex
+	series  map[seriesKey]*series
+}
+
+// NewPrometheusCollector returns a new collector using the provided histogram
+// buckets or DefaultBuckets if none are specified
+func NewPrometheusCollector(buckets ...float64) *PrometheusCollector {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &PrometheusCollector{
+		buckets: buckets,
+		series:  map[seriesKey]*series{},
+	}
+}
+
+// get returns the series for the labels; must be called with the mutex held
+func (c *PrometheusCollector) get(pipeline, task string) *series {
+	key := seriesKey{pipeline: pipeline, task: task}
+	s, ok := c.series[key]
+	if !ok {
+		s = &series{counts: make([]uint64, len(c.buckets)+1)}
+		c.series[key] = s
+	}
+	return s
+}
+
+// Started implements Collector
+func (c *PrometheusCollector) Started(pipeline, task string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.get(pipeline, task).inFlight++
+}
+
+// Finished implements Collector
+func (c *PrometheusCollector) Finished(pipeline, task string, elapsed time.Duration, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	s := c.get(pipeline, task)
+	s.inFlight--
+	switch {
+	case err == nil:
+		s.success++
+	case IsDropped(err):
+		s.dropped++
+	default:
+		s.failure++
+	}
+
+	seconds := elapsed.Seconds()
+	s.sum += seconds
+	s.counts[sort.SearchFloat64s(c.buckets, seconds)]++
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (c *PrometheusCollector) WriteTo(w io.Writer) (int64, error) {
+	c.mutex.Lock()
+	keys := make([]seriesKey, 0, len(c.series))
+	snapshot := make(map[seriesKey]series, len(c.series))
+	for k, s := range c.series {
+		keys = append(keys, k)
+		dupe := *s
+		dupe.counts = append([]uint64(nil), s.counts...)
+		snapshot[k] = dupe
+	}
+	c.mutex.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].pipeline != keys[j].pipeline {
+			return keys[i].pipeline < keys[j].pipeline
+		}
+		return keys[i].task < keys[j].task
+	})
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+
+	fmt.Fprintln(cw, "# HELP dag_task_total Number of completed tasks by status.")
+	fmt.Fprintln(cw, "# TYPE dag_task_total counter")
+	for _, k := range keys {
+		s := snapshot[k]
+		fmt.Fprintf(cw, "dag_task_total{%s,status=\"success\"} %d\n", k.labels(), s.success)
+		fmt.Fprintf(cw, "dag_task_total{%s,status=\"failure\"} %d\n", k.labels(), s.failure)
+		fmt.Fprintf(cw, "dag_task_total{%s,status=\"dropped\"} %d\n", k.labels(), s.dropped)
+	}
+
+	fmt.Fprintln(cw, "# HELP dag_task_in_flight Number of tasks currently executing.")
+	fmt.Fprintln(cw, "# TYPE dag_task_in_flight gauge")
+	for _, k := range keys {
+		fmt.Fprintf(cw, "dag_task_in_flight{%s} %d\n", k.labels(), snapshot[k].inFlight)
+	}
+
+	fmt.Fprintln(cw, "# HELP dag_task_duration_seconds Task latency in seconds.")
+	fmt.Fprintln(cw, "# TYPE dag_task_duration_seconds histogram")
+	for _, k := range keys {
+		s := snapshot[k]
+		var cumulative uint64
+		for i, upper := range c.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(cw, "dag_task_duration_seconds_bucket{%s,le=\"%s\"} %d\n", k.labels(), formatFloat(upper), cumulative)
+		}
+		cumulative += s.counts[len(c.buckets)]
+		fmt.Fprintf(cw, "dag_task_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", k.labels(), cumulative)
+		fmt.Fprintf(cw, "dag_task_duration_seconds_sum{%s} %s\n", k.labels(), formatFloat(s.sum))
+		fmt.Fprintf(cw, "dag_task_duration_seconds_count{%s} %d\n", k.labels(), cumulative)
+	}
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+// ServeHTTP exposes the metrics for scraping by Prometheus
+func (c *PrometheusCollector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = c.WriteTo(w)
+}
+
+func (k seriesKey) labels() string {
+	return `pipeline="` + escapeLabel(k.pipeline) + `",task="` + escapeLabel(k.task) + `"`
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter tracks the bytes written and the first error encountered
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
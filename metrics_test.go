@@ -0,0 +1,91 @@
+package dag
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tj/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		collector = NewPrometheusCollector(0.1, 1)
+		fail      = WithName("fail", TaskFunc(func(ctx context.Context, record *Record) error {
+			return io.EOF
+		}))
+	)
+
+	task := Wrap(Serial(WithName("a", nopTask())), Metrics("orders", collector))
+	err := task.Apply(ctx, &Record{})
+	assert.Nil(t, err)
+
+	task = Wrap(fail, Metrics("orders", collector))
+	err = task.Apply(ctx, &Record{})
+	assert.Equal(t, io.EOF, err)
+
+	task = Wrap(WithName("filter", TaskFunc(func(ctx context.Context, record *Record) error {
+		return ErrDrop
+	})), Metrics("orders", collector))
+	err = task.Apply(ctx, &Record{})
+	assert.Equal(t, ErrDrop, err)
+
+	w := httptest.NewRecorder()
+	collector.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain"))
+
+	body, err := ioutil.ReadAll(w.Body)
+	assert.Nil(t, err)
+
+	for _, want := range []string{
+		`dag_task_total{pipeline="orders",task="Serial",status="success"} 1`,
+		`dag_task_total{pipeline="orders",task="a",status="success"} 1`,
+		`dag_task_total{pipeline="orders",task="fail",status="failure"} 1`,
+		`dag_task_total{pipeline="orders",task="filter",status="dropped"} 1`,
+		`dag_task_total{pipeline="orders",task="filter",status="failure"} 0`,
+		`dag_task_in_flight{pipeline="orders",task="a"} 0`,
+		`dag_task_duration_seconds_bucket{pipeline="orders",task="a",le="0.1"} 1`,
+		`dag_task_duration_seconds_bucket{pipeline="orders",task="a",le="+Inf"} 1`,
+		`dag_task_duration_seconds_count{pipeline="orders",task="a"} 1`,
+	} {
+		assert.Contains(t, string(body), want)
+	}
+}
+
+func TestPrometheusCollector(t *testing.T) {
+	t.Run("in flight", func(t *testing.T) {
+		collector := NewPrometheusCollector()
+		collector.Started("p", "t")
+
+		buf := &strings.Builder{}
+		_, err := collector.WriteTo(buf)
+		assert.Nil(t, err)
+		assert.Contains(t, buf.String(), `dag_task_in_flight{pipeline="p",task="t"} 1`)
+	})
+
+	t.Run("buckets", func(t *testing.T) {
+		collector := NewPrometheusCollector(1, 2)
+		collector.Finished("p", "t", 500*time.Millisecond, nil)
+		collector.Finished("p", "t", 1500*time.Millisecond, nil)
+		collector.Finished("p", "t", 5*time.Second, nil)
+
+		buf := &strings.Builder{}
+		_, err := collector.WriteTo(buf)
+		assert.Nil(t, err)
+		assert.Contains(t, buf.String(), `dag_task_duration_seconds_bucket{pipeline="p",task="t",le="1"} 1`)
+		assert.Contains(t, buf.String(), `dag_task_duration_seconds_bucket{pipeline="p",task="t",le="2"} 2`)
+		assert.Contains(t, buf.String(), `dag_task_duration_seconds_bucket{pipeline="p",task="t",le="+Inf"} 3`)
+		assert.Contains(t, buf.String(), `dag_task_duration_seconds_sum{pipeline="p",task="t"} 7`)
+	})
+
+	t.Run("escape labels", func(t *testing.T) {
+		assert.Equal(t, `a\"b\\c\nd`, escapeLabel("a\"b\\c\nd"))
+	})
+}
@@ -0,0 +1,481 @@
+// Package pipeline builds dag tasks from declarative YAML or JSON pipeline
+// definitions.  A definition names the pipeline and lists the steps to apply in
+// serial:
+//
+//	name: people
+//	steps:
+//	  - type: canonicalize
+//	    mapper: lower
+//	  - parallel:
+//	      - type: normalize
+//	        field: name
+//	        mapper: upper
+//	      - type: delete
+//	        fields: [ssn]
+//	  - if:
+//	      field: state
+//	      equals: CA
+//	    then:
+//	      - type: delete
+//	        fields: [county]
+//	  - if: age >= 21
+//	    then:
+//	      - type: compute
+//	        field: full_name
+//	        expr: first + " " + last
+//
+// Task types are provided by a Registry.  As JSON is a subset of YAML, JSON
+// definitions are read the same way
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/savaki/dag"
+	"github.com/savaki/dag/expr"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+// Error describes an invalid pipeline definition
+type Error struct {
+	// Line and Column within the definition
+	Line, Column int
+	// Path to the offending step e.g. steps[1].parallel[0]
+	Path string
+	// Err describing the problem
+	Err error
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("line %v: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %v: %v: %v", e.Line, e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newError(node *yaml.Node, path string, err error) error {
+	var e *Error
+	if xerrors.As(err, &e) {
+		if e.Path == "" {
+			e.Path = path
+		}
+		return e
+	}
+	return &Error{
+		Line:   node.Line,
+		Column: node.Column,
+		Path:   path,
+		Err:    err,
+	}
+}
+
+// Definition describes a pipeline.  Steps are applied in serial
+type Definition struct {
+	// Name of the pipeline
+	Name string
+	// Steps within the pipeline
+	Steps []Step
+}
+
+// Step is a task, identified by Type, or a block containing other steps
+type Step struct {
+	// Type of task
+	Type string
+	// Label of the task; defaults to Type
+	Label string
+	// Serial steps
+	Serial []Step
+	// Parallel steps
+	Parallel []Step
+	// If holds the condition for Then and Else
+	If *Condition
+	// Then steps applied when the condition is satisfied
+	Then []Step
+	// Else steps applied when the condition is not satisfied
+	Else []Step
+
+	node   *yaml.Node // step as read
+	config *yaml.Node // properties specific to the task type
+	path   string
+}
+
+// Condition is a predicate evaluated against a single field or an expression;
+// see package expr.  A condition written as a string, e.g. if: age >= 21, is
+// an expression
+type Condition struct {
+	// Expr is satisfied when the expression evaluates to true
+	Expr string `yaml:"expr"`
+	// Field to test
+	Field string `yaml:"field"`
+	// Equals is satisfied when the field equals the value
+	Equals interface{} `yaml:"equals"`
+	// NotEquals is satisfied when the field is present and does not equal the value
+	NotEquals interface{} `yaml:"not_equals"`
+	// In is satisfied when the field equals any of the values
+	In []interface{} `yaml:"in"`
+	// Exists is satisfied when the presence of the field matches
+	Exists *bool `yaml:"exists"`
+
+	node *yaml.Node
+}
+
+// Load reads a YAML or JSON pipeline definition
+func Load(r io.Reader) (*Definition, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to read pipeline definition: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, xerrors.Errorf("unable to parse pipeline definition: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, xerrors.New("pipeline definition is empty")
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, newError(root, "", xerrors.New("pipeline definition must be a mapping"))
+	}
+
+	var def Definition
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		switch key.Value {
+		case "name":
+			if err := value.Decode(&def.Name); err != nil {
+				return nil, newError(value, "name", err)
+			}
+		case "steps":
+			steps, err := parseSteps(value, "steps")
+			if err != nil {
+				return nil, err
+			}
+			def.Steps = steps
+		default:
+			return nil, newError(key, "", xerrors.Errorf("unknown property, %v", key.Value))
+		}
+	}
+
+	return &def, nil
+}
+
+func parseSteps(node *yaml.Node, path string) ([]Step, error) {
+	if node.Kind != yaml.SequenceNode {
+		return nil, newError(node, path, xerrors.New("expected a list of steps"))
+	}
+
+	steps := make([]Step, 0, len(node.Content))
+	for i, child := range node.Content {
+		step, err := parseStep(child, path+"["+strconv.Itoa(i)+"]")
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func parseStep(node *yaml.Node, path string) (Step, error) {
+	step := Step{
+		node: node,
+		path: path,
+		config: &yaml.Node{
+			Kind:   yaml.MappingNode,
+			Tag:    "!!map",
+			Line:   node.Line,
+			Column: node.Column,
+		},
+	}
+	if node.Kind != yaml.MappingNode {
+		return step, newError(node, path, xerrors.New("expected a step"))
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		var (
+			key, value = node.Content[i], node.Content[i+1]
+			err        error
+		)
+		switch key.Value {
+		case "type":
+			err = value.Decode(&step.Type)
+		case "label":
+			err = value.Decode(&step.Label)
+		case "serial":
+			step.Serial, err = parseSteps(value, path+".serial")
+		case "parallel":
+			step.Parallel, err = parseSteps(value, path+".parallel")
+		case "then":
+			step.Then, err = parseSteps(value, path+".then")
+		case "else":
+			step.Else, err = parseSteps(value, path+".else")
+		case "if":
+			step.If = &Condition{node: value}
+			if value.Kind == yaml.ScalarNode {
+				step.If.Expr = value.Value
+			} else {
+				err = decodeStrict(value, step.If)
+			}
+		default:
+			step.config.Content = append(step.config.Content, key, value)
+		}
+		if err != nil {
+			return step, newError(value, path, err)
+		}
+	}
+
+	return step, nil
+}
+
+// Build constructs the task described by the definition using the registry or
+// DefaultRegistry if nil
+func (d *Definition) Build(registry *Registry) (dag.Task, error) {
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+
+	tasks, err := buildAll(registry, d.Steps)
+	if err != nil {
+		return nil, err
+	}
+	return named(d.Name, dag.Serial(tasks...)), nil
+}
+
+func buildAll(registry *Registry, steps []Step) ([]dag.Task, error) {
+	tasks := make([]dag.Task, 0, len(steps))
+	for _, step := range steps {
+		task, err := step.build(registry)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+func (s Step) build(registry *Registry) (dag.Task, error) {
+	blocks := 0
+	for _, ok := range []bool{s.Type != "", s.Serial != nil, s.Parallel != nil, s.If != nil} {
+		if ok {
+			blocks++
+		}
+	}
+	switch {
+	case blocks == 0:
+		return nil, newError(s.node, s.path, xerrors.New("type, serial, parallel or if required"))
+	case blocks > 1:
+		return nil, newError(s.node, s.path, xerrors.New("type, serial, parallel and if are mutually exclusive"))
+	case s.If == nil && (s.Then != nil || s.Else != nil):
+		return nil, newError(s.node, s.path, xerrors.New("then and else require if"))
+	case s.Type == "" && len(s.config.Content) > 0:
+		key := s.config.Content[0]
+		return nil, newError(key, s.path, xerrors.Errorf("unknown property, %v", key.Value))
+	}
+
+	switch {
+	case s.Serial != nil:
+		tasks, err := buildAll(registry, s.Serial)
+		if err != nil {
+			return nil, err
+		}
+		return named(s.Label, dag.Serial(tasks...)), nil
+
+	case s.Parallel != nil:
+		tasks, err := buildAll(registry, s.Parallel)
+		if err != nil {
+			return nil, err
+		}
+		return named(s.Label, dag.Parallel(tasks...)), nil
+
+	case s.If != nil:
+		predicate, err := s.If.predicate()
+		if err != nil {
+			return nil, newError(s.If.node, s.path+".if", err)
+		}
+		then, err := buildAll(registry, s.Then)
+		if err != nil {
+			return nil, err
+		}
+		var otherwise dag.Task
+		if s.Else != nil {
+			tasks, err := buildAll(registry, s.Else)
+			if err != nil {
+				return nil, err
+			}
+			otherwise = dag.Serial(tasks...)
+		}
+		return named(s.Label, dag.If(predicate, dag.Serial(then...), otherwise)), nil
+	}
+
+	factory, ok := registry.factory(s.Type)
+	if !ok {
+		return nil, newError(s.node, s.path, xerrors.Errorf("unknown type, %v", s.Type))
+	}
+
+	label := s.Label
+	if label == "" {
+		label = s.Type
+	}
+
+	decode := func(config interface{}) error {
+		if err := decodeStrict(s.config, config); err != nil {
+			return newError(s.config, s.path, err)
+		}
+		return nil
+	}
+
+	task, err := factory(label, decode)
+	if err != nil {
+		return nil, newError(s.node, s.path, xerrors.Errorf("%v: %w", s.Type, err))
+	}
+	return task, nil
+}
+
+// decodeStrict decodes node into v, rejecting properties that do not
+// correspond to a field of the struct v points to
+func decodeStrict(node *yaml.Node, v interface{}) error {
+	if node.Kind == yaml.MappingNode {
+		if t := reflect.TypeOf(v); t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct {
+			known := fieldNames(t.Elem())
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key := node.Content[i]
+				if _, ok := known[key.Value]; !ok {
+					return &Error{
+						Line:   key.Line,
+						Column: key.Column,
+						Err:    xerrors.Errorf("unknown property, %v", key.Value),
+					}
+				}
+			}
+		}
+	}
+
+	if err := node.Decode(v); err != nil {
+		return &Error{
+			Line:   node.Line,
+			Column: node.Column,
+			Err:    err,
+		}
+	}
+	return nil
+}
+
+// fieldNames returns the yaml property names of the exported struct fields
+func fieldNames(t reflect.Type) map[string]struct{} {
+	names := map[string]struct{}{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		name := strings.ToLower(field.Name)
+		if tag := strings.Split(field.Tag.Get("yaml"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		names[name] = struct{}{}
+	}
+	return names
+}
+
+func (c *Condition) predicate() (dag.Predicate, error) {
+	if c.Expr != "" {
+		if c.Field != "" || c.Equals != nil || c.NotEquals != nil || c.In != nil || c.Exists != nil {
+			return nil, xerrors.New("expr cannot be combined with field conditions")
+		}
+		e, err := expr.Compile(c.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return e.Predicate(), nil
+	}
+
+	if c.Field == "" {
+		return nil, xerrors.New("field or expr is required")
+	}
+
+	tests := 0
+	for _, ok := range []bool{c.Equals != nil, c.NotEquals != nil, c.In != nil, c.Exists != nil} {
+		if ok {
+			tests++
+		}
+	}
+	if tests != 1 {
+		return nil, xerrors.New("exactly one of equals, not_equals, in or exists is required")
+	}
+
+	field := c.Field
+	return func(ctx context.Context, record *dag.Record) (bool, error) {
+		v, err := record.Get(field)
+		if err != nil && !dag.IsFieldNotFoundError(err) {
+			return false, err
+		}
+		found := err == nil
+
+		switch {
+		case c.Exists != nil:
+			return found == *c.Exists, nil
+		case c.Equals != nil:
+			return found && equal(v, c.Equals), nil
+		case c.NotEquals != nil:
+			return found && !equal(v, c.NotEquals), nil
+		default:
+			for _, want := range c.In {
+				if found && equal(v, want) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+	}, nil
+}
+
+// equal compares a record value with a value from the definition.  Numbers are
+// compared by value regardless of their type
+func equal(got, want interface{}) bool {
+	if a, ok := toFloat(got); ok {
+		if b, ok := toFloat(want); ok {
+			return a == b
+		}
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+func named(label string, task dag.Task) dag.Task {
+	if label == "" {
+		return task
+	}
+	return dag.WithName(label, task)
+}
@@ -0,0 +1,248 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/savaki/dag"
+	"github.com/tj/assert"
+	"golang.org/x/xerrors"
+)
+
+const testYAML = `name: people
+steps:
+  - type: canonicalize
+    label: lower
+    mapper: lower
+  - parallel:
+      - type: normalize
+        field: name
+        mapper: upper
+      - type: delete
+        fields: [ssn]
+  - if:
+      field: state
+      equals: CA
+    then:
+      - type: delete
+        fields: [county]
+    else:
+      - type: delete
+        fields: [state]
+`
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("yaml", func(t *testing.T) {
+		def, err := Load(strings.NewReader(testYAML))
+		assert.Nil(t, err)
+		assert.Equal(t, "people", def.Name)
+		assert.Len(t, def.Steps, 3)
+
+		task, err := def.Build(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "people", dag.Name(task))
+
+		record := &dag.Record{}
+		record.Set("Name", "joe")
+		record.Set("SSN", "123")
+		record.Set("State", "CA")
+		record.Set("County", "Alameda")
+		err = task.Apply(ctx, record)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{"name": "JOE", "state": "CA"}, record.Copy())
+
+		record = &dag.Record{}
+		record.Set("State", "NV")
+		record.Set("County", "Washoe")
+		err = task.Apply(ctx, record)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{"county": "Washoe"}, record.Copy())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		input := `{
+	"name": "people",
+	"steps": [
+		{"serial": [{"type": "delete", "fields": ["a"]}]}
+	]
+}`
+		def, err := Load(strings.NewReader(input))
+		assert.Nil(t, err)
+
+		task, err := def.Build(nil)
+		assert.Nil(t, err)
+
+		record := &dag.Record{}
+		record.Set("a", "alpha")
+		record.Set("b", "bravo")
+		err = task.Apply(ctx, record)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{"b": "bravo"}, record.Copy())
+	})
+
+	t.Run("invalid yaml", func(t *testing.T) {
+		_, err := Load(strings.NewReader("steps: [\n"))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("load errors", func(t *testing.T) {
+		tests := map[string]string{
+			"blah: 1\n":        "line 1: unknown property, blah",
+			"steps:\n  a: b\n": "line 2: steps: expected a list of steps",
+			"steps:\n  - 1\n":  "line 2: steps[0]: expected a step",
+			"steps:\n  - if:\n      field: a\n      x: 1": "line 4: steps[0]: unknown property, x",
+		}
+		for input, want := range tests {
+			_, err := Load(strings.NewReader(input))
+			assert.NotNil(t, err, input)
+			assert.Equal(t, want, err.Error())
+		}
+	})
+}
+
+func TestDefinition_Build(t *testing.T) {
+	tests := map[string]string{
+		"steps:\n  - type: blah\n":                                    "line 2: steps[0]: unknown type, blah",
+		"steps:\n  - label: x\n":                                      "line 2: steps[0]: type, serial, parallel or if required",
+		"steps:\n  - serial: []\n    parallel: []\n":                  "line 2: steps[0]: type, serial, parallel and if are mutually exclusive",
+		"steps:\n  - serial: []\n    fields: [a]\n":                   "line 3: steps[0]: unknown property, fields",
+		"steps:\n  - serial: []\n    then: []\n":                      "line 2: steps[0]: then and else require if",
+		"steps:\n  - serial:\n    - type: delete\n      blah: 1\n":    "line 4: steps[0].serial[0]: unknown property, blah",
+		"steps:\n  - type: delete\n    fields: abc\n":                 "line 2: steps[0]: yaml: unmarshal errors:\n  line 3: cannot unmarshal !!str `abc` into []string",
+		"steps:\n  - type: canonicalize\n    mapper: title\n":         "line 2: steps[0]: canonicalize: unknown field mapper, title",
+		"steps:\n  - type: canonicalize\n":                            "line 2: steps[0]: canonicalize: one of mapper, mappers or rename is required",
+		"steps:\n  - if:\n      field: a\n    then: []\n":             "line 3: steps[0].if: exactly one of equals, not_equals, in or exists is required",
+		"steps:\n  - if:\n      equals: 1\n    then: []\n":            "line 3: steps[0].if: field or expr is required",
+		"steps:\n  - parallel:\n    - type: enrich\n      key: [a]\n": "line 3: steps[0].parallel[0]: enrich: unknown datasource, ",
+	}
+
+	for input, want := range tests {
+		def, err := Load(strings.NewReader(input))
+		assert.Nil(t, err, input)
+
+		_, err = def.Build(nil)
+		assert.NotNil(t, err, input)
+		assert.Equal(t, want, err.Error())
+
+		var e *Error
+		assert.True(t, xerrors.As(err, &e))
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	ctx := context.Background()
+	input := `steps:
+  - type: compute
+    field: full_name
+    expr: first + " " + last
+  - if: age >= 21
+    then:
+      - type: compute
+        field: adult
+        expr: "true"
+  - if:
+      expr: state == "CA"
+    then:
+      - type: delete
+        fields: [state]
+`
+	def, err := Load(strings.NewReader(input))
+	assert.Nil(t, err)
+
+	task, err := def.Build(nil)
+	assert.Nil(t, err)
+
+	record := &dag.Record{}
+	record.Set("first", "Joe")
+	record.Set("last", "Public")
+	record.Set("age", 30)
+	record.Set("state", "CA")
+	err = task.Apply(ctx, record)
+	assert.Nil(t, err)
+
+	want := map[string]interface{}{
+		"first":     "Joe",
+		"last":      "Public",
+		"age":       30,
+		"full_name": "Joe Public",
+		"adult":     true,
+	}
+	assert.Equal(t, want, record.Copy())
+
+	errors := map[string]string{
+		"steps:\n  - type: filter\n":                                     "line 2: steps[0]: filter: expr is required",
+		"steps:\n  - if: age >=\n    then: []\n":                         `line 2: steps[0].if: invalid expression, "age >=": column 7: unexpected end of expression`,
+		"steps:\n  - if:\n      expr: a\n      field: a\n    then: []\n": "line 3: steps[0].if: expr cannot be combined with field conditions",
+		"steps:\n  - type: compute\n    field: a\n    expr: b +\n":       `line 2: steps[0]: compute: invalid expression, "b +": column 4: unexpected end of expression`,
+		"steps:\n  - type: compute\n    expr: b\n":                       "line 2: steps[0]: compute: field is required",
+	}
+	for input, want := range errors {
+		def, err := Load(strings.NewReader(input))
+		assert.Nil(t, err, input)
+
+		_, err = def.Build(nil)
+		assert.NotNil(t, err, input)
+		assert.Equal(t, want, err.Error())
+	}
+}
+
+func TestFilter(t *testing.T) {
+	ctx := context.Background()
+
+	def, err := Load(strings.NewReader("steps:\n  - type: filter\n    expr: age >= 21\n  - type: delete\n    fields: [age]\n"))
+	assert.Nil(t, err)
+
+	task, err := def.Build(nil)
+	assert.Nil(t, err)
+
+	record := &dag.Record{}
+	record.Set("age", 30)
+	err = task.Apply(ctx, record)
+	assert.Nil(t, err)
+	assert.Empty(t, record.Copy())
+
+	record = &dag.Record{}
+	record.Set("age", 12)
+	err = task.Apply(ctx, record)
+	assert.True(t, dag.IsDropped(err))
+	assert.Equal(t, map[string]interface{}{"age": 12}, record.Copy())
+}
+
+func TestCondition(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		yes    = true
+		no     = false
+		record = &dag.Record{}
+	)
+	record.Set("state", "CA")
+	record.Set("n", 3)
+
+	tests := []struct {
+		name      string
+		condition Condition
+		want      bool
+	}{
+		{name: "equals", condition: Condition{Field: "state", Equals: "CA"}, want: true},
+		{name: "equals number", condition: Condition{Field: "n", Equals: 3.0}, want: true},
+		{name: "not equals", condition: Condition{Field: "state", NotEquals: "CA"}, want: false},
+		{name: "not equals missing", condition: Condition{Field: "missing", NotEquals: "CA"}, want: false},
+		{name: "in", condition: Condition{Field: "state", In: []interface{}{"NV", "CA"}}, want: true},
+		{name: "exists", condition: Condition{Field: "state", Exists: &yes}, want: true},
+		{name: "not exists", condition: Condition{Field: "missing", Exists: &no}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			predicate, err := tt.condition.predicate()
+			assert.Nil(t, err)
+
+			got, err := predicate(ctx, record)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package pipeline
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/savaki/dag"
+	"github.com/savaki/dag/builtin"
+	"github.com/savaki/dag/expr"
+	"golang.org/x/xerrors"
+)
+
+// Factory constructs a task from its label and configuration.  decode
+// unmarshals the task's configuration into the provided value, typically a
+// pointer to a config struct; unknown properties are reported as errors
+type Factory func(label string, decode func(config interface{}) error) (dag.Task, error)
+
+// Registry holds the task factories, and the named resources they depend on,
+// available to pipeline definitions
+type Registry struct {
+	mutex        sync.RWMutex
+	factories    map[string]Factory
+	dataSources  map[string]builtin.DataSource
+	geocoders    map[string]builtin.Geocoder
+	fieldMappers map[string]builtin.FieldMapperFunc
+	valueMappers map[string]builtin.ValueMapperFunc
+}
+
+// NewRegistry returns a registry containing the builtin task types: delete,
+// canonicalize, normalize, compute, filter, enrich and geocode
+func NewRegistry() *Registry {
+	r := &Registry{
+		factories:    map[string]Factory{},
+		dataSources:  map[string]builtin.DataSource{},
+		geocoders:    map[string]builtin.Geocoder{},
+		fieldMappers: map[string]builtin.FieldMapperFunc{},
+		valueMappers: map[string]builtin.ValueMapperFunc{},
+	}
+	registerBuiltins(r)
+	return r
+}
+
+// DefaultRegistry is used by Build when no registry is provided
+var DefaultRegistry = NewRegistry()
+
+// Register a task factory with the DefaultRegistry
+func Register(typeName string, factory Factory) {
+	DefaultRegistry.Register(typeName, factory)
+}
+
+// Register a task factory by type name, replacing any existing factory
+func (r *Registry) Register(typeName string, factory Factory) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.factories[typeName] = factory
+}
+
+// RegisterDataSource makes a DataSource available to enrich tasks by name
+func (r *Registry) RegisterDataSource(name string, ds builtin.DataSource) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.dataSources[name] = ds
+}
+
+// RegisterGeocoder makes a Geocoder available to geocode tasks by name
+func (r *Registry) RegisterGeocoder(name string, geocoder builtin.Geocoder) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.geocoders[name] = geocoder
+}
+
+// RegisterFieldMapper makes a FieldMapperFunc available to canonicalize tasks
+// by name
+func (r *Registry) RegisterFieldMapper(name string, fn builtin.FieldMapperFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.fieldMappers[name] = fn
+}
+
+// RegisterValueMapper makes a ValueMapperFunc available to normalize tasks by
+// name
+func (r *Registry) RegisterValueMapper(name string, fn builtin.ValueMapperFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.valueMappers[name] = fn
+}
+
+func (r *Registry) factory(typeName string) (Factory, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	v, ok := r.factories[typeName]
+	return v, ok
+}
+
+func (r *Registry) dataSource(name string) (builtin.DataSource, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	v, ok := r.dataSources[name]
+	if !ok {
+		return nil, xerrors.Errorf("unknown datasource, %v", name)
+	}
+	return v, nil
+}
+
+func (r *Registry) geocoder(name string) (builtin.Geocoder, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	v, ok := r.geocoders[name]
+	if !ok {
+		return nil, xerrors.Errorf("unknown geocoder, %v", name)
+	}
+	return v, nil
+}
+
+func (r *Registry) fieldMapper(name string) (builtin.FieldMapperFunc, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	v, ok := r.fieldMappers[name]
+	if !ok {
+		return nil, xerrors.Errorf("unknown field mapper, %v", name)
+	}
+	return v, nil
+}
+
+func (r *Registry) valueMapper(name string) (builtin.ValueMapperFunc, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	v, ok := r.valueMappers[name]
+	if !ok {
+		return nil, xerrors.Errorf("unknown value mapper, %v", name)
+	}
+	return v, nil
+}
+
+func registerBuiltins(r *Registry) {
+	for name, fn := range map[string]func(string) string{
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+		"trim":  strings.TrimSpace,
+	} {
+		fn := fn
+		r.RegisterFieldMapper(name, func(field string) (string, error) {
+			return fn(field), nil
+		})
+		r.RegisterValueMapper(name, func(v interface{}) (interface{}, error) {
+			if s, ok := v.(string); ok {
+				return fn(s), nil
+			}
+			return v, nil
+		})
+	}
+
+	for name, fn := range map[string]builtin.FieldMapperFunc{
+		"snake":        builtin.SnakeCase,
+		"kebab":        builtin.KebabCase,
+		"camel":        builtin.CamelCase,
+		"alphanumeric": builtin.StripNonAlphanumeric,
+	} {
+		r.RegisterFieldMapper(name, fn)
+	}
+
+	r.Register("delete", func(label string, decode func(interface{}) error) (dag.Task, error) {
+		var config struct {
+			Fields []string `yaml:"fields"`
+		}
+		if err := decode(&config); err != nil {
+			return nil, err
+		}
+		return builtin.Delete(label, config.Fields...), nil
+	})
+
+	r.Register("canonicalize", func(label string, decode func(interface{}) error) (dag.Task, error) {
+		var config struct {
+			Mapper    string            `yaml:"mapper"`
+			Mappers   []string          `yaml:"mappers"`
+			Rename    map[string]string `yaml:"rename"`
+			Collision string            `yaml:"collision"`
+		}
+		if err := decode(&config); err != nil {
+			return nil, err
+		}
+		switch {
+		case config.Mapper != "" && len(config.Mappers) > 0:
+			return nil, xerrors.New("mapper and mappers cannot be combined")
+		case config.Mapper == "" && len(config.Mappers) == 0 && len(config.Rename) == 0:
+			return nil, xerrors.New("one of mapper, mappers or rename is required")
+		}
+
+		var mappers []builtin.FieldMapperFunc
+		if len(config.Rename) > 0 {
+			mappers = append(mappers, builtin.Rename(config.Rename))
+		}
+		names := config.Mappers
+		if config.Mapper != "" {
+			names = []string{config.Mapper}
+		}
+		for _, name := range names {
+			fn, err := r.fieldMapper(name)
+			if err != nil {
+				return nil, err
+			}
+			mappers = append(mappers, fn)
+		}
+
+		var opts []builtin.CanonicalizeOption
+		switch config.Collision {
+		case "", "error":
+		case "first":
+			opts = append(opts, builtin.OnCollision(builtin.CollisionKeepFirst))
+		case "list":
+			opts = append(opts, builtin.OnCollision(builtin.CollisionList))
+		default:
+			return nil, xerrors.Errorf("unknown collision, %v; expected error, first or list", config.Collision)
+		}
+		return builtin.Canonicalize(label, builtin.ChainMappers(mappers...), opts...), nil
+	})
+
+	r.Register("normalize", func(label string, decode func(interface{}) error) (dag.Task, error) {
+		var config struct {
+			Field  string `yaml:"field"`
+			Mapper string `yaml:"mapper"`
+		}
+		if err := decode(&config); err != nil {
+			return nil, err
+		}
+		if config.Field == "" {
+			return nil, xerrors.New("field is required")
+		}
+		fn, err := r.valueMapper(config.Mapper)
+		if err != nil {
+			return nil, err
+		}
+		return dag.WithName(label, builtin.Normalize(config.Field, fn)), nil
+	})
+
+	r.Register("compute", func(label string, decode func(interface{}) error) (dag.Task, error) {
+		var config struct {
+			Field string `yaml:"field"`
+			Expr  string `yaml:"expr"`
+		}
+		if err := decode(&config); err != nil {
+			return nil, err
+		}
+		if config.Field == "" {
+			return nil, xerrors.New("field is required")
+		}
+		e, err := expr.Compile(config.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return builtin.Compute(label, config.Field, e), nil
+	})
+
+	r.Register("filter", func(label string, decode func(interface{}) error) (dag.Task, error) {
+		var config struct {
+			Expr string `yaml:"expr"`
+		}
+		if err := decode(&config); err != nil {
+			return nil, err
+		}
+		if config.Expr == "" {
+			return nil, xerrors.New("expr is required")
+		}
+		e, err := expr.Compile(config.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return builtin.Filter(label, e.Predicate()), nil
+	})
+
+	r.Register("enrich", func(label string, decode func(interface{}) error) (dag.Task, error) {
+		var config struct {
+			DataSource string                 `yaml:"datasource"`
+			Key        []string               `yaml:"key"`
+			Fields     []string               `yaml:"fields"`
+			Prefix     string                 `yaml:"prefix"`
+			Merge      string                 `yaml:"merge"`
+			NotFound   string                 `yaml:"not_found"`
+			Defaults   map[string]interface{} `yaml:"defaults"`
+			Required   []string               `yaml:"required"`
+			Target     string                 `yaml:"target"`
+			TargetList string                 `yaml:"target_list"`
+		}
+		if err := decode(&config); err != nil {
+			return nil, err
+		}
+		ds, err := r.dataSource(config.DataSource)
+		if err != nil {
+			return nil, err
+		}
+		if len(config.Key) == 0 {
+			return nil, xerrors.New("key is required")
+		}
+
+		opts := taskOptions(config.Fields, config.Prefix)
+		switch config.Merge {
+		case "", "overwrite":
+		case "if_absent":
+			opts = append(opts, builtin.WithMerge(builtin.MergeIfAbsent))
+		case "if_empty":
+			opts = append(opts, builtin.WithMerge(builtin.MergeIfEmpty))
+		default:
+			return nil, xerrors.Errorf("unknown merge, %v; expected overwrite, if_absent or if_empty", config.Merge)
+		}
+		switch config.NotFound {
+		case "", "error":
+		case "skip":
+			opts = append(opts, builtin.SkipNotFound())
+		default:
+			return nil, xerrors.Errorf("unknown not_found, %v; expected error or skip", config.NotFound)
+		}
+		if config.Defaults != nil {
+			opts = append(opts, builtin.WithDefaults(config.Defaults))
+		}
+		if len(config.Required) > 0 {
+			opts = append(opts, builtin.WithRequired(config.Required...))
+		}
+		switch {
+		case config.Target != "" && config.TargetList != "":
+			return nil, xerrors.New("target and target_list cannot be combined")
+		case config.Target != "":
+			opts = append(opts, builtin.WithTarget(config.Target))
+		case config.TargetList != "":
+			opts = append(opts, builtin.WithTargetList(config.TargetList))
+		}
+
+		return builtin.Enrich(label, ds, builtin.BasicKeyFunc(config.Key[0], config.Key[1:]...), opts...), nil
+	})
+
+	r.Register("geocode", func(label string, decode func(interface{}) error) (dag.Task, error) {
+		var config struct {
+			Geocoder string   `yaml:"geocoder"`
+			Street   string   `yaml:"street"`
+			City     string   `yaml:"city"`
+			State    string   `yaml:"state"`
+			Fields   []string `yaml:"fields"`
+			Prefix   string   `yaml:"prefix"`
+			NotFound string   `yaml:"not_found"`
+		}
+		if err := decode(&config); err != nil {
+			return nil, err
+		}
+		geocoder, err := r.geocoder(config.Geocoder)
+		if err != nil {
+			return nil, err
+		}
+
+		opts := taskOptions(config.Fields, config.Prefix)
+		switch config.NotFound {
+		case "", "error":
+		case "skip":
+			opts = append(opts, builtin.SkipNotFound())
+		default:
+			return nil, xerrors.Errorf("unknown not_found, %v; expected error or skip", config.NotFound)
+		}
+		return builtin.Geocode(label, geocoder, config.Street, config.City, config.State, opts...), nil
+	})
+}
+
+func taskOptions(fields []string, prefix string) []builtin.Option {
+	var opts []builtin.Option
+	if len(fields) > 0 {
+		opts = append(opts, builtin.WithFields(fields...))
+	}
+	if prefix != "" {
+		opts = append(opts, builtin.WithPrefix(prefix))
+	}
+	return opts
+}
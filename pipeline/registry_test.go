@@ -0,0 +1,224 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/savaki/dag"
+	"github.com/savaki/dag/builtin"
+	"github.com/tj/assert"
+	"golang.org/x/xerrors"
+)
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("custom type", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.Register("set", func(label string, decode func(interface{}) error) (dag.Task, error) {
+			var config struct {
+				Field string      `yaml:"field"`
+				Value interface{} `yaml:"value"`
+			}
+			if err := decode(&config); err != nil {
+				return nil, err
+			}
+			if config.Field == "" {
+				return nil, xerrors.New("field is required")
+			}
+			return dag.WithName(label, dag.TaskFunc(func(ctx context.Context, record *dag.Record) error {
+				record.Set(config.Field, config.Value)
+				return nil
+			})), nil
+		})
+
+		def, err := Load(strings.NewReader("steps:\n  - type: set\n    field: a\n    value: 1\n"))
+		assert.Nil(t, err)
+
+		task, err := def.Build(registry)
+		assert.Nil(t, err)
+
+		record := &dag.Record{}
+		err = task.Apply(ctx, record)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{"a": 1}, record.Copy())
+
+		def, err = Load(strings.NewReader("steps:\n  - type: set\n    value: 1\n"))
+		assert.Nil(t, err)
+		_, err = def.Build(registry)
+		assert.Equal(t, "line 2: steps[0]: set: field is required", err.Error())
+
+		// custom types are not visible to other registries
+		_, err = def.Build(nil)
+		assert.Equal(t, "line 2: steps[0]: unknown type, set", err.Error())
+	})
+
+	t.Run("canonicalize mappers", func(t *testing.T) {
+		input := `steps:
+  - type: canonicalize
+    rename:
+      FName: First Name
+    mappers: [alphanumeric, snake]
+`
+		def, err := Load(strings.NewReader(input))
+		assert.Nil(t, err)
+		task, err := def.Build(nil)
+		assert.Nil(t, err)
+
+		record := &dag.Record{}
+		record.Set("FName", "a")
+		record.Set("Last-Name", "b")
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, map[string]interface{}{"first_name": "a", "last_name": "b"}, record.Copy())
+
+		def, err = Load(strings.NewReader("steps:\n  - type: canonicalize\n    mapper: snake\n    collision: first\n"))
+		assert.Nil(t, err)
+		task, err = def.Build(nil)
+		assert.Nil(t, err)
+		record = &dag.Record{}
+		record.Set("First Name", "a")
+		record.Set("first_name", "")
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, map[string]interface{}{"first_name": "a"}, record.Copy())
+
+		def, err = Load(strings.NewReader("steps:\n  - type: canonicalize\n    mapper: snake\n    collision: last\n"))
+		assert.Nil(t, err)
+		_, err = def.Build(nil)
+		assert.Equal(t, "line 2: steps[0]: canonicalize: unknown collision, last; expected error, first or list", err.Error())
+
+		def, err = Load(strings.NewReader("steps:\n  - type: canonicalize\n    mapper: snake\n    mappers: [camel]\n"))
+		assert.Nil(t, err)
+		_, err = def.Build(nil)
+		assert.Equal(t, "line 2: steps[0]: canonicalize: mapper and mappers cannot be combined", err.Error())
+	})
+
+	t.Run("enrich and geocode", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.RegisterDataSource("customers", builtin.NestedMapDataSource{
+			"a:b": {"tier": "gold", "ignored": true},
+		})
+		registry.RegisterGeocoder("static", geocoder{"lat": 1.5})
+
+		input := `steps:
+  - type: enrich
+    datasource: customers
+    key: [first, last]
+    fields: [tier]
+    prefix: customer_
+  - type: geocode
+    geocoder: static
+    street: street
+    state: state
+`
+		def, err := Load(strings.NewReader(input))
+		assert.Nil(t, err)
+
+		task, err := def.Build(registry)
+		assert.Nil(t, err)
+
+		record := &dag.Record{}
+		record.Set("first", "a")
+		record.Set("last", "b")
+		record.Set("street", "1 Main")
+		record.Set("state", "CA")
+		err = task.Apply(ctx, record)
+		assert.Nil(t, err)
+
+		tier, _ := record.String("customer_tier")
+		assert.Equal(t, "gold", tier)
+		lat, _ := record.Float64("lat")
+		assert.Equal(t, 1.5, lat)
+	})
+
+	t.Run("geocode not found", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.RegisterGeocoder("none", geocoder(nil))
+
+		record := &dag.Record{}
+		record.Set("street", "1 Main")
+		record.Set("state", "CA")
+
+		for input, want := range map[string]string{
+			"steps:\n  - type: geocode\n    geocoder: none\n    street: street\n    state: state\n":                      "address not found, 1 Main, CA",
+			"steps:\n  - type: geocode\n    geocoder: none\n    street: street\n    state: state\n    not_found: skip\n": "",
+		} {
+			def, err := Load(strings.NewReader(input))
+			assert.Nil(t, err)
+			task, err := def.Build(registry)
+			assert.Nil(t, err)
+
+			err = task.Apply(ctx, record)
+			if want == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, builtin.IsNotFound(err))
+				assert.Contains(t, err.Error(), want)
+			}
+		}
+
+		def, err := Load(strings.NewReader("steps:\n  - type: geocode\n    geocoder: none\n    not_found: drop\n"))
+		assert.Nil(t, err)
+		_, err = def.Build(registry)
+		assert.EqualError(t, err, "line 2: steps[0]: geocode: unknown not_found, drop; expected error or skip")
+	})
+
+	t.Run("enrich policies", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.RegisterDataSource("customers", builtin.NestedMapDataSource{
+			"a": {"tier": "gold", "region": "west"},
+		})
+
+		input := `steps:
+  - type: enrich
+    datasource: customers
+    key: [id]
+    merge: if_absent
+    defaults:
+      tier: none
+    required: [tier]
+`
+		def, err := Load(strings.NewReader(input))
+		assert.Nil(t, err)
+		task, err := def.Build(registry)
+		assert.Nil(t, err)
+
+		record := &dag.Record{}
+		record.Set("id", "a")
+		record.Set("region", "east")
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, map[string]interface{}{"id": "a", "tier": "gold", "region": "east"}, record.Copy())
+
+		record = &dag.Record{}
+		record.Set("id", "missing")
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, map[string]interface{}{"id": "missing", "tier": "none"}, record.Copy())
+
+		def, err = Load(strings.NewReader("steps:\n  - type: enrich\n    datasource: customers\n    key: [id]\n    target: customer\n    fields: [tier]\n"))
+		assert.Nil(t, err)
+		task, err = def.Build(registry)
+		assert.Nil(t, err)
+		record = &dag.Record{}
+		record.Set("id", "a")
+		assert.Nil(t, task.Apply(ctx, record))
+		assert.Equal(t, map[string]interface{}{"tier": "gold"}, record.Copy()["customer"])
+
+		for input, want := range map[string]string{
+			"steps:\n  - type: enrich\n    datasource: customers\n    key: [id]\n    merge: never\n":                  "line 2: steps[0]: enrich: unknown merge, never; expected overwrite, if_absent or if_empty",
+			"steps:\n  - type: enrich\n    datasource: customers\n    key: [id]\n    not_found: drop\n":               "line 2: steps[0]: enrich: unknown not_found, drop; expected error or skip",
+			"steps:\n  - type: enrich\n    datasource: customers\n    key: [id]\n    target: a\n    target_list: b\n": "line 2: steps[0]: enrich: target and target_list cannot be combined",
+		} {
+			def, err := Load(strings.NewReader(input))
+			assert.Nil(t, err)
+			_, err = def.Build(registry)
+			assert.NotNil(t, err)
+			assert.Equal(t, want, err.Error())
+		}
+	})
+}
+
+type geocoder map[string]interface{}
+
+func (g geocoder) Lookup(ctx context.Context, street, city, state string) (map[string]interface{}, error) {
+	return g, nil
+}
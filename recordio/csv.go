@@ -0,0 +1,172 @@
+package recordio
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/savaki/dag"
+	"golang.org/x/xerrors"
+)
+
+// rowReader reads delimited rows
+type rowReader interface {
+	// Read the next row
+	Read() ([]string, error)
+
+	// Line returns the line number of the last row read
+	Line() int
+}
+
+// rowWriter writes delimited rows
+type rowWriter interface {
+	Write(row []string) error
+	Flush()
+	Error() error
+}
+
+type csvReader struct {
+	*csv.Reader
+}
+
+func (r csvReader) Line() int {
+	line, _ := r.FieldPos(0)
+	return line
+}
+
+type csvSource struct {
+	options options
+	reader  rowReader
+	header  []string
+}
+
+// NewCSVSource returns a Source that reads comma separated values.  The first
+// row must contain the column names
+func NewCSVSource(r io.Reader, opts ...Option) Source {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	return &csvSource{
+		options: makeOptions(opts...),
+		reader:  csvReader{Reader: reader},
+	}
+}
+
+// NewTSVSource returns a Source that reads tab separated values.  The first
+// row must contain the column names
+func NewTSVSource(r io.Reader, opts ...Option) Source {
+	return &csvSource{
+		options: makeOptions(opts...),
+		reader:  newTSVReader(r),
+	}
+}
+
+// Next implements Source
+func (s *csvSource) Next(ctx context.Context) (*dag.Record, error) {
+	if s.header == nil {
+		header, err := s.reader.Read()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("unable to read header: %w", err)
+		}
+		s.header = append([]string(nil), header...)
+	}
+
+	row, err := s.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("unable to read row: %w", err)
+	}
+	line := s.reader.Line()
+
+	values := make(map[string]interface{}, len(row))
+	for i, value := range row {
+		if i >= len(s.header) {
+			break
+		}
+		column := s.header[i]
+		v, err := s.options.convert(column, value)
+		if err != nil {
+			return nil, xerrors.Errorf("line %v: column, %v: %w", line, column, err)
+		}
+		values[column] = v
+	}
+
+	return newRecord(s.options, line, values), nil
+}
+
+type csvSink struct {
+	options options
+	mutex   sync.Mutex
+	writer  rowWriter
+	columns []string
+	row     []string
+}
+
+// NewCSVSink returns a Sink that writes comma separated values preceded by a
+// header row.  Fields not included in the columns are not written
+func NewCSVSink(w io.Writer, opts ...Option) Sink {
+	return newCSVSink(csv.NewWriter(w), opts...)
+}
+
+// NewTSVSink returns a Sink that writes tab separated values preceded by a
+// header row.  Fields not included in the columns are not written
+func NewTSVSink(w io.Writer, opts ...Option) Sink {
+	return newCSVSink(newTSVWriter(w), opts...)
+}
+
+func newCSVSink(writer rowWriter, opts ...Option) *csvSink {
+	options := makeOptions(opts...)
+	return &csvSink{
+		options: options,
+		writer:  writer,
+		columns: options.columns,
+	}
+}
+
+// Write implements Sink
+func (s *csvSink) Write(_ context.Context, record *dag.Record) error {
+	values := record.Copy()
+	if s.options.idField != "" {
+		values[s.options.idField] = record.Meta().ID
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.row == nil {
+		if len(s.columns) == 0 {
+			for k := range values {
+				s.columns = append(s.columns, k)
+			}
+			sort.Strings(s.columns)
+		}
+		if err := s.writer.Write(s.columns); err != nil {
+			return xerrors.Errorf("unable to write header: %w", err)
+		}
+		s.row = make([]string, len(s.columns))
+	}
+
+	for i, column := range s.columns {
+		s.row[i] = format(values[column])
+	}
+	if err := s.writer.Write(s.row); err != nil {
+		return xerrors.Errorf("unable to write record, %v: %w", record.Meta().ID, err)
+	}
+	return nil
+}
+
+// Flush implements Sink
+func (s *csvSink) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.writer.Flush()
+	return s.writer.Error()
+}
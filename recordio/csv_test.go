@@ -0,0 +1,123 @@
+package recordio
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/savaki/dag"
+	"github.com/tj/assert"
+)
+
+func TestCSVSource(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("default", func(t *testing.T) {
+		input := "name,age\njoe,42\nsue,\n"
+		source := NewCSVSource(strings.NewReader(input))
+
+		record, err := source.Next(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, "2", record.Meta().ID)
+		assert.Equal(t, map[string]interface{}{"name": "joe", "age": "42"}, record.Copy())
+
+		record, err = source.Next(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, "3", record.Meta().ID)
+
+		_, err = source.Next(ctx)
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("types", func(t *testing.T) {
+		input := "id,age,score,zip\nabc,42,1.5,02134\n"
+		source := NewCSVSource(strings.NewReader(input),
+			WithIDField("id"),
+			WithTypes(map[string]Type{"zip": String}),
+			WithTypeInference(),
+		)
+
+		record, err := source.Next(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, "abc", record.Meta().ID)
+
+		age, err := record.Int("age")
+		assert.Nil(t, err)
+		assert.Equal(t, 42, age)
+
+		score, err := record.Float64("score")
+		assert.Nil(t, err)
+		assert.Equal(t, 1.5, score)
+
+		zip, err := record.String("zip")
+		assert.Nil(t, err)
+		assert.Equal(t, "02134", zip)
+	})
+
+	t.Run("invalid type", func(t *testing.T) {
+		input := "age\nabc\n"
+		source := NewCSVSource(strings.NewReader(input), WithTypes(map[string]Type{"age": Int}))
+		_, err := source.Next(ctx)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "line 2")
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		source := NewCSVSource(strings.NewReader(""))
+		_, err := source.Next(ctx)
+		assert.Equal(t, io.EOF, err)
+	})
+}
+
+func TestTSVSource(t *testing.T) {
+	input := "name\tnote\njoe\t\"quoted\\tvalue\"\n"
+	source := NewTSVSource(strings.NewReader(input))
+
+	record, err := source.Next(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "2", record.Meta().ID)
+	assert.Equal(t, map[string]interface{}{"name": "joe", "note": "\"quoted\tvalue\""}, record.Copy())
+}
+
+func TestCSVSink(t *testing.T) {
+	ctx := context.Background()
+
+	newRecord := func() *dag.Record {
+		record := dag.NewRecord(dag.Meta{ID: "abc"})
+		record.Set("b", 2)
+		record.Set("a", "hello, world")
+		return record
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		sink := NewCSVSink(buf)
+		assert.Nil(t, sink.Write(ctx, newRecord()))
+		assert.Nil(t, sink.Flush())
+		assert.Equal(t, "a,b\n\"hello, world\",2\n", buf.String())
+	})
+
+	t.Run("columns", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		sink := NewCSVSink(buf, WithColumns("id", "b", "missing"), WithIDField("id"))
+		assert.Nil(t, sink.Write(ctx, newRecord()))
+		assert.Nil(t, sink.Flush())
+		assert.Equal(t, "id,b,missing\nabc,2,\n", buf.String())
+	})
+
+	t.Run("tsv round trip", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		sink := NewTSVSink(buf)
+		record := newRecord()
+		record.Set("a", "tab\there")
+		assert.Nil(t, sink.Write(ctx, record))
+		assert.Nil(t, sink.Flush())
+		assert.Equal(t, "a\tb\ntab\\there\t2\n", buf.String())
+
+		got, err := NewTSVSource(buf, WithTypeInference()).Next(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, record.Copy(), got.Copy())
+	})
+}
@@ -0,0 +1,165 @@
+package recordio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/savaki/dag"
+	"golang.org/x/xerrors"
+)
+
+type jsonLinesSource struct {
+	options options
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewJSONLinesSource returns a Source that reads one JSON object per line.
+// Blank lines are skipped.  Whole numbers are read as int and other numbers
+// as float64, including those within nested objects and arrays, unless
+// otherwise specified via WithTypes which applies to top level fields only
+func NewJSONLinesSource(r io.Reader, opts ...Option) Source {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	return &jsonLinesSource{
+		options: makeOptions(opts...),
+		scanner: scanner,
+	}
+}
+
+// Next implements Source
+func (s *jsonLinesSource) Next(ctx context.Context) (*dag.Record, error) {
+	for s.scanner.Scan() {
+		s.line++
+
+		data := bytes.TrimSpace(s.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+
+		var values map[string]interface{}
+		if err := decoder.Decode(&values); err != nil {
+			return nil, xerrors.Errorf("line %v: unable to decode json: %w", s.line, err)
+		}
+
+		for k, v := range values {
+			converted, err := s.convert(k, v)
+			if err != nil {
+				return nil, xerrors.Errorf("line %v: field, %v: %w", s.line, k, err)
+			}
+			values[k] = converted
+		}
+
+		return newRecord(s.options, s.line, values), nil
+	}
+
+	if err := s.scanner.Err(); err != nil {
+		return nil, xerrors.Errorf("unable to read json lines: %w", err)
+	}
+	return nil, io.EOF
+}
+
+func (s *jsonLinesSource) convert(field string, raw interface{}) (interface{}, error) {
+	n, ok := raw.(json.Number)
+	if !ok {
+		if t, ok := s.options.types[field]; ok {
+			if v, ok := raw.(string); ok {
+				return parse(t, v)
+			}
+		}
+		return convertNested(raw)
+	}
+
+	if t, ok := s.options.types[field]; ok {
+		return parse(t, n.String())
+	}
+	return number(n)
+}
+
+// number converts n to an int if it holds an integer that fits and to a
+// float64 otherwise
+func number(n json.Number) (interface{}, error) {
+	if v, err := n.Int64(); err == nil && int64(int(v)) == v {
+		return int(v), nil
+	}
+	return n.Float64()
+}
+
+// convertNested converts the numbers within nested objects and arrays.  Field
+// types apply only to top level fields
+func convertNested(raw interface{}) (interface{}, error) {
+	switch v := raw.(type) {
+	case json.Number:
+		return number(v)
+	case map[string]interface{}:
+		for k, item := range v {
+			converted, err := convertNested(item)
+			if err != nil {
+				return nil, xerrors.Errorf("%v: %w", k, err)
+			}
+			v[k] = converted
+		}
+		return v, nil
+	case []interface{}:
+		for i, item := range v {
+			converted, err := convertNested(item)
+			if err != nil {
+				return nil, xerrors.Errorf("%v: %w", i, err)
+			}
+			v[i] = converted
+		}
+		return v, nil
+	default:
+		return raw, nil
+	}
+}
+
+type jsonLinesSink struct {
+	options options
+	mutex   sync.Mutex
+	writer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+// NewJSONLinesSink returns a Sink that writes each record as a JSON object on
+// its own line
+func NewJSONLinesSink(w io.Writer, opts ...Option) Sink {
+	writer := bufio.NewWriter(w)
+	return &jsonLinesSink{
+		options: makeOptions(opts...),
+		writer:  writer,
+		encoder: json.NewEncoder(writer),
+	}
+}
+
+// Write implements Sink
+func (s *jsonLinesSink) Write(_ context.Context, record *dag.Record) error {
+	values := record.Copy()
+	if s.options.idField != "" {
+		values[s.options.idField] = record.Meta().ID
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.encoder.Encode(values); err != nil {
+		return xerrors.Errorf("unable to write record, %v: %w", record.Meta().ID, err)
+	}
+	return nil
+}
+
+// Flush implements Sink
+func (s *jsonLinesSink) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.writer.Flush()
+}
@@ -0,0 +1,112 @@
+package recordio
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/savaki/dag"
+	"github.com/tj/assert"
+)
+
+func TestJSONLinesSource(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("default", func(t *testing.T) {
+		input := `{"name":"joe","age":42,"score":1.5}
+
+{"name":"sue","nested":{"a":1,"items":[2,2.5,{"b":3}]}}
+`
+		source := NewJSONLinesSource(strings.NewReader(input))
+
+		record, err := source.Next(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, "1", record.Meta().ID)
+		age, err := record.Int("age")
+		assert.Nil(t, err)
+		assert.Equal(t, 42, age)
+		score, err := record.Float64("score")
+		assert.Nil(t, err)
+		assert.Equal(t, 1.5, score)
+
+		record, err = source.Next(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, "3", record.Meta().ID)
+		name, err := record.String("name")
+		assert.Nil(t, err)
+		assert.Equal(t, "sue", name)
+		nested, err := record.Get("nested")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"a":     1,
+			"items": []interface{}{2, 2.5, map[string]interface{}{"b": 3}},
+		}, nested)
+
+		_, err = source.Next(ctx)
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("id field and types", func(t *testing.T) {
+		input := `{"id":"abc","n":7}`
+		source := NewJSONLinesSource(strings.NewReader(input),
+			WithIDField("id"),
+			WithTypes(map[string]Type{"n": Float64}),
+		)
+
+		record, err := source.Next(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, "abc", record.Meta().ID)
+		n, err := record.Float64("n")
+		assert.Nil(t, err)
+		assert.Equal(t, 7.0, n)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		source := NewJSONLinesSource(strings.NewReader("{\n"))
+		_, err := source.Next(ctx)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "line 1")
+	})
+}
+
+func TestJSONLinesSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink := NewJSONLinesSink(buf, WithIDField("id"))
+
+	record := dag.NewRecord(dag.Meta{ID: "abc"})
+	record.Set("b", 2)
+	record.Set("a", "alpha")
+
+	err := sink.Write(context.Background(), record)
+	assert.Nil(t, err)
+	err = sink.Flush()
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":"alpha","b":2,"id":"abc"}`+"\n", buf.String())
+}
+
+func TestRunner(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		input  = "{\"n\":1}\n{\"n\":2}\n{\"n\":3}\n"
+		output = &bytes.Buffer{}
+		sink   = NewJSONLinesSink(output)
+		task   = dag.TaskFunc(func(ctx context.Context, record *dag.Record) error {
+			n, err := record.Int("n")
+			if err != nil {
+				return err
+			}
+			record.Set("n", n*10)
+			return nil
+		})
+	)
+
+	runner := dag.NewRunner(task, dag.WithWorkers(2), dag.WithOrdered(2))
+	for result := range runner.RunIterator(ctx, NewJSONLinesSource(strings.NewReader(input))) {
+		assert.Nil(t, result.Err)
+		assert.Nil(t, sink.Write(ctx, result.Record))
+	}
+	assert.Nil(t, sink.Flush())
+	assert.Equal(t, "{\"n\":10}\n{\"n\":20}\n{\"n\":30}\n", output.String())
+}
@@ -0,0 +1,236 @@
+// Package recordio reads and writes dag records as JSON Lines, CSV and TSV
+package recordio
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/savaki/dag"
+	"golang.org/x/xerrors"
+)
+
+// Source reads records from an external format.  Next returns io.EOF once the
+// source is exhausted.  Every Source satisfies dag.Iterator and may be passed
+// directly to dag.Runner.RunIterator
+type Source interface {
+	// Next record from the source
+	Next(ctx context.Context) (*dag.Record, error)
+}
+
+// Sink writes records to an external format
+type Sink interface {
+	// Write the record to the sink
+	Write(ctx context.Context, record *dag.Record) error
+
+	// Flush any buffered records to the underlying writer
+	Flush() error
+}
+
+// Type of a column value
+type Type int
+
+const (
+	// String leaves the value as a string
+	String Type = iota
+	// Int converts the value to an int
+	Int
+	// Int64 converts the value to an int64
+	Int64
+	// Float64 converts the value to a float64
+	Float64
+	// Bool converts the value to a bool
+	Bool
+)
+
+// String implements fmt.Stringer
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Int:
+		return "int"
+	case Int64:
+		return "int64"
+	case Float64:
+		return "float64"
+	case Bool:
+		return "bool"
+	default:
+		return "Type(" + strconv.Itoa(int(t)) + ")"
+	}
+}
+
+type options struct {
+	idField string
+	types   map[string]Type
+	infer   bool
+	columns []string
+}
+
+// Option provides functional options for sources and sinks
+type Option func(*options)
+
+// WithIDField assigns Meta.ID from the specified field when reading and writes
+// Meta.ID into the field when writing.  By default, sources use the line number
+// as the ID
+func WithIDField(field string) Option {
+	return func(o *options) {
+		o.idField = field
+	}
+}
+
+// WithTypes converts the named columns to the specified types when reading
+func WithTypes(types map[string]Type) Option {
+	return func(o *options) {
+		for k, v := range types {
+			o.types[k] = v
+		}
+	}
+}
+
+// WithTypeInference converts column values that are not configured via
+// WithTypes to an int, float64 or bool when the value parses as one
+func WithTypeInference() Option {
+	return func(o *options) {
+		o.infer = true
+	}
+}
+
+// WithColumns sets the columns, and their order, written by CSV and TSV sinks.
+// By default the sorted fields of the first record are used
+func WithColumns(columns ...string) Option {
+	return func(o *options) {
+		o.columns = columns
+	}
+}
+
+func makeOptions(opts ...Option) options {
+	o := options{
+		types: map[string]Type{},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// newRecord constructs a record from the values read at the specified line
+func newRecord(o options, line int, values map[string]interface{}) *dag.Record {
+	id := strconv.Itoa(line)
+	if o.idField != "" {
+		if v, ok := values[o.idField]; ok && v != nil {
+			id = fmt.Sprintf("%v", v)
+		}
+	}
+
+	record := dag.NewRecord(dag.Meta{
+		ID:         id,
+		Properties: map[string]string{"line": strconv.Itoa(line)},
+	})
+	for k, v := range values {
+		record.Set(k, v)
+	}
+	return record
+}
+
+// convert the string value per the configured types
+func (o options) convert(column, value string) (interface{}, error) {
+	t, ok := o.types[column]
+	if !ok {
+		if o.infer {
+			return infer(value), nil
+		}
+		return value, nil
+	}
+	return parse(t, value)
+}
+
+func parse(t Type, value string) (interface{}, error) {
+	switch t {
+	case String:
+		return value, nil
+	case Int:
+		return strconv.Atoi(value)
+	case Int64:
+		return strconv.ParseInt(value, 10, 64)
+	case Float64:
+		return strconv.ParseFloat(value, 64)
+	case Bool:
+		return strconv.ParseBool(value)
+	default:
+		return nil, xerrors.Errorf("unknown type, %v", t)
+	}
+}
+
+// infer the type of value; only plain numbers and true/false are converted so
+// values such as "NaN" or "t" remain strings.  Numbers with a leading zero,
+// such as zip codes like "02134", remain strings too; other than "0" itself and
+// decimals such as "0.5".  Integers too large for an int remain strings rather
+// than losing precision as a float64
+func infer(value string) interface{} {
+	if value == "" {
+		return value
+	}
+
+	digits := strings.TrimLeft(value, "+-")
+	if len(digits) > 1 && digits[0] == '0' && digits[1] != '.' {
+		return value
+	}
+
+	switch c := value[0]; {
+	case c >= '0' && c <= '9', c == '-', c == '+', c == '.':
+		if v, err := strconv.Atoi(value); err == nil {
+			return v
+		}
+		if isDigits(digits) {
+			return value // out of range
+		}
+		if v, err := strconv.ParseFloat(value, 64); err == nil && !math.IsInf(v, 0) {
+			return v
+		}
+	}
+
+	switch strings.ToLower(value) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	return value
+}
+
+// isDigits returns true if s is made up of one or more ascii digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func format(raw interface{}) string {
+	switch v := raw.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprintf("%v", raw)
+	}
+}
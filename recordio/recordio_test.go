@@ -0,0 +1,50 @@
+package recordio
+
+import (
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func Test_infer(t *testing.T) {
+	tests := []struct {
+		value string
+		want  interface{}
+	}{
+		{value: "", want: ""},
+		{value: "123", want: 123},
+		{value: "-123", want: -123},
+		{value: "1.5", want: 1.5},
+		{value: "0", want: 0},
+		{value: "-0.5", want: -0.5},
+		{value: "0.", want: 0.0},
+		{value: "02134", want: "02134"},
+		{value: "-007", want: "-007"},
+		{value: "00.5", want: "00.5"},
+		{value: "12345678901234567890", want: "12345678901234567890"},
+		{value: "-12345678901234567890", want: "-12345678901234567890"},
+		{value: "1e3", want: 1000.0},
+		{value: "true", want: true},
+		{value: "FALSE", want: false},
+		{value: "t", want: "t"},
+		{value: "NaN", want: "NaN"},
+		{value: "-Inf", want: "-Inf"},
+		{value: "-", want: "-"},
+		{value: "hello", want: "hello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			assert.Equal(t, tt.want, infer(tt.value))
+		})
+	}
+}
+
+func Test_parse(t *testing.T) {
+	v, err := parse(Int64, "123")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(123), v)
+
+	_, err = parse(Int, "abc")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,93 @@
+package recordio
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// tsv values escape tab, newline, carriage return and backslash with a
+// backslash so each row occupies exactly one line
+var (
+	tsvEscaper   = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+	tsvUnescaper = strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n", `\r`, "\r")
+)
+
+type tsvReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newTSVReader(r io.Reader) *tsvReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &tsvReader{scanner: scanner}
+}
+
+// Read implements rowReader; blank lines are skipped
+func (t *tsvReader) Read() ([]string, error) {
+	for t.scanner.Scan() {
+		t.line++
+
+		text := strings.TrimSuffix(t.scanner.Text(), "\r")
+		if text == "" {
+			continue
+		}
+
+		row := strings.Split(text, "\t")
+		for i, v := range row {
+			row[i] = tsvUnescaper.Replace(v)
+		}
+		return row, nil
+	}
+
+	if err := t.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Line implements rowReader
+func (t *tsvReader) Line() int {
+	return t.line
+}
+
+type tsvWriter struct {
+	writer *bufio.Writer
+	err    error
+}
+
+func newTSVWriter(w io.Writer) *tsvWriter {
+	return &tsvWriter{writer: bufio.NewWriter(w)}
+}
+
+// Write implements rowWriter
+func (t *tsvWriter) Write(row []string) error {
+	if t.err != nil {
+		return t.err
+	}
+	for i, v := range row {
+		if i > 0 {
+			t.err = t.writer.WriteByte('\t')
+		}
+		if t.err == nil {
+			_, t.err = t.writer.WriteString(tsvEscaper.Replace(v))
+		}
+	}
+	if t.err == nil {
+		t.err = t.writer.WriteByte('\n')
+	}
+	return t.err
+}
+
+// Flush implements rowWriter
+func (t *tsvWriter) Flush() {
+	if t.err == nil {
+		t.err = t.writer.Flush()
+	}
+}
+
+// Error implements rowWriter
+func (t *tsvWriter) Error() error {
+	return t.err
+}
@@ -0,0 +1,58 @@
+package dag
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is returned in place of a panic raised by a task
+type PanicError struct {
+	// Task is the name of the task that panicked
+	Task string
+	// RecordID is the Meta().ID of the record being processed
+	RecordID string
+	// Value passed to panic
+	Value interface{}
+	// Stack trace captured at the point of recovery
+	Stack []byte
+}
+
+// Error implements error
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("task, %v, panicked processing record, %v: %v", p.Task, p.RecordID, p.Value)
+}
+
+// Unwrap returns the panic value if it was an error
+func (p *PanicError) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+// Recover is middleware that converts a panic within the task into a *PanicError
+func Recover(task Task) Task {
+	return middlewareTask(task,
+		func(ctx context.Context, record *Record) error {
+			return safeApply(ctx, taskName(Path(ctx), task), task, record)
+		},
+		func(ctx context.Context, records []*Record) []error {
+			return safeApplyBatch(ctx, taskName(Path(ctx), task), task, records)
+		},
+	)
+}
+
+// safeApply applies the task, converting any panic into a *PanicError
+func safeApply(ctx context.Context, name string, task Task, record *Record) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{
+				Task:     name,
+				RecordID: record.Meta().ID,
+				Value:    r,
+				Stack:    debug.Stack(),
+			}
+		}
+	}()
+
+	return task.Apply(ctx, record)
+}
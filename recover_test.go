@@ -0,0 +1,61 @@
+package dag
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/tj/assert"
+	"golang.org/x/xerrors"
+)
+
+func panicTask(v interface{}) TaskFunc {
+	return func(ctx context.Context, record *Record) error {
+		panic(v)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("middleware", func(t *testing.T) {
+		task := Wrap(Serial(WithName("boom", panicTask("nil map"))), Recover)
+		err := task.Apply(ctx, NewRecord(Meta{ID: "abc"}))
+
+		var pe *PanicError
+		assert.True(t, xerrors.As(err, &pe))
+		assert.Equal(t, "boom", pe.Task)
+		assert.Equal(t, "abc", pe.RecordID)
+		assert.Equal(t, "nil map", pe.Value)
+		assert.NotEmpty(t, pe.Stack)
+	})
+
+	t.Run("unwrap error value", func(t *testing.T) {
+		task := Wrap(panicTask(io.EOF), Recover)
+		err := task.Apply(ctx, &Record{})
+		assert.True(t, xerrors.Is(err, io.EOF))
+	})
+
+	t.Run("no panic", func(t *testing.T) {
+		var counter int64
+		task := Wrap(counterTask(&counter), Recover)
+		err := task.Apply(ctx, &Record{})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, int(counter))
+	})
+}
+
+func TestParallel_Panic(t *testing.T) {
+	var counter int64
+	task := Parallel(
+		WithName("boom", panicTask("nil map")),
+		counterTask(&counter),
+	)
+
+	err := task.Apply(context.Background(), NewRecord(Meta{ID: "abc"}))
+
+	var pe *PanicError
+	assert.True(t, xerrors.As(err, &pe))
+	assert.Equal(t, "boom", pe.Task)
+	assert.Equal(t, "abc", pe.RecordID)
+}
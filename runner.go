@@ -0,0 +1,470 @@
+package dag
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Result of processing a single record
+type Result struct {
+	Record *Record
+	Err    error
+}
+
+// Dropped reports whether the record was dropped rather than failed
+func (r Result) Dropped() bool {
+	return r.Record != nil && IsDropped(r.Err)
+}
+
+// Iterator provides records to a Runner
+type Iterator interface {
+	// Next returns the next record or io.EOF once exhausted
+	Next(ctx context.Context) (*Record, error)
+}
+
+// IteratorFunc provides a functional interface for Iterator
+type IteratorFunc func(ctx context.Context) (*Record, error)
+
+// Next implements Iterator
+func (fn IteratorFunc) Next(ctx context.Context) (*Record, error) {
+	return fn(ctx)
+}
+
+// Stats reports the progress of a Runner
+type Stats struct {
+	// Processed is the number of records that have completed, including child
+	// records created by WithSplit
+	Processed uint64
+	// Succeeded is the number of records that completed without error
+	Succeeded uint64
+	// Failed is the number of records that returned an error
+	Failed uint64
+	// Dropped is the number of records discarded by a task; see ErrDrop
+	Dropped uint64
+	// Split is the number of child records created by WithSplit
+	Split uint64
+	// InFlight is the number of records currently being processed
+	InFlight int64
+	// Elapsed is the time since the runner started or the total run time once
+	// complete
+	Elapsed time.Duration
+}
+
+// Throughput in records per second
+func (s Stats) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Processed) / s.Elapsed.Seconds()
+}
+
+type runnerOptions struct {
+	workers int
+	buffer  int
+	window  int
+	splits  []split
+
+	batchSize   int
+	batchWindow time.Duration
+}
+
+// split is a stage that divides records and applies downstream to each child
+type split struct {
+	splitter   Splitter
+	downstream Task
+}
+
+// RunnerOption provides functional options for Runner
+type RunnerOption func(*runnerOptions)
+
+// WithWorkers sets the number of records processed concurrently.  Defaults to
+// runtime.NumCPU()
+func WithWorkers(n int) RunnerOption {
+	return func(o *runnerOptions) {
+		o.workers = n
+	}
+}
+
+// WithBuffer sets the size of the output channel buffer
+func WithBuffer(n int) RunnerOption {
+	return func(o *runnerOptions) {
+		o.buffer = n
+	}
+}
+
+// WithOrdered emits results in the same order records were received.  At most
+// window records may be in flight or awaiting emission at once; a slow record
+// holds back those behind it and applies backpressure to the input rather than
+// buffering without bound
+func WithOrdered(window int) RunnerOption {
+	return func(o *runnerOptions) {
+		o.window = window
+	}
+}
+
+// WithBatch groups up to size records into a batch that is applied at once
+// when the task implements BatchTask.  A partial batch is dispatched once
+// window has elapsed since its first record arrived; a zero window waits for a
+// full batch or the end of the input.  In ordered mode, a partial batch is also
+// dispatched when the reorder window is full
+func WithBatch(size int, window time.Duration) RunnerOption {
+	return func(o *runnerOptions) {
+		o.batchSize = size
+		o.batchWindow = window
+	}
+}
+
+// WithSplit divides each record that completes successfully into child
+// records, see Splitter, and applies downstream to each child.  Results are
+// emitted for the children in place of the parent; a parent split into no
+// children is dropped.  Splits may be chained with subsequent calls; each
+// child keeps the chain of its parents so that Collect can gather the children
+// back into the original record
+func WithSplit(splitter Splitter, downstream Task) RunnerOption {
+	return func(o *runnerOptions) {
+		o.splits = append(o.splits, split{splitter: splitter, downstream: downstream})
+	}
+}
+
+// Runner applies a task to a stream of records using a pool of workers
+type Runner struct {
+	task    Task
+	options runnerOptions
+
+	processed uint64
+	succeeded uint64
+	failed    uint64
+	dropped   uint64
+	children  uint64
+	inFlight  int64
+
+	mutex     sync.Mutex
+	startedAt time.Time
+	elapsed   time.Duration
+	running   int
+}
+
+// NewRunner returns a Runner that applies task to each record
+func NewRunner(task Task, opts ...RunnerOption) *Runner {
+	options := runnerOptions{
+		workers: runtime.NumCPU(),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.workers < 1 {
+		options.workers = 1
+	}
+	if options.batchSize < 1 {
+		options.batchSize = 1
+	}
+
+	return &Runner{
+		task:    task,
+		options: options,
+	}
+}
+
+// Run applies the task to each record received from in and emits the results
+// on the returned channel, which is closed once in is closed and all records
+// have been processed.  Results are emitted in completion order unless
+// WithOrdered is specified.
+//
+// When ctx is canceled, the runner stops accepting new records and drains;
+// records already in flight are allowed to complete.  Callers must consume the
+// returned channel until it is closed
+func (r *Runner) Run(ctx context.Context, in <-chan *Record) <-chan Result {
+	return r.run(ctx, in, nil)
+}
+
+// RunIterator behaves as Run, but pulls records from the iterator.  An error
+// other than io.EOF from the iterator stops the run and is emitted as a Result
+// with a nil Record
+func (r *Runner) RunIterator(ctx context.Context, it Iterator) <-chan Result {
+	var (
+		in      = make(chan *Record)
+		iterErr error
+	)
+
+	go func() {
+		defer close(in)
+		for ctx.Err() == nil {
+			record, err := it.Next(ctx)
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					iterErr = err
+				}
+				return
+			}
+
+			select {
+			case in <- record:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return r.run(ctx, in, func() error { return iterErr })
+}
+
+// job is a batch of one or more records in flight through the runner
+type job struct {
+	seq     int
+	records []*Record
+	results []Result
+}
+
+// run starts the workers.  tail, if provided, is invoked after in is closed and
+// all workers have finished; a non-nil error is emitted as the final Result
+func (r *Runner) run(ctx context.Context, in <-chan *Record, tail func() error) <-chan Result {
+	r.start()
+
+	var (
+		out   = make(chan Result, r.options.buffer)
+		jobs  = make(chan job)
+		done  = make(chan job)
+		slots chan struct{}                // bounds the reorder window; nil when unordered
+		drain = context.WithoutCancel(ctx) // in flight records complete on cancel
+	)
+	if r.options.window > 0 {
+		slots = make(chan struct{}, r.options.window)
+	}
+
+	// dispatch batches of records to the workers; a slot is acquired before
+	// reading each record so a full reorder window applies backpressure to the
+	// input
+	go func() {
+		defer close(jobs)
+
+		var (
+			seq     int
+			batch   []*Record
+			timer   *time.Timer
+			expired <-chan time.Time
+			held    bool // a slot has been acquired for the next record
+		)
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			if timer != nil {
+				timer.Stop()
+				timer, expired = nil, nil
+			}
+			jobs <- job{seq: seq, records: batch}
+			seq++
+			batch = nil
+		}
+		defer flush() // records already read are processed
+
+		for ctx.Err() == nil {
+			if slots != nil && !held {
+				select {
+				case slots <- struct{}{}:
+				default:
+					// don't hold a partial batch while waiting on the window
+					flush()
+					select {
+					case slots <- struct{}{}:
+					case <-ctx.Done():
+						return
+					}
+				}
+				held = true
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-expired:
+				flush()
+			case record, ok := <-in:
+				if !ok {
+					return
+				}
+				held = false
+				batch = append(batch, record)
+				switch {
+				case len(batch) >= r.options.batchSize:
+					flush()
+				case len(batch) == 1 && r.options.batchWindow > 0:
+					timer = time.NewTimer(r.options.batchWindow)
+					expired = timer.C
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(r.options.workers)
+	for i := 0; i < r.options.workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				j.results = r.process(drain, j.records)
+				done <- j
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	go func() {
+		defer close(out)
+		defer r.stop()
+
+		if slots == nil {
+			for j := range done {
+				for _, result := range j.results {
+					out <- result
+				}
+			}
+		} else {
+			var (
+				next    int
+				pending = map[int]job{}
+			)
+			for j := range done {
+				pending[j.seq] = j
+				for {
+					j, ok := pending[next]
+					if !ok {
+						break
+					}
+					for _, result := range j.results {
+						out <- result
+					}
+					delete(pending, next)
+					for range j.records {
+						<-slots
+					}
+					next++
+				}
+			}
+		}
+
+		if tail != nil {
+			if err := tail(); err != nil {
+				out <- Result{Err: err}
+			}
+		}
+	}()
+
+	return out
+}
+
+func (r *Runner) process(ctx context.Context, records []*Record) []Result {
+	atomic.AddInt64(&r.inFlight, int64(len(records)))
+	defer atomic.AddInt64(&r.inFlight, -int64(len(records)))
+
+	results := make([]Result, 0, len(records))
+	for i, err := range safeApplyBatch(ctx, Name(r.task), r.task, records) {
+		results = append(results, Result{
+			Record: records[i],
+			Err:    err,
+		})
+	}
+	for _, s := range r.options.splits {
+		results = r.splitAll(ctx, s, results)
+	}
+
+	for _, result := range results {
+		switch {
+		case result.Err == nil:
+			atomic.AddUint64(&r.succeeded, 1)
+		case IsDropped(result.Err):
+			atomic.AddUint64(&r.dropped, 1)
+		default:
+			atomic.AddUint64(&r.failed, 1)
+		}
+		atomic.AddUint64(&r.processed, 1)
+	}
+
+	return results
+}
+
+// splitAll divides each successful result and applies the downstream task to the
+// children
+func (r *Runner) splitAll(ctx context.Context, s split, results []Result) []Result {
+	var next []Result
+	for _, result := range results {
+		if result.Err != nil {
+			next = append(next, result)
+			continue
+		}
+
+		var contents []map[string]interface{}
+		err := safeApply(ctx, "split", TaskFunc(func(ctx context.Context, record *Record) (err error) {
+			contents, err = s.splitter.Split(ctx, record)
+			return err
+		}), result.Record)
+		if err == nil && len(contents) == 0 {
+			err = Drop("split into no records")
+		}
+		if err != nil {
+			next = append(next, Result{Record: result.Record, Err: err})
+			continue
+		}
+
+		atomic.AddUint64(&r.children, uint64(len(contents)))
+		for _, child := range children(result.Record.Meta(), contents) {
+			next = append(next, Result{
+				Record: child,
+				Err:    safeApply(ctx, Name(s.downstream), s.downstream, child),
+			})
+		}
+	}
+	return next
+}
+
+func (r *Runner) start() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.running == 0 {
+		r.startedAt = time.Now()
+	}
+	r.running++
+}
+
+func (r *Runner) stop() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.running--
+	if r.running == 0 {
+		r.elapsed += time.Since(r.startedAt)
+	}
+}
+
+// Stats returns the current statistics for the runner.  Statistics accumulate
+// across calls to Run
+func (r *Runner) Stats() Stats {
+	r.mutex.Lock()
+	elapsed := r.elapsed
+	if r.running > 0 {
+		elapsed += time.Since(r.startedAt)
+	}
+	r.mutex.Unlock()
+
+	return Stats{
+		Processed: atomic.LoadUint64(&r.processed),
+		Succeeded: atomic.LoadUint64(&r.succeeded),
+		Failed:    atomic.LoadUint64(&r.failed),
+		Dropped:   atomic.LoadUint64(&r.dropped),
+		Split:     atomic.LoadUint64(&r.children),
+		InFlight:  atomic.LoadInt64(&r.inFlight),
+		Elapsed:   elapsed,
+	}
+}
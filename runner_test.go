@@ -0,0 +1,236 @@
+package dag
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tj/assert"
+)
+
+func records(n int) <-chan *Record {
+	ch := make(chan *Record, n)
+	for i := 0; i < n; i++ {
+		ch <- NewRecord(Meta{ID: strconv.Itoa(i)})
+	}
+	close(ch)
+	return ch
+}
+
+func TestRunner(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("processes all records", func(t *testing.T) {
+		var counter int64
+		runner := NewRunner(counterTask(&counter), WithWorkers(4))
+
+		seen := map[string]bool{}
+		for result := range runner.Run(ctx, records(100)) {
+			assert.Nil(t, result.Err)
+			seen[result.Record.Meta().ID] = true
+		}
+		assert.Len(t, seen, 100)
+		assert.Equal(t, 100, int(counter))
+
+		stats := runner.Stats()
+		assert.EqualValues(t, 100, stats.Processed)
+		assert.EqualValues(t, 100, stats.Succeeded)
+		assert.EqualValues(t, 0, stats.Failed)
+		assert.EqualValues(t, 0, stats.InFlight)
+		assert.True(t, stats.Elapsed > 0)
+		assert.True(t, stats.Throughput() > 0)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		task := TaskFunc(func(ctx context.Context, record *Record) error {
+			if record.Meta().ID == "3" {
+				return io.EOF
+			}
+			return nil
+		})
+		runner := NewRunner(task, WithWorkers(2))
+
+		var failed []string
+		for result := range runner.Run(ctx, records(10)) {
+			if result.Err != nil {
+				assert.Equal(t, io.EOF, result.Err)
+				failed = append(failed, result.Record.Meta().ID)
+			}
+		}
+		assert.Equal(t, []string{"3"}, failed)
+		assert.EqualValues(t, 1, runner.Stats().Failed)
+		assert.EqualValues(t, 9, runner.Stats().Succeeded)
+	})
+
+	t.Run("drops", func(t *testing.T) {
+		task := TaskFunc(func(ctx context.Context, record *Record) error {
+			switch record.Meta().ID {
+			case "3":
+				return io.EOF
+			case "5", "7":
+				return Drop("odd")
+			}
+			return nil
+		})
+		runner := NewRunner(task, WithWorkers(2))
+
+		var dropped []string
+		for result := range runner.Run(ctx, records(10)) {
+			if result.Dropped() {
+				dropped = append(dropped, result.Record.Meta().ID)
+			}
+		}
+		sort.Strings(dropped)
+		assert.Equal(t, []string{"5", "7"}, dropped)
+
+		stats := runner.Stats()
+		assert.EqualValues(t, 10, stats.Processed)
+		assert.EqualValues(t, 7, stats.Succeeded)
+		assert.EqualValues(t, 1, stats.Failed)
+		assert.EqualValues(t, 2, stats.Dropped)
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		runner := NewRunner(panicTask("boom"), WithWorkers(1))
+		for result := range runner.Run(ctx, records(1)) {
+			_, ok := result.Err.(*PanicError)
+			assert.True(t, ok)
+		}
+	})
+
+	t.Run("drain on cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var (
+			started  = make(chan struct{})
+			finished int64
+		)
+		task := TaskFunc(func(ctx context.Context, record *Record) error {
+			started <- struct{}{}
+			time.Sleep(10 * time.Millisecond)
+			if ctx.Err() == nil {
+				atomic.AddInt64(&finished, 1)
+			}
+			return nil
+		})
+
+		in := make(chan *Record)
+		runner := NewRunner(task, WithWorkers(1))
+		out := runner.Run(ctx, in)
+
+		in <- NewRecord(Meta{ID: "a"})
+		<-started
+		cancel()
+
+		var results []Result
+		for result := range out {
+			results = append(results, result)
+		}
+		assert.Len(t, results, 1)
+		assert.Nil(t, results[0].Err)
+		assert.EqualValues(t, 1, finished)
+	})
+}
+
+func TestRunner_RunIterator(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("eof", func(t *testing.T) {
+		var n int
+		it := IteratorFunc(func(ctx context.Context) (*Record, error) {
+			if n == 5 {
+				return nil, io.EOF
+			}
+			n++
+			return NewRecord(Meta{ID: strconv.Itoa(n)}), nil
+		})
+
+		var counter int64
+		runner := NewRunner(counterTask(&counter), WithWorkers(2))
+		var got int
+		for result := range runner.RunIterator(ctx, it) {
+			assert.Nil(t, result.Err)
+			got++
+		}
+		assert.Equal(t, 5, got)
+		assert.Equal(t, 5, int(counter))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		it := IteratorFunc(func(ctx context.Context) (*Record, error) {
+			return nil, io.ErrUnexpectedEOF
+		})
+
+		runner := NewRunner(nopTask())
+		var results []Result
+		for result := range runner.RunIterator(ctx, it) {
+			results = append(results, result)
+		}
+		assert.Len(t, results, 1)
+		assert.Nil(t, results[0].Record)
+		assert.Equal(t, io.ErrUnexpectedEOF, results[0].Err)
+	})
+}
+
+func TestRunner_Ordered(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("preserves order", func(t *testing.T) {
+		task := TaskFunc(func(ctx context.Context, record *Record) error {
+			id, _ := strconv.Atoi(record.Meta().ID)
+			time.Sleep(time.Duration(id%3) * time.Millisecond)
+			return nil
+		})
+		runner := NewRunner(task, WithWorkers(8), WithOrdered(16))
+
+		var got []string
+		for result := range runner.Run(ctx, records(100)) {
+			got = append(got, result.Record.Meta().ID)
+		}
+
+		assert.Len(t, got, 100)
+		for i, id := range got {
+			assert.Equal(t, strconv.Itoa(i), id)
+		}
+	})
+
+	t.Run("window bounds in flight records", func(t *testing.T) {
+		var (
+			started = make(chan struct{}, 20)
+			release = make(chan struct{})
+			done    int32 // set once the first record completes
+			early   int64 // records beyond the window started before the first completed
+		)
+		task := TaskFunc(func(ctx context.Context, record *Record) error {
+			started <- struct{}{}
+			id, _ := strconv.Atoi(record.Meta().ID)
+			switch {
+			case id == 0:
+				<-release // slow first record holds back the window
+				atomic.StoreInt32(&done, 1)
+			case id >= 4 && atomic.LoadInt32(&done) == 0:
+				atomic.AddInt64(&early, 1)
+			}
+			return nil
+		})
+		runner := NewRunner(task, WithWorkers(8), WithOrdered(4))
+		out := runner.Run(ctx, records(20))
+
+		for i := 0; i < 4; i++ {
+			<-started // the window is full
+		}
+		close(release)
+
+		var got int
+		for range out {
+			got++
+		}
+		assert.Equal(t, 20, got)
+		assert.EqualValues(t, 0, atomic.LoadInt64(&early))
+	})
+}
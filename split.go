@@ -0,0 +1,273 @@
+package dag
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/xerrors"
+)
+
+// Properties set on the Meta of child records created by a Splitter
+const (
+	// ParentIDProperty holds the ID of the record that was split
+	ParentIDProperty = "dag.parent_id"
+	// ChildIndexProperty holds the position of the child, starting at 0
+	ChildIndexProperty = "dag.child_index"
+	// ChildCountProperty holds the number of children the parent was split into
+	ChildCountProperty = "dag.child_count"
+	// SplitIDProperty holds an identifier unique to each split within the
+	// process; Collect groups children by it so that parents sharing an ID, or
+	// without one, are collected separately
+	SplitIDProperty = "dag.split_id"
+)
+
+// splitSeq provides the value of SplitIDProperty
+var splitSeq uint64
+
+// ancestorPrefix is prepended to the split properties of a parent that is itself
+// a child, preserving the chain of parents across chained splits
+const ancestorPrefix = "dag.ancestor."
+
+// Splitter divides a record into the contents of zero or more child records
+type Splitter interface {
+	// Split returns the fields for each child record
+	Split(ctx context.Context, record *Record) ([]map[string]interface{}, error)
+}
+
+// SplitterFunc provides a functional interface for Splitter
+type SplitterFunc func(ctx context.Context, record *Record) ([]map[string]interface{}, error)
+
+// Split implements Splitter
+func (fn SplitterFunc) Split(ctx context.Context, record *Record) ([]map[string]interface{}, error) {
+	return fn(ctx, record)
+}
+
+// isSplitProperty returns true if k holds the split properties of a record or
+// of one of its ancestors
+func isSplitProperty(k string) bool {
+	switch k {
+	case ParentIDProperty, ChildIndexProperty, ChildCountProperty, SplitIDProperty:
+		return true
+	default:
+		return strings.HasPrefix(k, ancestorPrefix)
+	}
+}
+
+// children constructs the child records of parent.  Each child inherits the
+// parent's Meta with an ID of parent.ID.index and the split properties set.
+// When parent is itself a child, its split properties are kept with the
+// ancestorPrefix so that parentMeta can restore them
+func children(parent Meta, contents []map[string]interface{}) []*Record {
+	var (
+		splitID = strconv.FormatUint(atomic.AddUint64(&splitSeq, 1), 10)
+		records = make([]*Record, 0, len(contents))
+	)
+	for i, content := range contents {
+		properties := make(map[string]string, 2*len(parent.Properties)+3)
+		for k, v := range parent.Properties {
+			if isSplitProperty(k) {
+				k = ancestorPrefix + k
+			}
+			properties[k] = v
+		}
+		properties[ParentIDProperty] = parent.ID
+		properties[ChildIndexProperty] = strconv.Itoa(i)
+		properties[ChildCountProperty] = strconv.Itoa(len(contents))
+		properties[SplitIDProperty] = splitID
+
+		record := NewRecord(Meta{
+			ID:         fmt.Sprintf("%v.%v", parent.ID, i),
+			StartedAt:  parent.StartedAt,
+			Properties: properties,
+		})
+		for k, v := range content {
+			record.Set(k, v)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// parentMeta reconstructs the Meta of the parent, including the split
+// properties of the parent's own parents, from that of a child
+func parentMeta(child Meta) Meta {
+	properties := map[string]string{}
+	for k, v := range child.Properties {
+		switch k {
+		case ParentIDProperty, ChildIndexProperty, ChildCountProperty, SplitIDProperty:
+		default:
+			properties[strings.TrimPrefix(k, ancestorPrefix)] = v
+		}
+	}
+
+	return Meta{
+		ID:         child.Properties[ParentIDProperty],
+		StartedAt:  child.StartedAt,
+		Properties: properties,
+	}
+}
+
+// depth returns the number of splits that produced a record with meta
+func depth(meta Meta) int {
+	var n int
+	for k := range meta.Properties {
+		if strings.HasSuffix(k, ParentIDProperty) {
+			n++
+		}
+	}
+	return n
+}
+
+// CollectFunc combines the child records of parent back into a single record.
+// children are ordered by their index and exclude dropped children.  The
+// record returned should carry the parent Meta so that chained splits can be
+// collected further
+type CollectFunc func(ctx context.Context, parent Meta, children []*Record) (*Record, error)
+
+// CollectInto returns a CollectFunc that creates a record holding the fields of
+// each child as a []map[string]interface{} within field
+func CollectInto(field string) CollectFunc {
+	return func(ctx context.Context, parent Meta, children []*Record) (*Record, error) {
+		items := make([]map[string]interface{}, 0, len(children))
+		for _, child := range children {
+			items = append(items, child.Copy())
+		}
+
+		record := NewRecord(parent)
+		record.Set(field, items)
+		return record, nil
+	}
+}
+
+// collectionKey identifies the children of a single parent
+type collectionKey struct {
+	splitID  string
+	parentID string
+}
+
+type collection struct {
+	key      collectionKey
+	parent   Meta
+	expected int
+	seq      int
+	results  []Result
+}
+
+// Collect is the inverse of a Splitter; it gathers the results of child records
+// by parent, see SplitIDProperty, and emits a single result per parent once
+// every child has been received.  Results for records that were not split pass through unchanged.
+// Chained splits are collected a level at a time, with fn called at each
+// level, until the records read from the Runner are restored.
+//
+// If any child failed, the parent's result carries the first error and fn is
+// not called; if every child was dropped, the parent is dropped.  Parents still
+// missing children once in is closed are emitted with an error.  Callers must
+// consume the returned channel until it is closed
+func Collect(ctx context.Context, in <-chan Result, fn CollectFunc) <-chan Result {
+	out := make(chan Result)
+
+	go func() {
+		defer close(out)
+
+		var (
+			pending = map[collectionKey]*collection{}
+			seq     int // orders the parents by first arrival
+		)
+
+		var add func(result Result)
+		add = func(result Result) {
+			if result.Record == nil {
+				out <- result
+				return
+			}
+
+			meta := result.Record.Meta()
+			parentID, ok := meta.Properties[ParentIDProperty]
+			if !ok {
+				out <- result
+				return
+			}
+
+			key := collectionKey{splitID: meta.Properties[SplitIDProperty], parentID: parentID}
+			c, ok := pending[key]
+			if !ok {
+				expected, _ := strconv.Atoi(meta.Properties[ChildCountProperty])
+				seq++
+				c = &collection{key: key, parent: parentMeta(meta), expected: expected, seq: seq}
+				pending[key] = c
+			}
+			c.results = append(c.results, result)
+
+			if len(c.results) >= c.expected {
+				delete(pending, key)
+				add(c.collect(ctx, fn)) // the parent may itself be a child
+			}
+		}
+
+		for result := range in {
+			add(result)
+		}
+
+		// the deepest parents are failed first as each completes its own parent
+		for len(pending) > 0 {
+			var next *collection
+			for _, c := range pending {
+				if next == nil || c.before(next) {
+					next = c
+				}
+			}
+
+			delete(pending, next.key)
+			add(Result{
+				Record: NewRecord(next.parent),
+				Err:    xerrors.Errorf("record, %v, received %v of %v child records", next.parent.ID, len(next.results), next.expected),
+			})
+		}
+	}()
+
+	return out
+}
+
+// before returns true if c should be failed before that; deeper parents first,
+// then in order of arrival
+func (c *collection) before(that *collection) bool {
+	if a, b := depth(c.parent), depth(that.parent); a != b {
+		return a > b
+	}
+	return c.seq < that.seq
+}
+
+func (c *collection) collect(ctx context.Context, fn CollectFunc) Result {
+	sort.Slice(c.results, func(i, j int) bool {
+		return childIndex(c.results[i].Record) < childIndex(c.results[j].Record)
+	})
+
+	var kept []*Record
+	for _, result := range c.results {
+		switch {
+		case result.Dropped():
+		case result.Err != nil:
+			return Result{Record: NewRecord(c.parent), Err: result.Err}
+		default:
+			kept = append(kept, result.Record)
+		}
+	}
+	if len(kept) == 0 {
+		return Result{Record: NewRecord(c.parent), Err: Drop("all child records dropped")}
+	}
+
+	record, err := fn(ctx, c.parent, kept)
+	if err != nil {
+		return Result{Record: NewRecord(c.parent), Err: err}
+	}
+	return Result{Record: record}
+}
+
+func childIndex(record *Record) int {
+	i, _ := strconv.Atoi(record.Meta().Properties[ChildIndexProperty])
+	return i
+}
@@ -0,0 +1,267 @@
+package dag
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+// membersSplitter splits the members field into one record per member
+var membersSplitter = SplitterFunc(func(ctx context.Context, record *Record) ([]map[string]interface{}, error) {
+	raw, err := record.Get("members")
+	if err != nil {
+		return nil, err
+	}
+
+	var contents []map[string]interface{}
+	for _, name := range raw.([]string) {
+		contents = append(contents, map[string]interface{}{"name": name})
+	}
+	return contents, nil
+})
+
+func household(id string, members ...string) *Record {
+	record := NewRecord(Meta{ID: id, Properties: map[string]string{"source": "test"}})
+	record.Set("members", members)
+	return record
+}
+
+func TestRunner_WithSplit(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("fan out", func(t *testing.T) {
+		in := make(chan *Record, 3)
+		in <- household("a", "joe", "sue")
+		in <- household("b")
+		in <- household("c", "ann")
+		close(in)
+
+		var counter int64
+		runner := NewRunner(nopTask(), WithSplit(membersSplitter, counterTask(&counter)), WithOrdered(2))
+
+		var (
+			ids     []string
+			dropped []string
+		)
+		for result := range runner.Run(ctx, in) {
+			if result.Dropped() {
+				dropped = append(dropped, result.Record.Meta().ID)
+				continue
+			}
+			assert.Nil(t, result.Err)
+			ids = append(ids, result.Record.Meta().ID)
+		}
+		assert.Equal(t, []string{"a.0", "a.1", "c.0"}, ids)
+		assert.Equal(t, []string{"b"}, dropped)
+		assert.EqualValues(t, 3, counter)
+
+		stats := runner.Stats()
+		assert.EqualValues(t, 4, stats.Processed)
+		assert.EqualValues(t, 3, stats.Succeeded)
+		assert.EqualValues(t, 1, stats.Dropped)
+		assert.EqualValues(t, 3, stats.Split)
+	})
+
+	t.Run("child meta", func(t *testing.T) {
+		in := make(chan *Record, 1)
+		in <- household("a", "joe", "sue")
+		close(in)
+
+		var got []*Record
+		for result := range NewRunner(nopTask(), WithSplit(membersSplitter, nopTask())).Run(ctx, in) {
+			got = append(got, result.Record)
+		}
+		assert.Len(t, got, 2)
+
+		meta := got[0].Meta()
+		if meta.ID != "a.0" {
+			meta = got[1].Meta()
+		}
+		assert.Equal(t, "a.0", meta.ID)
+		assert.NotEmpty(t, meta.Properties[SplitIDProperty])
+		assert.Equal(t, got[0].Meta().Properties[SplitIDProperty], got[1].Meta().Properties[SplitIDProperty])
+		delete(meta.Properties, SplitIDProperty)
+		assert.Equal(t, map[string]string{
+			"source":           "test",
+			ParentIDProperty:   "a",
+			ChildIndexProperty: "0",
+			ChildCountProperty: "2",
+		}, meta.Properties)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		in := make(chan *Record, 3)
+		in <- household("a", "joe")
+		in <- NewRecord(Meta{ID: "missing"})
+		in <- household("panic", "joe")
+		close(in)
+
+		panicky := SplitterFunc(func(ctx context.Context, record *Record) ([]map[string]interface{}, error) {
+			if record.Meta().ID == "panic" {
+				panic("boom")
+			}
+			return membersSplitter(ctx, record)
+		})
+		downstream := TaskFunc(func(ctx context.Context, record *Record) error {
+			return io.EOF
+		})
+
+		errs := map[string]error{}
+		for result := range NewRunner(nopTask(), WithSplit(panicky, downstream), WithOrdered(1)).Run(ctx, in) {
+			errs[result.Record.Meta().ID] = result.Err
+		}
+		assert.Equal(t, io.EOF, errs["a.0"])
+		assert.True(t, IsFieldNotFoundError(errs["missing"]))
+		_, ok := errs["panic"].(*PanicError)
+		assert.True(t, ok)
+	})
+}
+
+func TestCollect(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("round trip", func(t *testing.T) {
+		in := make(chan *Record, 2)
+		in <- household("a", "joe", "sue", "ann")
+		in <- household("b", "bob")
+		close(in)
+
+		upper := TaskFunc(func(ctx context.Context, record *Record) error {
+			name, _ := record.String("name")
+			record.Set("name", name+"!")
+			return nil
+		})
+		runner := NewRunner(nopTask(), WithSplit(membersSplitter, upper), WithWorkers(4))
+
+		got := map[string]interface{}{}
+		for result := range Collect(ctx, runner.Run(ctx, in), CollectInto("members")) {
+			assert.Nil(t, result.Err)
+			meta := result.Record.Meta()
+			assert.Equal(t, map[string]string{"source": "test"}, meta.Properties)
+			got[meta.ID], _ = result.Record.Get("members")
+		}
+
+		assert.Equal(t, map[string]interface{}{
+			"a": []map[string]interface{}{{"name": "joe!"}, {"name": "sue!"}, {"name": "ann!"}},
+			"b": []map[string]interface{}{{"name": "bob!"}},
+		}, got)
+	})
+
+	t.Run("chained", func(t *testing.T) {
+		letters := SplitterFunc(func(ctx context.Context, record *Record) ([]map[string]interface{}, error) {
+			name, _ := record.String("name")
+			var contents []map[string]interface{}
+			for _, r := range name {
+				contents = append(contents, map[string]interface{}{"letter": string(r)})
+			}
+			return contents, nil
+		})
+
+		run := func(skip string) map[string]Result {
+			in := make(chan *Record, 2)
+			in <- household("a", "jo", "")
+			in <- household("b", "x")
+			close(in)
+
+			runner := NewRunner(nopTask(), WithSplit(membersSplitter, nopTask()), WithSplit(letters, nopTask()), WithWorkers(4))
+			results := make(chan Result)
+			go func() {
+				defer close(results)
+				for result := range runner.Run(ctx, in) {
+					if result.Record.Meta().ID != skip {
+						results <- result
+					}
+				}
+			}()
+
+			got := map[string]Result{}
+			for result := range Collect(ctx, results, CollectInto("items")) {
+				got[result.Record.Meta().ID] = result
+			}
+			return got
+		}
+
+		got := run("")
+		assert.Len(t, got, 2)
+		for id, want := range map[string]interface{}{
+			"a": []map[string]interface{}{{"items": []map[string]interface{}{{"letter": "j"}, {"letter": "o"}}}},
+			"b": []map[string]interface{}{{"items": []map[string]interface{}{{"letter": "x"}}}},
+		} {
+			assert.Nil(t, got[id].Err)
+			assert.Equal(t, map[string]string{"source": "test"}, got[id].Record.Meta().Properties)
+			v, _ := got[id].Record.Get("items")
+			assert.Equal(t, want, v)
+		}
+
+		got = run("a.0.1")
+		assert.Len(t, got, 2)
+		assert.EqualError(t, got["a"].Err, "record, a.0, received 1 of 2 child records")
+		assert.Nil(t, got["b"].Err)
+	})
+
+	t.Run("duplicate and empty ids", func(t *testing.T) {
+		in := make(chan *Record, 4)
+		in <- household("a", "joe", "sue")
+		in <- household("a", "ann")
+		in <- household("", "bob")
+		in <- household("", "kim", "lee")
+		close(in)
+
+		runner := NewRunner(nopTask(), WithSplit(membersSplitter, nopTask()), WithOrdered(4))
+
+		var got []interface{}
+		for result := range Collect(ctx, runner.Run(ctx, in), CollectInto("members")) {
+			assert.Nil(t, result.Err)
+			v, _ := result.Record.Get("members")
+			got = append(got, v)
+		}
+		assert.Equal(t, []interface{}{
+			[]map[string]interface{}{{"name": "joe"}, {"name": "sue"}},
+			[]map[string]interface{}{{"name": "ann"}},
+			[]map[string]interface{}{{"name": "bob"}},
+			[]map[string]interface{}{{"name": "kim"}, {"name": "lee"}},
+		}, got)
+	})
+
+	child := func(parent string, index, count int, err error) Result {
+		record := NewRecord(Meta{
+			ID: parent + "." + strconv.Itoa(index),
+			Properties: map[string]string{
+				ParentIDProperty:   parent,
+				ChildIndexProperty: strconv.Itoa(index),
+				ChildCountProperty: strconv.Itoa(count),
+			},
+		})
+		record.Set("i", index)
+		return Result{Record: record, Err: err}
+	}
+
+	t.Run("partial", func(t *testing.T) {
+		in := make(chan Result, 8)
+		in <- Result{Record: NewRecord(Meta{ID: "plain"})}
+		in <- child("failed", 0, 2, nil)
+		in <- child("failed", 1, 2, io.EOF)
+		in <- child("dropped", 0, 1, ErrDrop)
+		in <- child("some", 0, 2, ErrDrop)
+		in <- child("some", 1, 2, nil)
+		in <- child("incomplete", 0, 2, nil)
+		close(in)
+
+		results := map[string]Result{}
+		for result := range Collect(ctx, in, CollectInto("children")) {
+			results[result.Record.Meta().ID] = result
+		}
+		assert.Len(t, results, 5)
+		assert.Nil(t, results["plain"].Err)
+		assert.Equal(t, io.EOF, results["failed"].Err)
+		assert.True(t, results["dropped"].Dropped())
+		assert.Nil(t, results["some"].Err)
+
+		v, _ := results["some"].Record.Get("children")
+		assert.Equal(t, []map[string]interface{}{{"i": 1}}, v)
+		assert.EqualError(t, results["incomplete"].Err, "record, incomplete, received 1 of 2 child records")
+	})
+}
@@ -0,0 +1,341 @@
+package dag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	timelineKey      contextKey = "timeline"
+	timelineEntryKey contextKey = "timeline-entry"
+)
+
+// TimelineEntry records the execution of a single task
+type TimelineEntry struct {
+	ID       int
+	ParentID int // 0 for the root task
+	Name     string
+	Path     []string
+	Depth    int
+	Start    time.Time
+	End      time.Time
+	Err      error
+}
+
+// Duration of the task
+func (e TimelineEntry) Duration() time.Duration {
+	return e.End.Sub(e.Start)
+}
+
+// Timeline captures the start and end times of every task executed for a
+// record.  Attach a Timeline to the context with WithTimeline and wrap the dag
+// with the Timing middleware to populate it
+type Timeline struct {
+	mutex   sync.Mutex
+	entries []*TimelineEntry
+}
+
+// NewTimeline returns an empty timeline
+func NewTimeline() *Timeline {
+	return &Timeline{}
+}
+
+// WithTimeline returns a context that records task execution into timeline
+func WithTimeline(ctx context.Context, timeline *Timeline) context.Context {
+	return context.WithValue(ctx, timelineKey, timeline)
+}
+
+// Timing is middleware that records each task into the Timeline attached to
+// the context.  Records without a Timeline pass through untouched.  A batch is
+// recorded as a single entry
+func Timing(task Task) Task {
+	return middlewareTask(task,
+		func(ctx context.Context, record *Record) error {
+			timeline, ok := ctx.Value(timelineKey).(*Timeline)
+			if !ok {
+				return task.Apply(ctx, record)
+			}
+
+			entry := timeline.startTask(ctx, task)
+			err := task.Apply(context.WithValue(ctx, timelineEntryKey, entry.ID), record)
+			timeline.end(entry, err)
+
+			return err
+		},
+		func(ctx context.Context, records []*Record) []error {
+			timeline, ok := ctx.Value(timelineKey).(*Timeline)
+			if !ok {
+				return applyBatch(ctx, task, records)
+			}
+
+			entry := timeline.startTask(ctx, task)
+			errs := applyBatch(context.WithValue(ctx, timelineEntryKey, entry.ID), task, records)
+			timeline.end(entry, newBatchError(errs))
+
+			return errs
+		},
+	)
+}
+
+// startTask starts an entry for the task executing within ctx
+func (t *Timeline) startTask(ctx context.Context, task Task) *TimelineEntry {
+	path := Path(ctx)
+	parentID, _ := ctx.Value(timelineEntryKey).(int)
+	return t.start(parentID, taskName(path, task), path, Depth(ctx))
+}
+
+func (t *Timeline) start(parentID int, name string, path []string, depth int) *TimelineEntry {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	entry := &TimelineEntry{
+		ID:       len(t.entries) + 1,
+		ParentID: parentID,
+		Name:     name,
+		Path:     path,
+		Depth:    depth,
+		Start:    time.Now(),
+	}
+	t.entries = append(t.entries, entry)
+	return entry
+}
+
+func (t *Timeline) end(entry *TimelineEntry, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	entry.End = time.Now()
+	entry.Err = err
+}
+
+// Entries returns a copy of the entries in the order they were started
+func (t *Timeline) Entries() []TimelineEntry {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	entries := make([]TimelineEntry, 0, len(t.entries))
+	for _, entry := range t.entries {
+		entries = append(entries, *entry)
+	}
+	return entries
+}
+
+// origin returns the start of the earliest entry
+func origin(entries []TimelineEntry) time.Time {
+	var t time.Time
+	for _, entry := range entries {
+		if t.IsZero() || entry.Start.Before(t) {
+			t = entry.Start
+		}
+	}
+	return t
+}
+
+// WriteJSON writes the timeline as JSON with offsets and durations in
+// microseconds relative to the start of the first task
+func (t *Timeline) WriteJSON(w io.Writer) error {
+	type Entry struct {
+		ID       int      `json:"id"`
+		ParentID int      `json:"parent_id,omitempty"`
+		Name     string   `json:"name"`
+		Path     []string `json:"path,omitempty"`
+		Depth    int      `json:"depth"`
+		Offset   int64    `json:"offset_us"`
+		Duration int64    `json:"duration_us"`
+		Error    string   `json:"error,omitempty"`
+	}
+
+	entries := t.Entries()
+	start := origin(entries)
+
+	out := struct {
+		StartedAt time.Time `json:"started_at"`
+		Entries   []Entry   `json:"entries"`
+	}{
+		StartedAt: start,
+		Entries:   make([]Entry, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		e := Entry{
+			ID:       entry.ID,
+			ParentID: entry.ParentID,
+			Name:     entry.Name,
+			Path:     entry.Path,
+			Depth:    entry.Depth,
+			Offset:   entry.Start.Sub(start).Microseconds(),
+			Duration: entry.Duration().Microseconds(),
+		}
+		if entry.Err != nil {
+			e.Error = entry.Err.Error()
+		}
+		out.Entries = append(out.Entries, e)
+	}
+
+	return json.NewEncoder(w).Encode(out)
+}
+
+// WriteGantt renders the timeline as a text Gantt chart with bars scaled to
+// width columns
+func (t *Timeline) WriteGantt(w io.Writer, width int) error {
+	if width <= 0 {
+		width = 60
+	}
+
+	entries := t.Entries()
+	if len(entries) == 0 {
+		return nil
+	}
+
+	start := origin(entries)
+	var total time.Duration
+	label := 0
+	for _, entry := range entries {
+		if d := entry.End.Sub(start); d > total {
+			total = d
+		}
+		if n := 2*entry.Depth + len(entry.Name); n > label {
+			label = n
+		}
+	}
+	if total <= 0 {
+		total = 1
+	}
+
+	for _, entry := range entries {
+		from := int(int64(width) * int64(entry.Start.Sub(start)) / int64(total))
+		to := int(int64(width) * int64(entry.End.Sub(start)) / int64(total))
+		if to <= from {
+			to = from + 1
+		}
+		if to > width {
+			to = width
+		}
+		if from >= to {
+			from = to - 1
+		}
+
+		name := strings.Repeat("  ", entry.Depth) + entry.Name
+		bar := strings.Repeat(" ", from) + strings.Repeat("=", to-from) + strings.Repeat(" ", width-to)
+		status := ""
+		if IsDropped(entry.Err) {
+			status = " (dropped)"
+		} else if entry.Err != nil {
+			status = " (error: " + entry.Err.Error() + ")"
+		}
+		if _, err := fmt.Fprintf(w, "%-*s |%s| %v%s\n", label, name, bar, entry.Duration(), status); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteChromeTrace writes the timeline in the Chrome trace event format which
+// may be loaded into chrome://tracing.  Tasks that execute concurrently are
+// placed on separate threads so nesting renders correctly
+func (t *Timeline) WriteChromeTrace(w io.Writer) error {
+	type Event struct {
+		Name     string            `json:"name"`
+		Category string            `json:"cat"`
+		Phase    string            `json:"ph"`
+		TS       int64             `json:"ts"`
+		Duration int64             `json:"dur"`
+		PID      int               `json:"pid"`
+		TID      int               `json:"tid"`
+		Args     map[string]string `json:"args,omitempty"`
+	}
+
+	entries := t.Entries()
+	start := origin(entries)
+	lanes := assignLanes(entries)
+
+	events := make([]Event, 0, len(entries))
+	for _, entry := range entries {
+		args := map[string]string{"path": strings.Join(entry.Path, "/")}
+		if entry.Err != nil {
+			args["error"] = entry.Err.Error()
+		}
+		events = append(events, Event{
+			Name:     entry.Name,
+			Category: "dag",
+			Phase:    "X",
+			TS:       entry.Start.Sub(start).Microseconds(),
+			Duration: entry.Duration().Microseconds(),
+			PID:      1,
+			TID:      lanes[entry.ID],
+			Args:     args,
+		})
+	}
+
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents     []Event `json:"traceEvents"`
+		DisplayTimeUnit string  `json:"displayTimeUnit"`
+	}{
+		TraceEvents:     events,
+		DisplayTimeUnit: "ms",
+	})
+}
+
+// assignLanes returns a lane for each entry id such that entries sharing a lane
+// are either disjoint in time or nested within one another
+func assignLanes(entries []TimelineEntry) map[int]int {
+	parents := map[int]int{}
+	for _, entry := range entries {
+		parents[entry.ID] = entry.ParentID
+	}
+	isAncestor := func(ancestor, id int) bool {
+		for id = parents[id]; id != 0; id = parents[id] {
+			if id == ancestor {
+				return true
+			}
+		}
+		return false
+	}
+
+	sorted := append([]TimelineEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Start.Equal(sorted[j].Start) {
+			return sorted[i].Depth < sorted[j].Depth
+		}
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	var (
+		lanes  = map[int]int{}
+		stacks [][]TimelineEntry // open entries per lane
+	)
+	fits := func(lane int, entry TimelineEntry) bool {
+		stack := stacks[lane]
+		for len(stack) > 0 && !stack[len(stack)-1].End.After(entry.Start) {
+			stack = stack[:len(stack)-1]
+		}
+		stacks[lane] = stack
+		return len(stack) == 0 || isAncestor(stack[len(stack)-1].ID, entry.ID)
+	}
+
+	for _, entry := range sorted {
+		lane := -1
+		if parent, ok := lanes[entry.ParentID]; ok && fits(parent, entry) {
+			lane = parent
+		}
+		for i := 0; lane < 0 && i < len(stacks); i++ {
+			if fits(i, entry) {
+				lane = i
+			}
+		}
+		if lane < 0 {
+			lane = len(stacks)
+			stacks = append(stacks, nil)
+		}
+		stacks[lane] = append(stacks[lane], entry)
+		lanes[entry.ID] = lane
+	}
+
+	return lanes
+}
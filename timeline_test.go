@@ -0,0 +1,109 @@
+package dag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tj/assert"
+)
+
+func sleepTask(d time.Duration) TaskFunc {
+	return func(ctx context.Context, record *Record) error {
+		time.Sleep(d)
+		return nil
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	task := Serial(
+		WithName("a", sleepTask(time.Millisecond)),
+		Parallel(
+			WithName("b", sleepTask(5*time.Millisecond)),
+			WithName("c", sleepTask(5*time.Millisecond)),
+		),
+	)
+	task = Wrap(task, Timing)
+
+	timeline := NewTimeline()
+	ctx := WithTimeline(context.Background(), timeline)
+	err := task.Apply(ctx, &Record{})
+	assert.Nil(t, err)
+
+	entries := timeline.Entries()
+	assert.Len(t, entries, 5)
+
+	byName := map[string]TimelineEntry{}
+	for _, entry := range entries {
+		byName[entry.Name] = entry
+		assert.True(t, entry.Duration() > 0)
+	}
+	assert.Equal(t, byName["Serial"].ID, byName["a"].ParentID)
+	assert.Equal(t, byName["Parallel"].ID, byName["b"].ParentID)
+	assert.Equal(t, byName["Parallel"].ID, byName["c"].ParentID)
+
+	t.Run("json", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := timeline.WriteJSON(buf)
+		assert.Nil(t, err)
+
+		var got struct {
+			Entries []struct {
+				Name     string `json:"name"`
+				Duration int64  `json:"duration_us"`
+			} `json:"entries"`
+		}
+		err = json.Unmarshal(buf.Bytes(), &got)
+		assert.Nil(t, err)
+		assert.Len(t, got.Entries, 5)
+		assert.Equal(t, "Serial", got.Entries[0].Name)
+	})
+
+	t.Run("gantt", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := timeline.WriteGantt(buf, 40)
+		assert.Nil(t, err)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Len(t, lines, 5)
+		assert.True(t, strings.HasPrefix(lines[0], "Serial"))
+		assert.True(t, strings.HasPrefix(lines[1], "  a "))
+		assert.Contains(t, lines[0], "|"+strings.Repeat("=", 40)+"|")
+	})
+
+	t.Run("chrome trace", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := timeline.WriteChromeTrace(buf)
+		assert.Nil(t, err)
+
+		var got struct {
+			TraceEvents []struct {
+				Name  string `json:"name"`
+				Phase string `json:"ph"`
+				TID   int    `json:"tid"`
+			} `json:"traceEvents"`
+		}
+		err = json.Unmarshal(buf.Bytes(), &got)
+		assert.Nil(t, err)
+		assert.Len(t, got.TraceEvents, 5)
+
+		tids := map[string]int{}
+		for _, event := range got.TraceEvents {
+			assert.Equal(t, "X", event.Phase)
+			tids[event.Name] = event.TID
+		}
+		assert.Equal(t, tids["Serial"], tids["a"])
+		assert.NotEqual(t, tids["b"], tids["c"])
+	})
+}
+
+func TestTiming_NoTimeline(t *testing.T) {
+	var counter int64
+	task := Wrap(counterTask(&counter), Timing)
+	err := task.Apply(context.Background(), &Record{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, int(counter))
+}
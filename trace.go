@@ -0,0 +1,187 @@
+package dag
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attribute is a key value pair attached to a Span
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span represents a single traced task
+type Span interface {
+	// SetAttributes attaches attributes to the span
+	SetAttributes(attrs ...Attribute)
+
+	// RecordError marks the span as failed
+	RecordError(err error)
+
+	// End completes the span
+	End()
+}
+
+// Tracer creates spans.  The returned context must carry the span so spans
+// started from it become children
+type Tracer interface {
+	// Start a new span as a child of any span contained within ctx
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Trace returns middleware that wraps each task in a span.  As containers are
+// wrapped as well, the spans for Serial and Parallel children are nested
+// within the span of their container.  A batch is traced as a single span
+// listing the ids of its records
+func Trace(tracer Tracer) func(Task) Task {
+	return func(task Task) Task {
+		apply := func(ctx context.Context, record *Record) error {
+			path := Path(ctx)
+			ctx, span := tracer.Start(ctx, taskName(path, task))
+			defer span.End()
+
+			span.SetAttributes(
+				Attribute{Key: "dag.task", Value: taskName(path, task)},
+				Attribute{Key: "dag.path", Value: strings.Join(path, "/")},
+				Attribute{Key: "dag.record_id", Value: record.Meta().ID},
+			)
+
+			err := task.Apply(ctx, record)
+			switch {
+			case IsDropped(err):
+				span.SetAttributes(Attribute{Key: "dag.dropped", Value: dropReason(err)})
+			case err != nil:
+				span.RecordError(err)
+			}
+			return err
+		}
+
+		batch := func(ctx context.Context, records []*Record) []error {
+			path := Path(ctx)
+			ctx, span := tracer.Start(ctx, taskName(path, task))
+			defer span.End()
+
+			ids := make([]string, 0, len(records))
+			for _, record := range records {
+				ids = append(ids, record.Meta().ID)
+			}
+			span.SetAttributes(
+				Attribute{Key: "dag.task", Value: taskName(path, task)},
+				Attribute{Key: "dag.path", Value: strings.Join(path, "/")},
+				Attribute{Key: "dag.record_ids", Value: ids},
+			)
+
+			var (
+				errs    = applyBatch(ctx, task, records)
+				failed  = make([]error, len(errs))
+				dropped int
+			)
+			for i, err := range errs {
+				if IsDropped(err) {
+					dropped++
+					continue
+				}
+				failed[i] = err
+			}
+			if dropped > 0 {
+				span.SetAttributes(Attribute{Key: "dag.dropped_count", Value: dropped})
+			}
+			if err := newBatchError(failed); err != nil {
+				span.RecordError(err)
+			}
+			return errs
+		}
+
+		return middlewareTask(task, apply, batch)
+	}
+}
+
+// RecordedSpan holds a span captured by MemoryTracer
+type RecordedSpan struct {
+	ID         int
+	ParentID   int // 0 for root spans
+	Name       string
+	Attributes map[string]interface{}
+	Err        error
+	StartedAt  time.Time
+	EndedAt    time.Time
+}
+
+const spanKey contextKey = "span"
+
+// MemoryTracer records spans in memory; useful for testing
+type MemoryTracer struct {
+	mutex sync.Mutex
+	spans []*RecordedSpan
+}
+
+// NewMemoryTracer returns a new in-memory tracer
+func NewMemoryTracer() *MemoryTracer {
+	return &MemoryTracer{}
+}
+
+// Start implements Tracer
+func (m *MemoryTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	parentID, _ := ctx.Value(spanKey).(int)
+	span := &RecordedSpan{
+		ID:         len(m.spans) + 1,
+		ParentID:   parentID,
+		Name:       name,
+		Attributes: map[string]interface{}{},
+		StartedAt:  time.Now(),
+	}
+	m.spans = append(m.spans, span)
+
+	return context.WithValue(ctx, spanKey, span.ID), memorySpan{tracer: m, span: span}
+}
+
+// Spans returns a copy of the spans recorded in the order they were started
+func (m *MemoryTracer) Spans() []RecordedSpan {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	spans := make([]RecordedSpan, 0, len(m.spans))
+	for _, span := range m.spans {
+		dupe := *span
+		dupe.Attributes = map[string]interface{}{}
+		for k, v := range span.Attributes {
+			dupe.Attributes[k] = v
+		}
+		spans = append(spans, dupe)
+	}
+	return spans
+}
+
+type memorySpan struct {
+	tracer *MemoryTracer
+	span   *RecordedSpan
+}
+
+func (s memorySpan) SetAttributes(attrs ...Attribute) {
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+
+	for _, attr := range attrs {
+		s.span.Attributes[attr.Key] = attr.Value
+	}
+}
+
+func (s memorySpan) RecordError(err error) {
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+
+	s.span.Err = err
+}
+
+func (s memorySpan) End() {
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+
+	s.span.EndedAt = time.Now()
+}
@@ -0,0 +1,69 @@
+package dag
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func TestTrace(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("nesting", func(t *testing.T) {
+		tracer := NewMemoryTracer()
+		task := Serial(
+			WithName("a", nopTask()),
+			Parallel(WithName("b", nopTask())),
+		)
+		task = Wrap(task, Trace(tracer))
+
+		err := task.Apply(ctx, NewRecord(Meta{ID: "abc"}))
+		assert.Nil(t, err)
+
+		spans := tracer.Spans()
+		assert.Len(t, spans, 4)
+
+		byName := map[string]RecordedSpan{}
+		for _, span := range spans {
+			byName[span.Name] = span
+			assert.Equal(t, "abc", span.Attributes["dag.record_id"])
+			assert.False(t, span.EndedAt.IsZero())
+		}
+		assert.Equal(t, 0, byName["Serial"].ParentID)
+		assert.Equal(t, byName["Serial"].ID, byName["a"].ParentID)
+		assert.Equal(t, byName["Serial"].ID, byName["Parallel"].ParentID)
+		assert.Equal(t, byName["Parallel"].ID, byName["b"].ParentID)
+		assert.Equal(t, "Serial/Parallel/b", byName["b"].Attributes["dag.path"])
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tracer := NewMemoryTracer()
+		task := Wrap(WithName("boom", TaskFunc(func(ctx context.Context, record *Record) error {
+			return io.EOF
+		})), Trace(tracer))
+
+		err := task.Apply(ctx, &Record{})
+		assert.Equal(t, io.EOF, err)
+
+		spans := tracer.Spans()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, io.EOF, spans[0].Err)
+	})
+
+	t.Run("dropped", func(t *testing.T) {
+		tracer := NewMemoryTracer()
+		task := Wrap(WithName("filter", TaskFunc(func(ctx context.Context, record *Record) error {
+			return Drop("too old")
+		})), Trace(tracer))
+
+		err := task.Apply(ctx, &Record{})
+		assert.True(t, IsDropped(err))
+
+		spans := tracer.Spans()
+		assert.Len(t, spans, 1)
+		assert.Nil(t, spans[0].Err)
+		assert.Equal(t, "too old", spans[0].Attributes["dag.dropped"])
+	})
+}